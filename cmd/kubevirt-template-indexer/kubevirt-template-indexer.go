@@ -19,9 +19,12 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"time"
 
 	flag "github.com/spf13/pflag"
 
@@ -31,23 +34,27 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
-	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/handler"
-	"sigs.k8s.io/controller-runtime/pkg/manager"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
-	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 
-	templatev1 "github.com/openshift/api/template/v1"
-
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/auth"
 	"github.com/fromanirh/kubevirt-template-indexer/pkg/reconciler"
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/sources"
 	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
 
 	_ "github.com/fromanirh/kubevirt-template-indexer/pkg/okd"
 
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/grpcserver"
 	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/routes"
 )
 
@@ -80,93 +87,273 @@ func zapLogger(development bool) logr.Logger {
 
 var log = logf.Log.WithName("kubevirt-template-indexer")
 
-type ledgerDesc struct {
-	Name  string
-	Label string
-}
-
 func main() {
 	develMode := flag.BoolP("develmode", "D", false, "enable development mode (more logs)")
 	startupSync := flag.BoolP("skipsync", "s", true, "skip initial sync with cluster")
-	namespace := flag.StringP("namespace", "N", "", "restrict namespace to watch (default: all)")
+	namespaces := flag.StringSliceP("namespace", "N", []string{}, "restrict the namespaces to watch (default: all)")
+	namespaceSelector := flag.String("namespace-selector", "", "watch also the namespaces matching this label selector, added and removed as they come and go")
 	iface := flag.StringP("interface", "I", "", "listen only on this interface for HTTP queries (default: all)")
 	port := flag.IntP("port", "p", 8080, "listen on port for HTTP queries (default: 8080)")
+	grpcPort := flag.Int("grpc-port", 0, "serve the gRPC API on this port; the same as --port serves both APIs on it (0 disables)")
 	configDir := flag.StringP("confdir", "C", "/etc/template-index", "base directory for the config map files")
+	ledgersConf := flag.StringP("ledgers", "L", "", "YAML file describing the ledgers (default: os, workload, size)")
+	osinfoDB := flag.StringP("osinfo-db", "O", "/usr/share/osinfo", "path of the libosinfo database, used to describe the OSes")
+	reloadInterval := flag.DurationP("reload-interval", "R", 10*time.Second, "check the config map files, the icons and the TLS certificate for changes with this interval (0 disables)")
+	sourceNames := flag.StringSliceP("sources", "S", []string{sources.SourceTemplates}, "kinds of objects to index: templates, virtualmachines, virtualmachinetemplates")
+	selector := flag.StringP("selector", "l", "", "index only the objects matching this label selector, like template.cnv.io/type=base (default: all)")
+	autoSelect := flag.BoolP("auto-select", "A", false, "index only the templates creating a kubevirt.io VirtualMachine")
+	authenticate := flag.Bool("authenticate", false, "require a bearer token, and show to the callers only the templates of the namespaces they can get them from")
+	authCacheTTL := flag.Duration("auth-cache-ttl", auth.DefaultCacheTTL, "remember the token and access reviews for this long")
+	tlsCert := flag.String("tls-cert", "", "serve HTTPS using this certificate, reloaded when it changes")
+	tlsKey := flag.String("tls-key", "", "private key of the TLS certificate")
+	tlsClientCA := flag.String("tls-client-ca", "", "require client certificates signed by the CAs in this bundle")
+	tlsMinVersion := flag.String("tls-min-version", "1.2", "minimum TLS version: 1.0, 1.1, 1.2, 1.3")
+	tlsCipherSuites := flag.StringSlice("tls-cipher-suites", []string{}, "allowed TLS cipher suites, like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (default: Go's)")
+	redirectPort := flag.Int("https-redirect-port", 0, "redirect the plain HTTP requests on this port to HTTPS (0 disables)")
+	clientRate := flag.Float64("client-rate", 0, "requests per second allowed to each client, by user if authenticated, by IP otherwise (0 disables)")
+	clientBurst := flag.Int("client-burst", 10, "requests each client may send at once above --client-rate")
+	maxInFlight := flag.Int("max-in-flight", 0, "requests served at the same time (0 disables)")
+	requestTimeout := flag.Duration("request-timeout", 0, "how long a request may take (0 disables)")
+	maxBodyBytes := flag.Int64("max-body-bytes", 0, "maximum size of the request body (0 disables)")
+	maxHeaderBytes := flag.Int("max-header-bytes", 0, "maximum size of the request headers (default: 1MB)")
+	iconsDir := flag.String("icons", "", "serve the icons in this directory, named after the iconClass of the templates like icon-centos.svg (default: only the icons embedded in the templates)")
+	historyLength := flag.IntP("history", "H", templateindex.DefaultHistoryLength, "revisions to keep for each template (0 disables)")
 	flag.Parse()
 
 	logf.SetLogger(zapLogger(*develMode))
 	entryLog := log.WithName("entrypoint")
 
+	// must be called once, so we share it among all the components
+	stop := signals.SetupSignalHandler()
+
+	var err error
 	index := templateindex.NewTemplateIndexer(log.WithName("indexer"))
+	index.SetHistoryLength(*historyLength)
+	watcher := templateindex.NewNameMapWatcher(log.WithName("namemaps"), *reloadInterval)
+
+	ledgersConfig := templateindex.DefaultLedgersConfig()
+	if *ledgersConf != "" {
+		ledgersConfig, err = templateindex.ReadLedgersConfig(*ledgersConf)
+		if err != nil {
+			entryLog.Error(err, fmt.Sprintf("unable to read the ledgers configuration %s", *ledgersConf))
+			os.Exit(1)
+		}
+	}
+
+	if err := ledgersConfig.CheckRoutes(routes.CheckRoute); err != nil {
+		entryLog.Error(err, "invalid routes of the ledgers")
+		os.Exit(1)
+	}
+
+	summaryRoutes := routes.Routes{}
+	for _, lc := range ledgersConfig.Ledgers {
+		ld := templateindex.NewJSONLedger(lc.Label)
 
-	descs := []ledgerDesc{
-		ledgerDesc{
-			Name:  "os",
-			Label: "os",
-		},
-		ledgerDesc{
-			Name:  "workload",
-			Label: "workload",
-		},
-		ledgerDesc{
-			Name:  "size",
-			Label: "flavor",
-		},
-	}
-	for _, desc := range descs {
-		ld := templateindex.NewJSONLedger(desc.Label)
-
-		confPath := filepath.Join(*configDir, desc.Name)
+		confPath := lc.NamesPath(*configDir)
 		err := ld.ReadNameMap(confPath)
 		if err != nil {
-			entryLog.Error(err, fmt.Sprintf("unable read name map %s for ledger %->%s: %s", confPath, desc.Name, desc.Label, err))
+			entryLog.Error(err, fmt.Sprintf("unable read name map %s for ledger %s->%s: %s", confPath, lc.Name, lc.Label, err))
 			// we can carry on with less data
 		}
 
-		index.AddLedger(desc.Name, ld)
-		entryLog.Info(fmt.Sprintf("added ledger %s for label=%s", desc.Name, desc.Label))
+		var ledger templateindex.Ledger = ld
+		switch lc.Type {
+		case templateindex.LedgerTypeOS:
+			osld := templateindex.NewOSLedger(ld)
+			if len(lc.Versions) > 0 {
+				osld.SetVersionRules(lc.Versions)
+			}
+			err = osld.ReadOSInfoDB(*osinfoDB)
+			if err != nil {
+				entryLog.Error(err, fmt.Sprintf("unable to read the osinfo database %s: %s", *osinfoDB, err))
+				// we can carry on with less data
+			}
+			ledger = osld
+		case templateindex.LedgerTypeLabelValue, templateindex.LedgerTypeAnnotation, templateindex.LedgerTypeTags, templateindex.LedgerTypeAPIVersion:
+			ledger = templateindex.NewValueLedger(ld, lc.Type)
+		}
+
+		index.AddLedger(lc.Name, ledger)
+		watcher.Add(lc.Name, confPath, ld)
+		entryLog.Info(fmt.Sprintf("added ledger %s for label=%s", lc.Name, lc.Label))
+
+		if lc.Route != "" {
+			summaryRoutes = append(summaryRoutes, routes.SummaryRoute(lc.Name, lc.Route, lc.Name))
+		}
+	}
+
+	if *reloadInterval > 0 {
+		entryLog.Info(fmt.Sprintf("watching name maps every %v", *reloadInterval))
+		go watcher.Run(stop)
+	}
+
+	var icons *templateindex.IconStore
+	if *iconsDir != "" {
+		icons = templateindex.NewIconStore(*iconsDir, log.WithName("icons"))
+		if err := icons.Load(); err != nil {
+			entryLog.Error(err, fmt.Sprintf("unable to read the icons in %s", *iconsDir))
+			// we can carry on with less data
+		}
+		if *reloadInterval > 0 {
+			go icons.Run(*reloadInterval, stop)
+		}
 	}
+	index.SetIcons(icons, routes.IconsPath())
 
-	// Setup a Manager
-	entryLog.Info("setting up manager")
-	mgr, err := manager.New(config.GetConfigOrDie(), manager.Options{Namespace: *namespace})
+	cfg := config.GetConfigOrDie()
+
+	filter, err := sources.NewFilter(*selector, *autoSelect)
 	if err != nil {
-		entryLog.Error(err, "unable to set up overall controller manager")
+		entryLog.Error(err, fmt.Sprintf("invalid selector %q", *selector))
 		os.Exit(1)
 	}
 
-	entryLog.Info("setting up reconciler")
-	tr := reconciler.NewTemplateReconciler(mgr.GetClient(), log.WithName("reconciler"), index)
+	for _, name := range *sourceNames {
+		switch name {
+		case sources.SourceTemplates, sources.SourceVirtualMachines, sources.SourceVirtualMachineTemplates:
+		default:
+			entryLog.Error(fmt.Errorf("unknown source: %s", name), fmt.Sprintf("unable to set up source %s", name))
+			os.Exit(1)
+		}
+	}
 
-	entryLog.Info("setting up controller")
-	c, err := controller.New("foo-controller", mgr, controller.Options{
-		Reconciler: tr,
-	})
+	var dynClient dynamic.Interface
+	// the sources of each namespace; the OpenShift templates get a manager, and so a cache, for each namespace
+	factory := func(namespace string, index sources.Indexer) ([]sources.Source, error) {
+		srcs := []sources.Source{}
+		for _, name := range *sourceNames {
+			var src sources.Source
+			var err error
+			switch name {
+			case sources.SourceTemplates:
+				src, err = reconciler.NewTemplateSource(cfg, namespace, filter, log.WithName("reconciler").WithValues("namespace", namespace), index)
+			case sources.SourceVirtualMachines, sources.SourceVirtualMachineTemplates:
+				if dynClient == nil {
+					dynClient, err = dynamic.NewForConfig(cfg)
+					if err != nil {
+						break
+					}
+				}
+				var us *sources.UnstructuredSource
+				if name == sources.SourceVirtualMachines {
+					us = sources.NewVirtualMachineSource(dynClient, namespace, index, log.WithName(name).WithValues("namespace", namespace))
+				} else {
+					us = sources.NewVirtualMachineTemplateSource(dynClient, namespace, index, log.WithName(name).WithValues("namespace", namespace))
+				}
+				us.SetFilter(filter)
+				src = us
+			}
+			if err != nil {
+				return nil, fmt.Errorf("unable to set up source %s: %v", name, err)
+			}
+			srcs = append(srcs, src)
+		}
+		return srcs, nil
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		entryLog.Error(err, "unable to set up individual controller")
+		entryLog.Error(err, "unable to set up the kubernetes client")
 		os.Exit(1)
 	}
 
-	if *startupSync {
-		entryLog.Info("syncing reconciler")
-		err = tr.SyncWithCluster(*namespace)
+	names := *namespaces
+	var nsSelector labels.Selector
+	var nsClient corev1client.NamespaceInterface
+	if *namespaceSelector != "" {
+		nsSelector, err = labels.Parse(*namespaceSelector)
 		if err != nil {
-			entryLog.Error(err, "unable to sync with cluster")
+			entryLog.Error(err, fmt.Sprintf("invalid namespace selector %q", *namespaceSelector))
 			os.Exit(1)
 		}
+		nsClient = clientset.CoreV1().Namespaces()
+	} else if len(names) == 0 {
+		// all of them
+		names = []string{""}
 	}
 
-	if err := c.Watch(&source.Kind{Type: &templatev1.Template{}}, &handler.EnqueueRequestForObject{}); err != nil {
-		entryLog.Error(err, "unable to watch Templates")
+	entryLog.Info("setting up sources")
+	nsSet := sources.NewNamespaceSet(nsClient, names, nsSelector, factory, index, *startupSync, log.WithName("namespaces"))
+	if err := nsSet.Start(stop); err != nil {
+		entryLog.Error(err, "unable to index the namespaces")
 		os.Exit(1)
 	}
 
-	entryLog.Info("starting HTTP endpoints")
-	go routes.Serve(*iface, *port, index, log.WithName("httpapi"))
+	var authorizer *auth.Authorizer
+	if *authenticate {
+		authorizer = auth.NewAuthorizer(clientset, log.WithName("auth"))
+		authorizer.SetCacheTTL(*authCacheTTL)
+		routes.EnableAuth(authorizer)
+	}
 
-	entryLog.Info("starting manager")
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
-		entryLog.Error(err, "unable to run manager")
-		os.Exit(1)
+	routes.SetLimits(routes.LimitOptions{
+		ClientRate:     *clientRate,
+		ClientBurst:    *clientBurst,
+		MaxInFlight:    *maxInFlight,
+		Timeout:        *requestTimeout,
+		MaxBodyBytes:   *maxBodyBytes,
+		MaxHeaderBytes: *maxHeaderBytes,
+	})
+
+	var tlsConfig *tls.Config
+	if *tlsCert != "" {
+		reloader, err := routes.NewCertificateReloader(*tlsCert, *tlsKey, log.WithName("tls"))
+		if err != nil {
+			entryLog.Error(err, fmt.Sprintf("unable to load the TLS certificate %s", *tlsCert))
+			os.Exit(1)
+		}
+		tlsConfig, err = routes.NewTLSConfig(routes.TLSOptions{
+			ClientCAFile: *tlsClientCA,
+			MinVersion:   *tlsMinVersion,
+			CipherSuites: *tlsCipherSuites,
+		}, reloader)
+		if err != nil {
+			entryLog.Error(err, "invalid TLS configuration")
+			os.Exit(1)
+		}
+		if *reloadInterval > 0 {
+			go reloader.Run(*reloadInterval, stop)
+		}
 	}
+
+	if *grpcPort != 0 {
+		// the same limits as the HTTP API, shared with it
+		opts := routes.GRPCServerOptions()
+		if tlsConfig != nil && *grpcPort != *port {
+			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		}
+		grpcServer := grpc.NewServer(opts...)
+		service := grpcserver.NewServer(index, log.WithName("grpcapi"))
+		if authorizer != nil {
+			service.EnableAuth(authorizer)
+		}
+		service.Register(grpcServer)
+
+		if *grpcPort == *port {
+			entryLog.Info("serving the gRPC API on the HTTP port")
+			routes.MultiplexGRPC(grpcServer)
+		} else {
+			lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", *iface, *grpcPort))
+			if err != nil {
+				entryLog.Error(err, fmt.Sprintf("unable to listen on port %d for gRPC", *grpcPort))
+				os.Exit(1)
+			}
+			entryLog.Info(fmt.Sprintf("starting gRPC endpoints on port %d", *grpcPort))
+			go grpcServer.Serve(lis)
+		}
+	}
+
+	if tlsConfig == nil {
+		entryLog.Info("starting HTTP endpoints")
+		go routes.Serve(*iface, *port, index, log.WithName("httpapi"), summaryRoutes)
+	} else {
+		entryLog.Info("starting HTTPS endpoints")
+		go routes.ServeTLS(*iface, *port, tlsConfig, index, log.WithName("httpapi"), summaryRoutes)
+		if *redirectPort > 0 {
+			entryLog.Info(fmt.Sprintf("redirecting HTTP on port %d to HTTPS", *redirectPort))
+			go routes.RedirectToHTTPS(*iface, *redirectPort, *port)
+		}
+	}
+
+	<-stop
 }
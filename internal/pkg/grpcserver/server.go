@@ -0,0 +1,374 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+// Package grpcserver serves the gRPC API of the template indexer, defined in pkg/grpcapi
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/auth"
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/grpcapi"
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+// ServiceName is the name of the service in the health checks
+const ServiceName = "templateindexer.v1.TemplateIndexer"
+
+// WatchBuffer is how many changes a watcher may fall behind before being dropped
+const WatchBuffer = 256
+
+// Server implements the TemplateIndexer gRPC service
+type Server struct {
+	grpcapi.UnimplementedTemplateIndexerServer
+	index *templateindex.TemplateIndexer
+	log   logr.Logger
+	// hides the templates the callers cannot see; nil if everything is visible to everyone
+	authorizer *auth.Authorizer
+}
+
+func NewServer(index *templateindex.TemplateIndexer, log logr.Logger) *Server {
+	return &Server{
+		index: index,
+		log:   log,
+	}
+}
+
+// EnableAuth makes the server authenticate the callers with the bearer token in the "authorization" metadata,
+// and show them only the templates of the namespaces they are allowed to see
+func (s *Server) EnableAuth(authorizer *auth.Authorizer) {
+	s.authorizer = authorizer
+}
+
+// Register registers the service on the gRPC server, along with the health and the reflection services
+func (s *Server) Register(server *grpc.Server) {
+	grpcapi.RegisterTemplateIndexerServer(server, s)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	reflection.Register(server)
+}
+
+func (s *Server) ListTemplates(ctx context.Context, req *grpcapi.ListTemplatesRequest) (*grpcapi.ListTemplatesResponse, error) {
+	opts, err := s.visibleOptions(ctx, filterOptions(req.Filters, req.IncludeDeprecated))
+	if err != nil {
+		return nil, err
+	}
+	descs, err := s.index.DescribeBy(opts, req.Languages...)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	res := &grpcapi.ListTemplatesResponse{}
+	for i := range descs {
+		res.Templates = append(res.Templates, toDescription(&descs[i]))
+	}
+	return res, nil
+}
+
+func (s *Server) GetTemplate(ctx context.Context, req *grpcapi.GetTemplateRequest) (*grpcapi.GetTemplateResponse, error) {
+	if err := s.checkVisible(ctx, req.Namespace, req.Name); err != nil {
+		return nil, err
+	}
+	t, err := s.index.Template(req.Namespace, req.Name)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	desc, _ := s.index.DescribeMatching(&t, allTemplates(), req.Languages...)
+
+	if apiVersion := req.ApiVersion; apiVersion != "" {
+		if apiVersion == "current" {
+			apiVersion = templateindex.CurrentVMAPIVersion
+		}
+		converted, err := templateindex.ConvertTemplate(&t, apiVersion)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		t = *converted
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &grpcapi.GetTemplateResponse{
+		Description: toDescription(&desc),
+		Template:    data,
+	}, nil
+}
+
+func (s *Server) Summarize(ctx context.Context, req *grpcapi.SummarizeRequest) (*grpcapi.SummarizeResponse, error) {
+	opts, err := s.visibleOptions(ctx, filterOptions(req.Filters, req.IncludeDeprecated))
+	if err != nil {
+		return nil, err
+	}
+	var summaries []templateindex.Summary
+	if req.Counts {
+		summaries, err = s.index.CountBy(req.Ledger, opts, req.Languages...)
+	} else {
+		summaries, err = s.index.SummarizeBy(req.Ledger, opts, req.Languages...)
+	}
+	if err != nil {
+		// the only error is an unknown ledger
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	res := &grpcapi.SummarizeResponse{}
+	for i := range summaries {
+		res.Summaries = append(res.Summaries, toSummary(&summaries[i]))
+	}
+	return res, nil
+}
+
+// Watch streams the changes of the matching templates. A template modified to match the filters
+// is reported as added, and one modified not to match them anymore as deleted.
+// If the watcher falls behind, the stream ends with ResourceExhausted: it must watch again.
+func (s *Server) Watch(req *grpcapi.WatchRequest, stream grpcapi.TemplateIndexer_WatchServer) error {
+	ctx := stream.Context()
+	user, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	opts := filterOptions(req.Filters, req.IncludeDeprecated)
+
+	// before listing the templates, not to miss the changes in between
+	sub := s.index.Subscribe(WatchBuffer)
+	defer sub.Close()
+
+	// the names of the templates the watcher knows about, by namespace
+	sent := make(map[string]bool)
+	if req.InitialTemplates {
+		for _, namespace := range s.index.Namespaces() {
+			visible, err := s.canGet(user, namespace)
+			if err != nil {
+				return err
+			}
+			if !visible {
+				continue
+			}
+			descs, err := s.index.DescribeBy(opts.WithNamespaces([]string{namespace}), req.Languages...)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			for i := range descs {
+				ev := &grpcapi.WatchEvent{
+					Type:        grpcapi.WatchEvent_ADDED,
+					Namespace:   namespace,
+					Name:        descs[i].ID,
+					Description: toDescription(&descs[i]),
+				}
+				if err := stream.Send(ev); err != nil {
+					return err
+				}
+				sent[namespace+"/"+descs[i].ID] = true
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-sub.Events():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watch fell behind the changes, watch again")
+			}
+			visible, err := s.canGet(user, ev.Template.Namespace)
+			if err != nil {
+				return err
+			}
+			if !visible {
+				continue
+			}
+
+			key := ev.Template.Namespace + "/" + ev.Template.Name
+			desc, matches := s.index.DescribeMatching(&ev.Template, opts, req.Languages...)
+			eventType := grpcapi.WatchEvent_MODIFIED
+			switch {
+			case ev.Type == templateindex.EventDeleted || !matches:
+				if !sent[key] {
+					continue
+				}
+				if !matches {
+					desc, _ = s.index.DescribeMatching(&ev.Template, allTemplates(), req.Languages...)
+				}
+				eventType = grpcapi.WatchEvent_DELETED
+				delete(sent, key)
+			case !sent[key]:
+				eventType = grpcapi.WatchEvent_ADDED
+				sent[key] = true
+			}
+
+			err = stream.Send(&grpcapi.WatchEvent{
+				Type:        eventType,
+				Namespace:   ev.Template.Namespace,
+				Name:        ev.Template.Name,
+				Description: toDescription(&desc),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// authenticate returns the user calling, or nil if the authentication is disabled
+func (s *Server) authenticate(ctx context.Context) (*auth.User, error) {
+	if s.authorizer == nil {
+		return nil, nil
+	}
+	token := ""
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if strings.HasPrefix(value, "Bearer ") {
+			token = strings.TrimPrefix(value, "Bearer ")
+		}
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, auth.ErrUnauthenticated.Error())
+	}
+	user, err := s.authorizer.Authenticate(token)
+	if err == auth.ErrUnauthenticated {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return user, nil
+}
+
+func (s *Server) canGet(user *auth.User, namespace string) (bool, error) {
+	if s.authorizer == nil {
+		return true, nil
+	}
+	allowed, err := s.authorizer.CanGet(user, namespace)
+	if err != nil {
+		return false, status.Error(codes.Internal, err.Error())
+	}
+	return allowed, nil
+}
+
+func (s *Server) visibleOptions(ctx context.Context, opts templateindex.FilterOptions) (templateindex.FilterOptions, error) {
+	if s.authorizer == nil {
+		return opts, nil
+	}
+	user, err := s.authenticate(ctx)
+	if err != nil {
+		return opts, err
+	}
+	namespaces, err := s.authorizer.VisibleNamespaces(user, s.index.Namespaces())
+	if err != nil {
+		return opts, status.Error(codes.Internal, err.Error())
+	}
+	return opts.WithNamespaces(namespaces), nil
+}
+
+// checkVisible fails with NotFound if the caller cannot see the template, like if it did not exist
+func (s *Server) checkVisible(ctx context.Context, namespace, name string) error {
+	user, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	allowed, err := s.canGet(user, namespace)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return status.Error(codes.NotFound, fmt.Sprintf("unknown template: %s/%s", namespace, name))
+	}
+	return nil
+}
+
+func filterOptions(filters map[string]string, includeDeprecated bool) templateindex.FilterOptions {
+	opts := templateindex.FilterOptions{}
+	for key, value := range filters {
+		opts[key] = value
+	}
+	// like the HTTP API, the callers cannot choose the namespaces
+	opts = opts.Without(templateindex.NamespacesOption)
+	if includeDeprecated {
+		opts[templateindex.IncludeDeprecatedOption] = "true"
+	}
+	return opts
+}
+
+// allTemplates are the options matching any template
+func allTemplates() templateindex.FilterOptions {
+	return templateindex.FilterOptions{templateindex.IncludeDeprecatedOption: "true"}
+}
+
+func toSummary(summary *templateindex.Summary) *grpcapi.Summary {
+	res := &grpcapi.Summary{
+		Id:    summary.ID,
+		Name:  summary.Name,
+		Count: int32(summary.Count),
+	}
+	if info := summary.OSInfo; info != nil {
+		res.OsInfo = &grpcapi.OSInfo{
+			Vendor:      info.Vendor,
+			Family:      info.Family,
+			Distro:      info.Distro,
+			Version:     info.Version,
+			ReleaseDate: info.ReleaseDate,
+			EolDate:     info.EOLDate,
+		}
+	}
+	return res
+}
+
+func toDescription(desc *templateindex.Description) *grpcapi.Description {
+	res := &grpcapi.Description{
+		Summary:      toSummary(&desc.Summary),
+		Description:  desc.Description,
+		IconId:       desc.Icon,
+		IconUrl:      desc.IconURL,
+		OsId:         desc.OS,
+		Workload:     desc.Workload,
+		Size:         desc.Size,
+		Version:      desc.Version,
+		VmApiVersion: desc.VMAPIVersion,
+		Lifecycle: &grpcapi.Lifecycle{
+			Deprecated:   desc.Deprecated,
+			ReplacedBy:   desc.ReplacedBy,
+			EndOfSupport: desc.EndOfSupport,
+		},
+	}
+	if len(desc.Facets) > 0 {
+		res.Facets = make(map[string]*grpcapi.Values)
+		for key, values := range desc.Facets {
+			res.Facets[key] = &grpcapi.Values{Values: values}
+		}
+	}
+	return res
+}
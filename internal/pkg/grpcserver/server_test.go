@@ -0,0 +1,203 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/grpcapi"
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+func setupServer(t *testing.T) (*templateindex.TemplateIndexer, []templatev1.Template, *grpc.ClientConn, func()) {
+	templates, err := testutils.LoadTemplates("../../../pkg/templateindex/test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 3 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	for i := range templates {
+		templates[i].Namespace = "openshift"
+	}
+
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", templateindex.NewOSLedger(templateindex.NewJSONLedger("os")))
+	ti.AddLedger("workload", templateindex.NewJSONLedger("workload"))
+	ti.AddLedger("size", templateindex.NewJSONLedger("flavor"))
+	count, err := ti.AddTemplates(templates[1:])
+	if err != nil || count != len(templates)-1 {
+		t.Fatalf("failed to add test templates! %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	NewServer(ti, logf.NullLogger{}).Register(server)
+	go server.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	return ti, templates, conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestListTemplates(t *testing.T) {
+	_, templates, conn, cleanup := setupServer(t)
+	defer cleanup()
+	client := grpcapi.NewTemplateIndexerClient(conn)
+
+	res, err := client.ListTemplates(context.Background(), &grpcapi.ListTemplatesRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Templates) != len(templates)-1 {
+		t.Errorf("unexpected templates: %v expected %v", len(res.Templates), len(templates)-1)
+	}
+
+	osID := res.Templates[0].OsId
+	res, err = client.ListTemplates(context.Background(), &grpcapi.ListTemplatesRequest{
+		Filters: map[string]string{"os": osID},
+	})
+	if err != nil || len(res.Templates) == 0 {
+		t.Fatalf("unexpected result: %v %v", res, err)
+	}
+	for _, desc := range res.Templates {
+		if desc.OsId != osID || desc.Facets["os"] == nil {
+			t.Errorf("unexpected description: %v", desc)
+		}
+	}
+}
+
+func TestGetTemplate(t *testing.T) {
+	_, templates, conn, cleanup := setupServer(t)
+	defer cleanup()
+	client := grpcapi.NewTemplateIndexerClient(conn)
+
+	res, err := client.GetTemplate(context.Background(), &grpcapi.GetTemplateRequest{
+		Namespace: "openshift",
+		Name:      templates[1].Name,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Description.Summary.Id != templates[1].Name {
+		t.Errorf("unexpected description: %v", res.Description)
+	}
+	tmpl, err := res.DecodeTemplate()
+	if err != nil || tmpl.Name != templates[1].Name || len(tmpl.Objects) != len(templates[1].Objects) {
+		t.Errorf("unexpected template: %v %v", tmpl.Name, err)
+	}
+
+	_, err = client.GetTemplate(context.Background(), &grpcapi.GetTemplateRequest{
+		Namespace: "openshift",
+		Name:      templates[0].Name,
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	_, _, conn, cleanup := setupServer(t)
+	defer cleanup()
+	client := grpcapi.NewTemplateIndexerClient(conn)
+
+	res, err := client.Summarize(context.Background(), &grpcapi.SummarizeRequest{
+		Ledger: "size",
+		Counts: true,
+	})
+	if err != nil || len(res.Summaries) == 0 {
+		t.Fatalf("unexpected result: %v %v", res, err)
+	}
+	for _, summary := range res.Summaries {
+		if summary.Count == 0 {
+			t.Errorf("unexpected summary: %v", summary)
+		}
+	}
+
+	_, err = client.Summarize(context.Background(), &grpcapi.SummarizeRequest{Ledger: "bogus"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ti, templates, conn, cleanup := setupServer(t)
+	defer cleanup()
+	client := grpcapi.NewTemplateIndexerClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := client.Watch(ctx, &grpcapi.WatchRequest{InitialTemplates: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 1; i < len(templates); i++ {
+		ev, err := stream.Recv()
+		if err != nil || ev.Type != grpcapi.WatchEvent_ADDED || ev.Namespace != "openshift" {
+			t.Fatalf("unexpected initial event: %v %v", ev, err)
+		}
+	}
+
+	ti.Set(&templates[0])
+	updated := templates[0].DeepCopy()
+	updated.ResourceVersion = "2"
+	ti.Set(updated)
+	ti.Delete("openshift", templates[0].Name)
+
+	for _, eventType := range []grpcapi.WatchEvent_Type{grpcapi.WatchEvent_ADDED, grpcapi.WatchEvent_MODIFIED, grpcapi.WatchEvent_DELETED} {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ev.Type != eventType || ev.Name != templates[0].Name || ev.Description.Summary.Id != templates[0].Name {
+			t.Errorf("unexpected event: %v expected %v", ev, eventType)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	_, _, conn, cleanup := setupServer(t)
+	defer cleanup()
+
+	res, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: ServiceName})
+	if err != nil || res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("unexpected health: %v %v", res, err)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// the encodings supported, the preferred first
+var contentEncodings = []string{"br", "gzip"}
+
+// Compress wraps inner, compressing the responses with the best encoding allowed by the Accept-Encoding header
+func Compress(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		w.Header().Add("Vary", "Accept-Encoding")
+		if encoding == "" {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		var compressor io.WriteCloser
+		if encoding == "br" {
+			compressor = brotli.NewWriterLevel(w, brotli.DefaultCompression)
+		} else {
+			compressor = gzip.NewWriter(w)
+		}
+		cw := &compressedWriter{ResponseWriter: w, compressor: compressor, encoding: encoding}
+		defer cw.Close()
+		inner.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding returns the preferred encoding among the ones with the highest quality, or "" for none
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		coding, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		qualities[coding] = quality
+	}
+
+	best := ""
+	bestQuality := 0.0
+	for _, encoding := range contentEncodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressedWriter compresses the body, unless the handler already encoded it or validates it with a strong ETag
+type compressedWriter struct {
+	http.ResponseWriter
+	compressor  io.WriteCloser
+	encoding    string
+	wroteHeader bool
+	passthrough bool
+}
+
+func (cw *compressedWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || status == http.StatusNoContent || status == http.StatusNotModified ||
+		hasStrongETag(header) {
+		cw.passthrough = true
+	} else {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// hasStrongETag tells if the response carries a strong entity tag: it validates the exact bytes of the body,
+// so the body must not be compressed with the same tag (RFC 7232, section 2.1)
+func hasStrongETag(header http.Header) bool {
+	etag := header.Get("ETag")
+	return etag != "" && !strings.HasPrefix(etag, "W/")
+}
+
+func (cw *compressedWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(data)
+	}
+	return cw.compressor.Write(data)
+}
+
+// Close flushes the compressed data. Nothing is written if the handler wrote nothing.
+func (cw *compressedWriter) Close() error {
+	if !cw.wroteHeader || cw.passthrough {
+		return nil
+	}
+	return cw.compressor.Close()
+}
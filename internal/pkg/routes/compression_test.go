@@ -0,0 +1,126 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+var compressTestBody = strings.Repeat(`{"name": "fedora-generic-large", "os": "fedora28"}`, 100)
+
+func TestCompress(t *testing.T) {
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "123")
+		io.WriteString(w, compressTestBody)
+	}))
+	for _, tc := range []struct {
+		acceptEncoding string
+		encoding       string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"", "", nil},
+		{"gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"gzip, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	} {
+		req := httptest.NewRequest("GET", "/templates", nil)
+		req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if encoding := rec.Header().Get("Content-Encoding"); encoding != tc.encoding {
+			t.Errorf("%q: unexpected encoding: %q", tc.acceptEncoding, encoding)
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%q: unexpected Vary: %q", tc.acceptEncoding, rec.Header().Get("Vary"))
+		}
+		var body io.Reader = rec.Body
+		if tc.decode != nil {
+			if rec.Header().Get("Content-Length") != "" {
+				t.Errorf("%q: Content-Length of the uncompressed body kept", tc.acceptEncoding)
+			}
+			if rec.Body.Len() >= len(compressTestBody) {
+				t.Errorf("%q: body not compressed: %v bytes", tc.acceptEncoding, rec.Body.Len())
+			}
+			var err error
+			if body, err = tc.decode(rec.Body); err != nil {
+				t.Fatalf("%q: unexpected error: %v", tc.acceptEncoding, err)
+			}
+		}
+		data, err := ioutil.ReadAll(body)
+		if err != nil || string(data) != compressTestBody {
+			t.Errorf("%q: unexpected body: %q %v", tc.acceptEncoding, data, err)
+		}
+	}
+}
+
+func TestCompressPassthrough(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"no content", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}, ""},
+		{"not modified", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotModified)
+		}, ""},
+		{"already encoded", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "deflate")
+			io.WriteString(w, "deflated")
+		}, "deflated"},
+		{"strong ETag", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"abc"`)
+			io.WriteString(w, "<svg/>")
+		}, "<svg/>"},
+		{"nothing written", func(w http.ResponseWriter, r *http.Request) {}, ""},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		Compress(tc.handler).ServeHTTP(rec, req)
+
+		if encoding := rec.Header().Get("Content-Encoding"); encoding == "gzip" {
+			t.Errorf("%s: unexpectedly compressed", tc.name)
+		}
+		if rec.Body.String() != tc.body {
+			t.Errorf("%s: unexpected body: %q", tc.name, rec.Body.String())
+		}
+	}
+
+	// the weak ETags do not forbid the compression
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `W/"abc"`)
+		io.WriteString(w, compressTestBody)
+	})).ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("response with weak ETag not compressed")
+	}
+}
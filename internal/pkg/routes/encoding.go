@@ -0,0 +1,329 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// format is a representation of the responses
+type format struct {
+	contentType string
+	// the media types requesting this format
+	mediaTypes []string
+	encode     func(w io.Writer, value interface{}) error
+}
+
+// formats are the representations the clients can request with the Accept header, the default first
+var formats = []format{
+	{
+		contentType: "application/json; charset=UTF-8",
+		mediaTypes:  []string{"application/json", "application/*", "*/*"},
+		encode: func(w io.Writer, value interface{}) error {
+			return json.NewEncoder(w).Encode(value)
+		},
+	},
+	{
+		contentType: "application/yaml; charset=UTF-8",
+		mediaTypes:  []string{"application/yaml", "application/x-yaml", "text/yaml"},
+		encode:      encodeYAML,
+	},
+	{
+		contentType: "application/cbor",
+		mediaTypes:  []string{"application/cbor"},
+		encode:      encodeCBOR,
+	},
+	{
+		contentType: "text/csv; charset=UTF-8",
+		mediaTypes:  []string{"text/csv", "text/*"},
+		encode:      encodeCSV,
+	},
+}
+
+// respond writes the value, converted to the API version of the request, in the format requested by the Accept header,
+// JSON by default
+func respond(w http.ResponseWriter, r *http.Request, status int, value interface{}) {
+	f, ok := negotiateFormat(r.Header.Get("Accept"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported media types: %s", r.Header.Get("Accept")), http.StatusNotAcceptable)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	err := f.encode(buf, requestVersion(r).convert(value))
+	if err != nil {
+		panic(err)
+	}
+
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		panic(err)
+	}
+}
+
+// negotiateFormat picks the format with the highest quality in the Accept header.
+// On ties, the explicit media types win over the wildcards, then the first one wins.
+func negotiateFormat(accept string) (*format, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return &formats[0], true
+	}
+
+	var best *format
+	bestQuality := 0.0
+	bestWildcard := false
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		wildcard := strings.HasSuffix(mediaType, "/*")
+		if quality < bestQuality || (quality == bestQuality && (best == nil || wildcard || !bestWildcard)) {
+			continue
+		}
+		if f := lookupFormat(mediaType); f != nil {
+			best, bestQuality, bestWildcard = f, quality, wildcard
+		}
+	}
+	return best, best != nil
+}
+
+func lookupFormat(mediaType string) *format {
+	for i := range formats {
+		for _, mt := range formats[i].mediaTypes {
+			if mt == mediaType {
+				return &formats[i]
+			}
+		}
+	}
+	return nil
+}
+
+// genericValue turns the value in what its JSON representation decodes to:
+// maps, slices, strings, json.Numbers, bools and nils
+func genericValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&generic)
+	return generic, err
+}
+
+func encodeYAML(w io.Writer, value interface{}) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// encodeCSV writes a row for each item if the value is a list, a single row otherwise.
+// The columns are the sorted keys of the objects; the nested values are in JSON.
+func encodeCSV(w io.Writer, value interface{}) error {
+	generic, err := genericValue(value)
+	if err != nil {
+		return err
+	}
+	items, ok := generic.([]interface{})
+	if !ok {
+		items = []interface{}{generic}
+	}
+
+	columns := []string{}
+	seen := make(map[string]bool)
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			obj = map[string]interface{}{"value": item}
+		}
+		for key := range obj {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			obj = map[string]interface{}{"value": item}
+		}
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i], err = csvCell(obj[column])
+			if err != nil {
+				return err
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvCell(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// CBOR major types (RFC 7049)
+const (
+	cborUnsigned = 0 << 5
+	cborNegative = 1 << 5
+	cborString   = 3 << 5
+	cborArray    = 4 << 5
+	cborMap      = 5 << 5
+	cborFalse    = 0xf4
+	cborTrue     = 0xf5
+	cborNull     = 0xf6
+	cborFloat64  = 0xfb
+)
+
+// encodeCBOR writes the JSON data model of the value as CBOR. The map keys are sorted, so the output is stable.
+func encodeCBOR(w io.Writer, value interface{}) error {
+	generic, err := genericValue(value)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := writeCBOR(buf, generic); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func writeCBOR(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(cborNull)
+	case bool:
+		if v {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case string:
+		writeCBORHead(buf, cborString, uint64(len(v)))
+		buf.WriteString(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			if n >= 0 {
+				writeCBORHead(buf, cborUnsigned, uint64(n))
+			} else {
+				writeCBORHead(buf, cborNegative, uint64(-1-n))
+			}
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(cborFloat64)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := writeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		writeCBORHead(buf, cborMap, uint64(len(v)))
+		for _, key := range keys {
+			writeCBORHead(buf, cborString, uint64(len(key)))
+			buf.WriteString(key)
+			if err := writeCBOR(buf, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %T as CBOR", value)
+	}
+	return nil
+}
+
+// writeCBORHead writes the major type with its argument, in the shortest form
+func writeCBORHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
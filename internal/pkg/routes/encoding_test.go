@@ -0,0 +1,189 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+	}{
+		{"", "application/json; charset=UTF-8"},
+		{"application/json", "application/json; charset=UTF-8"},
+		{"*/*", "application/json; charset=UTF-8"},
+		{"application/yaml", "application/yaml; charset=UTF-8"},
+		{"text/*", "text/csv; charset=UTF-8"},
+		// the highest quality wins
+		{"text/csv;q=0.5, application/cbor", "application/cbor"},
+		{"*/*;q=0.1, text/csv", "text/csv; charset=UTF-8"},
+		// on ties, the explicit media types win over the wildcards, then the first one wins
+		{"application/*, application/yaml", "application/yaml; charset=UTF-8"},
+		{"application/yaml, application/cbor", "application/yaml; charset=UTF-8"},
+		{"application/cbor;q=0.8, text/*;q=0.8, application/yaml;q=0.8", "application/cbor"},
+		// the invalid items are ignored
+		{"bogus/;;, application/cbor", "application/cbor"},
+		{"application/yaml;q=high, text/csv", "text/csv; charset=UTF-8"},
+		// unsupported or refused
+		{"image/png", ""},
+		{"application/json;q=0", ""},
+		{"text/html, application/xml;q=0.9", ""},
+	} {
+		f, ok := negotiateFormat(tc.accept)
+		if tc.contentType == "" {
+			if ok {
+				t.Errorf("%q: unexpected format %v", tc.accept, f.contentType)
+			}
+			continue
+		}
+		if !ok || f.contentType != tc.contentType {
+			t.Errorf("%q: expected=%v received=%v", tc.accept, tc.contentType, f)
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"deflate", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"*", "br"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"br;q=0, *", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip;q=bad, br;q=0.1", "br"},
+	} {
+		if encoding := negotiateEncoding(tc.acceptEncoding); encoding != tc.encoding {
+			t.Errorf("%q: expected=%q received=%q", tc.acceptEncoding, tc.encoding, encoding)
+		}
+	}
+}
+
+// the examples of the appendix A of RFC 7049
+func TestEncodeCBOR(t *testing.T) {
+	many := []int{}
+	for i := 1; i <= 25; i++ {
+		many = append(many, i)
+	}
+	for _, tc := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{0, "00"},
+		{1, "01"},
+		{10, "0a"},
+		{23, "17"},
+		{24, "1818"},
+		{25, "1819"},
+		{100, "1864"},
+		{1000, "1903e8"},
+		{1000000, "1a000f4240"},
+		{1000000000000, "1b000000e8d4a51000"},
+		{-1, "20"},
+		{-10, "29"},
+		{-100, "3863"},
+		{-1000, "3903e7"},
+		{1.1, "fb3ff199999999999a"},
+		{-4.1, "fbc010666666666666"},
+		{1.0e+300, "fb7e37e43c8800759c"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{"", "60"},
+		{"a", "6161"},
+		{"IETF", "6449455446"},
+		{"\"\\", "62225c"},
+		{"ü", "62c3bc"},
+		{"水", "63e6b0b4"},
+		{[]int{}, "80"},
+		{[]int{1, 2, 3}, "83010203"},
+		{[]interface{}{1, []int{2, 3}, []int{4, 5}}, "8301820203820405"},
+		{many, "98190102030405060708090a0b0c0d0e0f101112131415161718181819"},
+		{map[string]int{}, "a0"},
+		{map[string]interface{}{"a": 1, "b": []int{2, 3}}, "a26161016162820203"},
+		{[]interface{}{"a", map[string]string{"b": "c"}}, "826161a161626163"},
+		{map[string]string{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"}, "a56161614161626142616361436164614461656145"},
+		// structs are encoded as their JSON representation
+		{struct {
+			Name  string `json:"name"`
+			Count int    `json:"count,omitempty"`
+		}{Name: "a"}, "a1646e616d656161"},
+	} {
+		buf := &bytes.Buffer{}
+		if err := encodeCBOR(buf, tc.value); err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.value, err)
+			continue
+		}
+		if received := hex.EncodeToString(buf.Bytes()); received != tc.expected {
+			t.Errorf("%v: expected=%v received=%v", tc.value, tc.expected, received)
+		}
+	}
+}
+
+func TestEncodeCSV(t *testing.T) {
+	for _, tc := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{
+			[]map[string]interface{}{
+				{"name": "fedora", "count": 2},
+				{"name": "centos, el7", "tags": []string{"a", "b"}, "deprecated": true},
+			},
+			"count,deprecated,name,tags\n" +
+				"2,,fedora,\n" +
+				",true,\"centos, el7\",\"[\"\"a\"\",\"\"b\"\"]\"\n",
+		},
+		{
+			map[string]interface{}{"id": "fedora", "os": map[string]string{"id": "fedora28"}},
+			"id,os\nfedora,\"{\"\"id\"\":\"\"fedora28\"\"}\"\n",
+		},
+		{
+			[]string{"a", "b"},
+			"value\na\nb\n",
+		},
+		{
+			[]interface{}{1.5, nil, map[string]int{"n": 1}},
+			"n,value\n,1.5\n,\n1,\n",
+		},
+		{
+			[]string{},
+			"\n",
+		},
+	} {
+		buf := &bytes.Buffer{}
+		if err := encodeCSV(buf, tc.value); err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.value, err)
+			continue
+		}
+		if buf.String() != tc.expected {
+			t.Errorf("%v: expected=%q received=%q", tc.value, tc.expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,568 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+const (
+	// the deepest selection a query may have; the introspection queries of the tools go 13 levels deep
+	maxGraphQLDepth = 15
+	// how many fields a query may select, counting each alias and each expansion of the fragments
+	maxGraphQLFields = 500
+)
+
+// graphQLSchema is built on the first query, once the ledgers are known
+type graphQLSchema struct {
+	once   sync.Once
+	schema graphql.Schema
+	err    error
+}
+
+// gqlSchema is reset by NewRouter
+var gqlSchema = &graphQLSchema{}
+
+func (gs *graphQLSchema) get() (graphql.Schema, error) {
+	gs.once.Do(func() {
+		gs.schema, gs.err = newGraphQLSchema(index.LedgerNames())
+	})
+	return gs.schema, gs.err
+}
+
+// graphQLRequest is the body of the POST requests, or the query parameters of the GET ones
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLQuery holds what the resolvers of a query share
+type graphQLQuery struct {
+	view  *templateindex.View
+	langs []string
+	// the options hiding the templates the caller cannot see
+	visible templateindex.FilterOptions
+}
+
+type graphQLContextKey struct{}
+
+func queryOf(p graphql.ResolveParams) *graphQLQuery {
+	return p.Context.Value(graphQLContextKey{}).(*graphQLQuery)
+}
+
+// summaryNode is an entry of a ledger, with the options selecting it, to resolve its templates
+type summaryNode struct {
+	templateindex.Summary
+	ledger string
+	opts   templateindex.FilterOptions
+}
+
+// graphQL answers the queries on the templates. The whole query is resolved holding the read lock of the index once.
+func graphQL(w http.ResponseWriter, r *http.Request) {
+	req := graphQLRequest{}
+	if r.Method == "POST" {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, fmt.Sprintf("invalid variables: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if req.Query == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	if err := checkGraphQLComplexity(req.Query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	schema, err := gqlSchema.get()
+	if err != nil {
+		panic(err)
+	}
+	visible, ok := visibleOptions(w, r, templateindex.FilterOptions{})
+	if !ok {
+		return
+	}
+
+	var result *graphql.Result
+	index.View(func(v *templateindex.View) error {
+		q := &graphQLQuery{
+			view:    v,
+			langs:   templateindex.LanguagesFromRequest(r),
+			visible: visible,
+		}
+		result = graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			OperationName:  req.OperationName,
+			VariableValues: req.Variables,
+			Context:        context.WithValue(r.Context(), graphQLContextKey{}, q),
+		})
+		return nil
+	})
+
+	respond(w, r, http.StatusOK, result)
+}
+
+// checkGraphQLComplexity rejects the queries too deep, selecting too many fields or with cycles of fragments,
+// before they run holding the read lock of the index: nothing can interrupt them once they started.
+// The queries which do not parse are left to graphql.Do, which reports the errors.
+func checkGraphQLComplexity(query string) error {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return nil
+	}
+	m := &graphQLMeter{
+		fragments: make(map[string]*ast.SelectionSet),
+		expanding: make(map[string]bool),
+	}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok && fragment.Name != nil {
+			m.fragments[fragment.Name.Value] = fragment.SelectionSet
+		}
+	}
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			if err := m.measure(op.SelectionSet, 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// graphQLMeter measures the selections of a query, expanding the fragments
+type graphQLMeter struct {
+	fragments map[string]*ast.SelectionSet
+	// the fragments being expanded, to reject the cycles: the validation of graphql.Do overflows the stack on them
+	expanding map[string]bool
+	fields    int
+}
+
+func (m *graphQLMeter) measure(set *ast.SelectionSet, depth int) error {
+	if set == nil {
+		return nil
+	}
+	if depth > maxGraphQLDepth {
+		return fmt.Errorf("query too deep: more than %d levels", maxGraphQLDepth)
+	}
+	for _, selection := range set.Selections {
+		var err error
+		switch sel := selection.(type) {
+		case *ast.Field:
+			m.fields++
+			if m.fields > maxGraphQLFields {
+				return fmt.Errorf("query too complex: more than %d fields", maxGraphQLFields)
+			}
+			err = m.measure(sel.SelectionSet, depth+1)
+		case *ast.InlineFragment:
+			err = m.measure(sel.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			if sel.Name == nil {
+				continue
+			}
+			if m.expanding[sel.Name.Value] {
+				return fmt.Errorf("fragment %s spreads itself", sel.Name.Value)
+			}
+			m.expanding[sel.Name.Value] = true
+			err = m.measure(m.fragments[sel.Name.Value], depth)
+			m.expanding[sel.Name.Value] = false
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var invalidGraphQLNameRE = regexp.MustCompile(`[^_0-9A-Za-z]`)
+
+// graphQLName turns the name of a ledger in a valid GraphQL name
+func graphQLName(name string) string {
+	name = invalidGraphQLNameRE.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// filterArgs are the arguments selecting the templates: the names of the ledgers, and includeDeprecated
+func filterArgs(ledgers []string) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{
+		templateindex.IncludeDeprecatedOption: &graphql.ArgumentConfig{
+			Type:        graphql.Boolean,
+			Description: "include the deprecated templates",
+		},
+	}
+	for _, ledger := range ledgers {
+		args[graphQLName(ledger)] = &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: fmt.Sprintf("only the templates with this %s", ledger),
+		}
+	}
+	return args
+}
+
+// filterOptions turns the arguments back in the options, restricted to the templates visible to the caller
+func filterOptions(ledgers []string, args map[string]interface{}, visible templateindex.FilterOptions) templateindex.FilterOptions {
+	opts := templateindex.FilterOptions{}
+	for key, value := range visible {
+		opts[key] = value
+	}
+	for _, ledger := range ledgers {
+		if value, ok := args[graphQLName(ledger)].(string); ok && value != "" {
+			opts[ledger] = value
+		}
+	}
+	if include, ok := args[templateindex.IncludeDeprecatedOption].(bool); ok && include {
+		opts[templateindex.IncludeDeprecatedOption] = "true"
+	}
+	return opts
+}
+
+func stringField(description string, resolve func(interface{}) string) *graphql.Field {
+	return &graphql.Field{
+		Type:        graphql.String,
+		Description: description,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			if value := resolve(p.Source); value != "" {
+				return value, nil
+			}
+			return nil, nil
+		},
+	}
+}
+
+func newGraphQLSchema(ledgers []string) (graphql.Schema, error) {
+	templateType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Template",
+		Description: "A VM template",
+		Fields:      graphql.Fields{},
+	})
+
+	// the summaries of the templates by a ledger: OS, Workload and Size
+	summaryType := func(name, description, ledger string, extra graphql.Fields) *graphql.Object {
+		fields := graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*summaryNode).ID, nil
+				},
+			},
+			"name": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "display name",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*summaryNode).Name, nil
+				},
+			},
+			"count": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "how many templates have this " + ledger + "; null within a template",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if node := p.Source.(*summaryNode); node.opts != nil {
+						return node.Count, nil
+					}
+					return nil, nil
+				},
+			},
+			"templates": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(templateType))),
+				Description: "the templates with this " + ledger + ", matching the filters of the query; none within a template",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err := p.Context.Err(); err != nil {
+						return nil, err
+					}
+					node := p.Source.(*summaryNode)
+					if node.opts == nil {
+						return []*templateindex.DescribedTemplate{}, nil
+					}
+					opts := node.opts.Without(node.ledger)
+					opts[node.ledger] = node.ID
+					return queryOf(p).templates(opts), nil
+				},
+			},
+		}
+		for key, field := range extra {
+			fields[key] = field
+		}
+		return graphql.NewObject(graphql.ObjectConfig{
+			Name:        name,
+			Description: description,
+			Fields:      fields,
+		})
+	}
+
+	osInfo := func(resolve func(*templateindex.OSInfo) string) func(interface{}) string {
+		return func(source interface{}) string {
+			if info := source.(*summaryNode).OSInfo; info != nil {
+				return resolve(info)
+			}
+			return ""
+		}
+	}
+	osType := summaryType("OS", "An operating system", "os", graphql.Fields{
+		"vendor":      stringField("", osInfo(func(info *templateindex.OSInfo) string { return info.Vendor })),
+		"family":      stringField("", osInfo(func(info *templateindex.OSInfo) string { return info.Family })),
+		"distro":      stringField("", osInfo(func(info *templateindex.OSInfo) string { return info.Distro })),
+		"version":     stringField("", osInfo(func(info *templateindex.OSInfo) string { return info.Version })),
+		"releaseDate": stringField("", osInfo(func(info *templateindex.OSInfo) string { return info.ReleaseDate })),
+		"eolDate":     stringField("end of life", osInfo(func(info *templateindex.OSInfo) string { return info.EOLDate })),
+	})
+	workloadType := summaryType("Workload", "A kind of workload", "workload", nil)
+	sizeType := summaryType("Size", "A size (flavor) of VM", "size", nil)
+
+	parameterType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Parameter",
+		Description: "A parameter of a template",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(templatev1.Parameter).Name, nil
+				},
+			},
+			"displayName": stringField("", func(source interface{}) string { return source.(templatev1.Parameter).DisplayName }),
+			"description": stringField("", func(source interface{}) string { return source.(templatev1.Parameter).Description }),
+			"value":       stringField("default value", func(source interface{}) string { return source.(templatev1.Parameter).Value }),
+			"generate":    stringField("generator of the value, like \"expression\"", func(source interface{}) string { return source.(templatev1.Parameter).Generate }),
+			"from":        stringField("input of the generator", func(source interface{}) string { return source.(templatev1.Parameter).From }),
+			"required": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(templatev1.Parameter).Required, nil
+				},
+			},
+		},
+	})
+
+	resourcesType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "VMResources",
+		Description: "The resources requested by the VM of a template",
+		Fields: graphql.Fields{
+			"cores": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(templateindex.Requirements).Cores, nil
+				},
+			},
+			"memory": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Float),
+				Description: "bytes",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return float64(p.Source.(templateindex.Requirements).Memory), nil
+				},
+			},
+		},
+	})
+
+	described := func(source interface{}) *templateindex.DescribedTemplate {
+		return source.(*templateindex.DescribedTemplate)
+	}
+	// the summary of a value of the template
+	templateSummary := func(summaryType *graphql.Object, ledger string, value func(*templateindex.DescribedTemplate) string) *graphql.Field {
+		return &graphql.Field{
+			Type: summaryType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				dt := described(p.Source)
+				summary, ok := queryOf(p).view.Summary(ledger, value(dt), dt.Template, queryOf(p).langs...)
+				if !ok {
+					return nil, nil
+				}
+				return &summaryNode{Summary: summary, ledger: ledger}, nil
+			},
+		}
+	}
+	templateFields := graphql.Fields{
+		"namespace": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return described(p.Source).Template.Namespace, nil
+			},
+		},
+		"name": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return described(p.Source).Template.Name, nil
+			},
+		},
+		"displayName":  stringField("", func(source interface{}) string { return described(source).Name }),
+		"description":  stringField("", func(source interface{}) string { return described(source).Description.Description }),
+		"iconId":       stringField("CSS class of the icon", func(source interface{}) string { return described(source).Icon }),
+		"iconURL":      stringField("path of the icon in the HTTP API; empty if it has none", func(source interface{}) string { return described(source).IconURL }),
+		"version":      stringField("version of the schema of the template", func(source interface{}) string { return described(source).Version }),
+		"vmApiVersion": stringField("API version of the VM object", func(source interface{}) string { return described(source).VMAPIVersion }),
+		"replacedBy":   stringField("", func(source interface{}) string { return described(source).ReplacedBy }),
+		"endOfSupport": stringField("", func(source interface{}) string { return described(source).EndOfSupport }),
+		"deprecated": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return described(p.Source).Deprecated, nil
+			},
+		},
+		"os": templateSummary(osType, "os", func(dt *templateindex.DescribedTemplate) string { return dt.OS }),
+		"workload": templateSummary(workloadType, "workload", func(dt *templateindex.DescribedTemplate) string {
+			return dt.Workload
+		}),
+		"size": templateSummary(sizeType, "size", func(dt *templateindex.DescribedTemplate) string { return dt.Size }),
+		"parameters": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(parameterType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return described(p.Source).Template.Parameters, nil
+			},
+		},
+		"resources": &graphql.Field{
+			Type:        resourcesType,
+			Description: "null if the template creates no VM",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if res, ok := templateindex.VMResources(described(p.Source).Template); ok {
+					return res, nil
+				}
+				return nil, nil
+			},
+		},
+	}
+	for name, field := range templateFields {
+		templateType.AddFieldConfig(name, field)
+	}
+
+	summariesField := func(summaryType *graphql.Object, ledger string) *graphql.Field {
+		return &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(summaryType))),
+			Args:        filterArgs(ledgers),
+			Description: fmt.Sprintf("the values of %s of the templates matching the filters", ledger),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if err := p.Context.Err(); err != nil {
+					return nil, err
+				}
+				q := queryOf(p)
+				opts := filterOptions(ledgers, p.Args, q.visible)
+				summaries, err := q.view.Summarize(ledger, opts, true, q.langs...)
+				if err != nil {
+					return nil, err
+				}
+				res := []*summaryNode{}
+				for _, summary := range summaries {
+					res = append(res, &summaryNode{Summary: summary, ledger: ledger, opts: opts})
+				}
+				return res, nil
+			},
+		}
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"templates": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(templateType))),
+				Args:        filterArgs(ledgers),
+				Description: "the templates matching the filters",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					// the request timed out, or the client went away: stop holding the index
+					if err := p.Context.Err(); err != nil {
+						return nil, err
+					}
+					q := queryOf(p)
+					return q.templates(filterOptions(ledgers, p.Args, q.visible)), nil
+				},
+			},
+			"template": &graphql.Field{
+				Type: templateType,
+				Args: graphql.FieldConfigArgument{
+					"namespace": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"name":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					q := queryOf(p)
+					namespace, name := p.Args["namespace"].(string), p.Args["name"].(string)
+					if !q.visibleNamespace(namespace) {
+						return nil, nil
+					}
+					dt, ok := q.view.Template(namespace, name, q.langs...)
+					if !ok {
+						return nil, nil
+					}
+					return &dt, nil
+				},
+			},
+			"oses":      summariesField(osType, "os"),
+			"workloads": summariesField(workloadType, "workload"),
+			"sizes":     summariesField(sizeType, "size"),
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// templates returns the templates matching opts, as pointers, like the fields of Template expect
+func (q *graphQLQuery) templates(opts templateindex.FilterOptions) []*templateindex.DescribedTemplate {
+	res := []*templateindex.DescribedTemplate{}
+	for _, dt := range q.view.Templates(opts, q.langs...) {
+		dt := dt
+		res = append(res, &dt)
+	}
+	return res
+}
+
+// visibleNamespace tells if the caller can see the templates of the namespace
+func (q *graphQLQuery) visibleNamespace(namespace string) bool {
+	namespaces, ok := q.visible[templateindex.NamespacesOption]
+	if !ok {
+		return true
+	}
+	for _, ns := range strings.Split(namespaces, ",") {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
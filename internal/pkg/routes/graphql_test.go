@@ -0,0 +1,259 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+func setupGraphQL(t *testing.T) (*httptest.Server, []templatev1.Template) {
+	templates, err := testutils.LoadTemplates("../../../pkg/templateindex/test-data-alltemplates.yaml")
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	for i := range templates {
+		templates[i].Namespace = "openshift"
+	}
+
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", templateindex.NewOSLedger(templateindex.NewJSONLedger("os")))
+	ti.AddLedger("workload", templateindex.NewJSONLedger("workload"))
+	ti.AddLedger("size", templateindex.NewJSONLedger("flavor"))
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Fatalf("failed to add test templates! %v", err)
+	}
+	return httptest.NewServer(Handler(ti, logf.NullLogger{}, nil)), templates
+}
+
+type graphQLResult struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, server *httptest.Server, req graphQLRequest) graphQLResult {
+	body, _ := json.Marshal(req)
+	resp, err := http.Post(server.URL+"/graphql", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %v", resp.StatusCode)
+	}
+	res := graphQLResult{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return res
+}
+
+func TestGraphQLTemplates(t *testing.T) {
+	server, templates := setupGraphQL(t)
+	defer server.Close()
+
+	res := postGraphQL(t, server, graphQLRequest{
+		Query: `{ templates { namespace name os { id name count } size { id } parameters { name required } resources { cores memory } } }`,
+	})
+	if len(res.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", res.Errors)
+	}
+	items := res.Data["templates"].([]interface{})
+	if len(items) != len(templates) {
+		t.Fatalf("unexpected templates: %v expected %v", len(items), len(templates))
+	}
+	for _, item := range items {
+		tmpl := item.(map[string]interface{})
+		if tmpl["namespace"] != "openshift" {
+			t.Errorf("unexpected namespace: %v", tmpl["namespace"])
+		}
+		os, ok := tmpl["os"].(map[string]interface{})
+		if !ok || os["id"] == "" || os["count"] != nil {
+			t.Errorf("unexpected os of %v: %v", tmpl["name"], tmpl["os"])
+		}
+		if resources, ok := tmpl["resources"].(map[string]interface{}); !ok || resources["cores"].(float64) < 1 {
+			t.Errorf("unexpected resources of %v: %v", tmpl["name"], tmpl["resources"])
+		}
+		if len(tmpl["parameters"].([]interface{})) == 0 {
+			t.Errorf("unexpected parameters of %v", tmpl["name"])
+		}
+	}
+}
+
+func TestGraphQLNestedSummaries(t *testing.T) {
+	server, templates := setupGraphQL(t)
+	defer server.Close()
+
+	res := postGraphQL(t, server, graphQLRequest{
+		Query:     `query Sizes($workload: String) { sizes(workload: $workload) { id count templates { name workload { id } } } }`,
+		Variables: map[string]interface{}{"workload": "generic"},
+	})
+	if len(res.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", res.Errors)
+	}
+	sizes := res.Data["sizes"].([]interface{})
+	if len(sizes) == 0 {
+		t.Fatalf("no sizes")
+	}
+	total := 0
+	for _, item := range sizes {
+		size := item.(map[string]interface{})
+		nested := size["templates"].([]interface{})
+		if int(size["count"].(float64)) != len(nested) {
+			t.Errorf("size %v: count %v but %v templates", size["id"], size["count"], len(nested))
+		}
+		for _, tmpl := range nested {
+			if workload := tmpl.(map[string]interface{})["workload"].(map[string]interface{}); workload["id"] != "generic" {
+				t.Errorf("unexpected workload: %v", workload)
+			}
+		}
+		total += len(nested)
+	}
+	if total == 0 || total > len(templates) {
+		t.Errorf("unexpected templates: %v", total)
+	}
+}
+
+func TestGraphQLTemplate(t *testing.T) {
+	server, templates := setupGraphQL(t)
+	defer server.Close()
+
+	query := url.Values{}
+	query.Set("query", `query T($name: String!) { template(namespace: "openshift", name: $name) { name displayName } missing: template(namespace: "openshift", name: "missing") { name } }`)
+	query.Set("variables", `{"name": "`+templates[0].Name+`"}`)
+	resp, err := http.Get(server.URL + "/graphql?" + query.Encode())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	res := graphQLResult{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil || len(res.Errors) > 0 {
+		t.Fatalf("unexpected result: %v %v", res, err)
+	}
+	tmpl, ok := res.Data["template"].(map[string]interface{})
+	if !ok || tmpl["name"] != templates[0].Name || tmpl["displayName"] == "" {
+		t.Errorf("unexpected template: %v", res.Data["template"])
+	}
+	if res.Data["missing"] != nil {
+		t.Errorf("unexpected template: %v", res.Data["missing"])
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	server, _ := setupGraphQL(t)
+	defer server.Close()
+
+	res := postGraphQL(t, server, graphQLRequest{Query: `{ templates { bogus } }`})
+	if len(res.Errors) == 0 {
+		t.Errorf("unexpected success")
+	}
+
+	resp, err := http.Get(server.URL + "/graphql")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status: %v", resp.StatusCode)
+	}
+}
+
+func TestGraphQLComplexity(t *testing.T) {
+	server, _ := setupGraphQL(t)
+	defer server.Close()
+
+	aliases := []string{}
+	for i := 0; i < maxGraphQLFields/2+1; i++ {
+		aliases = append(aliases, fmt.Sprintf("t%d: templates { name }", i))
+	}
+	fragments := "fragment F0 on Template { name }"
+	for i := 1; i <= 10; i++ {
+		fragments += fmt.Sprintf(" fragment F%d on Template { ...F%d ...F%d }", i, i-1, i-1)
+	}
+	for _, query := range []string{
+		"{ templates" + strings.Repeat(" { os", maxGraphQLDepth) + strings.Repeat(" }", maxGraphQLDepth+1),
+		"{ " + strings.Join(aliases, " ") + " }",
+		"{ templates { ...F10 } } " + fragments,
+		// the validation of graphql-go overflows the stack on the cycles
+		"{ templates { ...A } } fragment A on Template { name ...B } fragment B on Template { ...A }",
+	} {
+		body, _ := json.Marshal(graphQLRequest{Query: query})
+		resp, err := http.Post(server.URL+"/graphql", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("unexpected status %v for %.80s", resp.StatusCode, query)
+		}
+	}
+
+	// the introspection queries of the tools are deep, but small
+	typeRef := "kind name" + strings.Repeat(" ofType { kind name", 7) + strings.Repeat(" }", 7)
+	res := postGraphQL(t, server, graphQLRequest{
+		Query: "{ __schema { types { name fields { name args { name type { " + typeRef + " } } type { " + typeRef + " } } } } }",
+	})
+	if len(res.Errors) > 0 || res.Data["__schema"] == nil {
+		t.Errorf("unexpected result: %v", res)
+	}
+}
+
+func TestGraphQLCanceled(t *testing.T) {
+	// only the index is needed
+	server, _ := setupGraphQL(t)
+	server.Close()
+
+	schema, err := newGraphQLSchema(index.LedgerNames())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var result *graphql.Result
+	index.View(func(v *templateindex.View) error {
+		result = graphql.Do(graphql.Params{
+			Schema:        schema,
+			RequestString: "{ templates { name } oses { templates { name } } }",
+			Context:       context.WithValue(ctx, graphQLContextKey{}, &graphQLQuery{view: v}),
+		})
+		return nil
+	})
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, context.Canceled.Error()) {
+		t.Errorf("unexpected result: %v", result)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer serves the gRPC requests on the port of the HTTP API; nil if they are not multiplexed
+var grpcServer *grpc.Server
+
+// MultiplexGRPC makes Serve and ServeTLS pass the gRPC requests to server, to serve both APIs on the same port.
+// Without TLS, the gRPC clients must use HTTP/2 with prior knowledge (h2c), as they do by default.
+// Must be called before Serve.
+func MultiplexGRPC(server *grpc.Server) {
+	grpcServer = server
+}
+
+// multiplex passes the gRPC requests to grpcServer, if set, and the others to inner.
+// The gRPC requests bypass the HTTP handler of the limits, which would break the streams:
+// the server applies them itself, using GRPCServerOptions.
+func multiplex(inner http.Handler) http.Handler {
+	if grpcServer == nil {
+		return inner
+	}
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
+
+// GRPCServerOptions return the options applying the limits set with SetLimits to a gRPC server,
+// sharing them with the HTTP API. The calls count against the rate of the client, by user if authenticated,
+// by IP otherwise. The unary calls also count against the requests in flight, and time out;
+// the streams don't, because the watches last as long as the clients want.
+func GRPCServerOptions() []grpc.ServerOption {
+	lm := sharedLimiter
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(lm.unaryInterceptor),
+		grpc.StreamInterceptor(lm.streamInterceptor),
+	}
+	if lm.opts.MaxBodyBytes > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(lm.opts.MaxBodyBytes)))
+	}
+	return opts
+}
+
+func (lm *limiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := lm.checkRate(ctx); err != nil {
+		return nil, err
+	}
+	if lm.inFlight != nil {
+		select {
+		case lm.inFlight <- struct{}{}:
+			defer func() { <-lm.inFlight }()
+		default:
+			requestsRejected.WithLabelValues(rejectedConcurrency).Inc()
+			return nil, resourceExhausted(ctx, time.Second)
+		}
+	}
+	if lm.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, lm.opts.Timeout)
+		defer cancel()
+	}
+
+	requestsInFlight.Inc()
+	defer requestsInFlight.Dec()
+	return handler(ctx, req)
+}
+
+func (lm *limiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := lm.checkRate(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// checkRate takes a token from the bucket of the client, returning the error to reply if there are none
+func (lm *limiter) checkRate(ctx context.Context) error {
+	if lm.opts.ClientRate <= 0 {
+		return nil
+	}
+	if delay := lm.reserve(grpcClientKey(ctx)); delay > 0 {
+		requestsRejected.WithLabelValues(rejectedRate).Inc()
+		return resourceExhausted(ctx, delay)
+	}
+	return nil
+}
+
+// grpcClientKey identifies the client like clientKey, using the bearer token in the "authorization" metadata.
+// Like clientKey, it never asks the API server.
+func grpcClientKey(ctx context.Context) string {
+	if authorizer != nil {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			if !strings.HasPrefix(value, "Bearer ") {
+				continue
+			}
+			if user, ok := authorizer.CachedUser(strings.TrimPrefix(value, "Bearer ")); ok {
+				return "user:" + user.Name
+			}
+		}
+	}
+	host := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host = p.Addr.String()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	return "ip:" + host
+}
+
+// resourceExhausted is the gRPC version of tooManyRequests: the "retry-after" metadata has the seconds to wait
+func resourceExhausted(ctx context.Context, delay time.Duration) error {
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(delay.Seconds())))))
+	return status.Error(codes.ResourceExhausted, fmt.Sprintf("too many requests, retry in %v", delay.Round(time.Millisecond)))
+}
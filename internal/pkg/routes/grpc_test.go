@@ -0,0 +1,76 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCLimits(t *testing.T) {
+	lm := newLimiter(LimitOptions{ClientRate: 1, ClientBurst: 1, MaxInFlight: 1})
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+	other := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1234}})
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Call"}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	if _, err := lm.unaryInterceptor(ctx, nil, info, ok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := lm.unaryInterceptor(ctx, nil, info, ok)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("rate not limited: %v", err)
+	}
+
+	// the call in flight takes the only slot
+	busy := func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, err := lm.unaryInterceptor(other, nil, info, ok)
+		return nil, err
+	}
+	third := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 1234}})
+	_, err = lm.unaryInterceptor(third, nil, info, busy)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("concurrency not limited: %v", err)
+	}
+}
+
+func TestGRPCClientKey(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+	if key := grpcClientKey(ctx); key != "ip:10.0.0.1" {
+		t.Errorf("unexpected key: %v", key)
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/api/v1/templates", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("Authorization", "Bearer random-token")
+	if key := clientKey(r); key != "ip:10.0.0.1" {
+		t.Errorf("unexpected key: %v", key)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// the icons embedded in the templates never change: their IDs come from their content
+	immutableIconCacheControl = "public, max-age=31536000, immutable"
+	// the icons of the classes may be updated, and must be revalidated with their ETag
+	iconCacheControl = "public, max-age=3600"
+)
+
+// IconsPath returns the path prefixing the IDs of the icons, under the newest API version
+func IconsPath() string {
+	return apiVersions[len(apiVersions)-1].Prefix() + "/icons/"
+}
+
+// icon serves the image itself, so it ignores the format negotiation of the other routes.
+// Its strong ETag keeps Compress from encoding it: the PNG are compressed already, and the SVG are small.
+func icon(w http.ResponseWriter, r *http.Request) {
+	ic, ok := index.Icon(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "icon not found", http.StatusNotFound)
+		return
+	}
+
+	header := w.Header()
+	header.Set("ETag", ic.ETag)
+	if ic.Immutable() {
+		header.Set("Cache-Control", immutableIconCacheControl)
+	} else {
+		header.Set("Cache-Control", iconCacheControl)
+	}
+	if !ic.ModTime.IsZero() {
+		header.Set("Last-Modified", ic.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), ic.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Type", ic.ContentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	// the SVG may carry scripts: never run them, even if the icon is opened directly
+	header.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(ic.Data)
+	}
+}
+
+// etagMatches tells if the If-None-Match header lists the entity tag, comparing them weakly
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1"/>`
+
+func TestIconNotCompressed(t *testing.T) {
+	templates, err := testutils.LoadTemplates("../../../pkg/templateindex/test-data-alltemplates.yaml")
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	dataURL := "data:image/svg+xml," + testSVG
+	icon, err := templateindex.ParseDataIcon(dataURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if templates[0].Annotations == nil {
+		templates[0].Annotations = make(map[string]string)
+	}
+	templates[0].Annotations[templateindex.IconDataAnnotation] = dataURL
+
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	if _, err := ti.AddTemplates(templates); err != nil {
+		t.Fatalf("failed to add test templates! %v", err)
+	}
+	server := httptest.NewServer(Handler(ti, logf.NullLogger{}, nil))
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/icons/"+icon.ID, nil)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != testSVG {
+		t.Fatalf("unexpected response: %v %q", resp.StatusCode, body)
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+		t.Errorf("icon with strong ETag compressed with %q", encoding)
+	}
+	if etag := resp.Header.Get("ETag"); etag != icon.ETag {
+		t.Errorf("unexpected ETag: %q expected %q", etag, icon.ETag)
+	}
+
+	req.Header.Set("If-None-Match", icon.ETag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("unexpected status: %v", resp.StatusCode)
+	}
+}
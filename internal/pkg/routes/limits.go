@@ -0,0 +1,235 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// LimitOptions protect the indexer from the clients sending too many requests. Zero disables each limit.
+type LimitOptions struct {
+	// requests per second allowed to each client, identified by user once authenticated, by IP otherwise
+	ClientRate float64
+	// requests each client may send at once, above ClientRate
+	ClientBurst int
+	// requests served at the same time, from all the clients
+	MaxInFlight int
+	// how long a request may take
+	Timeout time.Duration
+	// size of the request body
+	MaxBodyBytes int64
+	// size of the request headers
+	MaxHeaderBytes int
+}
+
+var (
+	requestsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "template_indexer_http_requests_rejected_total",
+		Help: "Total number of HTTP requests rejected because of the limits",
+	}, []string{"reason"})
+	requestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "template_indexer_http_requests_in_flight",
+		Help: "Number of HTTP requests being served",
+	})
+	requestsTimedOut = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "template_indexer_http_requests_timed_out_total",
+		Help: "Total number of HTTP requests which took too long",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(requestsRejected, requestsInFlight, requestsTimedOut)
+}
+
+const (
+	rejectedRate        = "rate"
+	rejectedConcurrency = "concurrency"
+)
+
+// the idle clients are dropped once there are this many
+const clientsSweepSize = 1024
+
+var limits LimitOptions
+
+// sharedLimiter enforces the limits on both the HTTP and the gRPC API, so the clients can't double their share
+var sharedLimiter = newLimiter(LimitOptions{})
+
+// SetLimits configures the limits of the HTTP API, and of the gRPC one with GRPCServerOptions.
+// Must be called before Serve.
+func SetLimits(opts LimitOptions) {
+	limits = opts
+	sharedLimiter = newLimiter(opts)
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// limiter applies the LimitOptions to the requests
+type limiter struct {
+	opts     LimitOptions
+	now      func() time.Time
+	inFlight chan struct{}
+
+	lock    sync.Mutex
+	clients map[string]*clientLimiter
+}
+
+func newLimiter(opts LimitOptions) *limiter {
+	lm := &limiter{
+		opts:    opts,
+		now:     time.Now,
+		clients: make(map[string]*clientLimiter),
+	}
+	if opts.MaxInFlight > 0 {
+		lm.inFlight = make(chan struct{}, opts.MaxInFlight)
+	}
+	return lm
+}
+
+// Handler wraps inner, enforcing the limits
+func (lm *limiter) Handler(inner http.Handler) http.Handler {
+	if lm.opts.Timeout > 0 {
+		inner = lm.timeoutHandler(inner)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lm.opts.ClientRate > 0 {
+			if delay := lm.reserve(clientKey(r)); delay > 0 {
+				requestsRejected.WithLabelValues(rejectedRate).Inc()
+				tooManyRequests(w, delay)
+				return
+			}
+		}
+		if lm.inFlight != nil {
+			select {
+			case lm.inFlight <- struct{}{}:
+				defer func() { <-lm.inFlight }()
+			default:
+				requestsRejected.WithLabelValues(rejectedConcurrency).Inc()
+				tooManyRequests(w, time.Second)
+				return
+			}
+		}
+		if lm.opts.MaxBodyBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, lm.opts.MaxBodyBytes)
+		}
+
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// reserve takes a token from the bucket of the client, returning how long it must wait if there are none
+func (lm *limiter) reserve(key string) time.Duration {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	now := lm.now()
+	cl, ok := lm.clients[key]
+	if !ok {
+		if len(lm.clients) >= clientsSweepSize {
+			lm.sweep(now)
+		}
+		burst := lm.opts.ClientBurst
+		if burst < 1 {
+			burst = 1
+		}
+		cl = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(lm.opts.ClientRate), burst)}
+		lm.clients[key] = cl
+	}
+	cl.lastSeen = now
+
+	reservation := cl.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return time.Second
+	}
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		// we reject the request, so it must not consume the token
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+// sweep drops the clients idle long enough to have their bucket full again: they are like new ones.
+// Must be called with the lock held.
+func (lm *limiter) sweep(now time.Time) {
+	refill := time.Duration(float64(lm.opts.ClientBurst+1) / lm.opts.ClientRate * float64(time.Second))
+	for key, cl := range lm.clients {
+		if now.Sub(cl.lastSeen) >= refill {
+			delete(lm.clients, key)
+		}
+	}
+}
+
+func (lm *limiter) timeoutHandler(inner http.Handler) http.Handler {
+	timeout := http.TimeoutHandler(inner, lm.opts.Timeout, "request timed out")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		start := lm.now()
+		timeout.ServeHTTP(rec, r)
+		if rec.status == http.StatusServiceUnavailable && lm.now().Sub(start) >= lm.opts.Timeout {
+			requestsTimedOut.Inc()
+		}
+	})
+}
+
+// clientKey identifies the client: by user, if the authentication is enabled and the token already authenticated,
+// by IP otherwise. It never asks the API server: the new tokens are reviewed only once the request got past
+// the limit of its IP, so the clients can't flood the API server sending random tokens.
+func clientKey(r *http.Request) string {
+	if authorizer != nil {
+		if user, ok := authorizer.CachedRequestUser(r); ok {
+			return "user:" + user.Name
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func tooManyRequests(w http.ResponseWriter, delay time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	http.Error(w, fmt.Sprintf("too many requests, retry in %v", delay.Round(time.Millisecond)), http.StatusTooManyRequests)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
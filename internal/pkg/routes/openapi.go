@@ -0,0 +1,347 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+// OpenAPIVersion is the version of the API described by the OpenAPI document
+const OpenAPIVersion = "1.0.0"
+
+// RouteDoc describes a route in the OpenAPI document
+type RouteDoc struct {
+	Summary string
+	// the route accepts the filter options: the names of the ledgers, IncludeDeprecatedOption and "lang"
+	Filtered bool
+	// the query parameters, besides the filter options
+	Params []ParamDoc
+	// a value of the type of the response, which gives its schema. If nil, the response is plain text.
+	Response interface{}
+	// the media types of a binary response, like the images; they replace Response
+	MediaTypes []string
+	// the route is an alias kept for the old clients
+	Deprecated bool
+}
+
+// ParamDoc describes a query parameter
+type ParamDoc struct {
+	Name        string
+	Description string
+	// the JSON schema type: "string" if empty
+	Type     string
+	Required bool
+}
+
+var routePathParamRE = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// OpenAPI builds the OpenAPI 3 document describing the routes. The filter options are the names of the ledgers.
+func OpenAPI(rts Routes, ledgers []string) map[string]interface{} {
+	sg := &schemaGenerator{
+		schemas: make(map[string]interface{}),
+		names:   make(map[reflect.Type]string),
+	}
+
+	paths := make(map[string]interface{})
+	for _, route := range rts {
+		params := []interface{}{}
+		for _, match := range routePathParamRE.FindAllStringSubmatch(route.Pattern, -1) {
+			params = append(params, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		if route.Doc.Filtered {
+			for _, ledger := range ledgers {
+				params = append(params, queryParam(ParamDoc{
+					Name:        ledger,
+					Description: fmt.Sprintf("only the templates with this %s", ledger),
+				}))
+			}
+			params = append(params,
+				queryParam(ParamDoc{
+					Name:        templateindex.IncludeDeprecatedOption,
+					Description: "include the deprecated templates",
+					Type:        "boolean",
+				}),
+				queryParam(ParamDoc{
+					Name:        "lang",
+					Description: "language of the names and the descriptions, instead of the Accept-Language header",
+				}),
+			)
+		}
+		for _, param := range route.Doc.Params {
+			params = append(params, queryParam(param))
+		}
+
+		operation := map[string]interface{}{
+			"operationId": route.Name,
+			"parameters":  params,
+			"responses":   sg.responses(route.Doc),
+		}
+		if route.Doc.Summary != "" {
+			operation["summary"] = route.Doc.Summary
+		}
+		if route.Doc.Deprecated {
+			operation["deprecated"] = true
+		}
+
+		path := routePathParamRE.ReplaceAllString(route.Pattern, "{$1}")
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   "KubeVirt template indexer",
+			"version": OpenAPIVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": sg.schemas,
+		},
+	}
+}
+
+func queryParam(param ParamDoc) map[string]interface{} {
+	schemaType := param.Type
+	if schemaType == "" {
+		schemaType = "string"
+	}
+	doc := map[string]interface{}{
+		"name":   param.Name,
+		"in":     "query",
+		"schema": map[string]interface{}{"type": schemaType},
+	}
+	if param.Description != "" {
+		doc["description"] = param.Description
+	}
+	if param.Required {
+		doc["required"] = true
+	}
+	return doc
+}
+
+func errorResponse(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"text/plain": map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string"},
+			},
+		},
+	}
+}
+
+// schemaGenerator turns the Go types in JSON schemas, collecting the named structs as components
+type schemaGenerator struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+func (sg *schemaGenerator) responses(doc RouteDoc) map[string]interface{} {
+	responses := map[string]interface{}{
+		"400": errorResponse("invalid parameters"),
+		"401": errorResponse("missing or invalid bearer token, if the authentication is enabled"),
+		"404": errorResponse("not found"),
+		"406": errorResponse("none of the requested media types is supported"),
+		"429": errorResponse("too many requests: retry after the seconds in the Retry-After header"),
+	}
+	if len(doc.MediaTypes) > 0 {
+		content := make(map[string]interface{})
+		for _, mediaType := range doc.MediaTypes {
+			content[mediaType] = map[string]interface{}{
+				"schema": map[string]interface{}{"type": "string", "format": "binary"},
+			}
+		}
+		responses["200"] = map[string]interface{}{
+			"description": "success",
+			"content":     content,
+		}
+		responses["304"] = map[string]interface{}{"description": "not modified since the entity tag in If-None-Match"}
+		return responses
+	}
+	if doc.Response == nil {
+		responses["200"] = errorResponse("success")
+		return responses
+	}
+
+	schema := sg.schemaOf(reflect.TypeOf(doc.Response))
+	content := make(map[string]interface{})
+	for _, f := range formats {
+		contentType := strings.Split(f.contentType, ";")[0]
+		content[contentType] = map[string]interface{}{"schema": schema}
+	}
+	responses["200"] = map[string]interface{}{
+		"description": "success",
+		"content":     content,
+	}
+	return responses
+}
+
+func (sg *schemaGenerator) schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if reflect.PtrTo(t).Implements(jsonMarshalerType) || t.Implements(jsonMarshalerType) {
+		// custom representation, like the raw objects of the templates
+		if t.ConvertibleTo(timeType) || strings.HasSuffix(t.Name(), "Time") {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		return map[string]interface{}{}
+	}
+	if reflect.PtrTo(t).Implements(textMarshalerType) || t.Implements(textMarshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// base64, like encoding/json does
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": sg.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": sg.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return sg.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + sg.componentName(t)}
+	}
+	// interface{}: anything
+	return map[string]interface{}{}
+}
+
+// componentName registers the struct as a component, returning its name, like "templateindex.Description"
+func (sg *schemaGenerator) componentName(t reflect.Type) string {
+	if name, ok := sg.names[t]; ok {
+		return name
+	}
+	pkg := t.PkgPath()
+	name := pkg[strings.LastIndex(pkg, "/")+1:] + "." + t.Name()
+	if _, taken := sg.schemas[name]; taken {
+		name = strings.NewReplacer("/", ".", "-", "_").Replace(pkg) + "." + t.Name()
+	}
+	sg.names[t] = name
+	// placeholder, for the recursive types
+	sg.schemas[name] = map[string]interface{}{}
+	sg.schemas[name] = sg.structSchema(t)
+	return name
+}
+
+// structSchema describes the struct like encoding/json encodes it: the embedded structs are flattened,
+// and the fields which are not "omitempty" are required
+func (sg *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	sg.addFields(t, properties, &required, false)
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the exported fields of the struct. If optional, none of them is required
+// (e.g. the fields of an embedded pointer, which may be nil).
+func (sg *schemaGenerator) addFields(t reflect.Type, properties map[string]interface{}, required *[]string, optional bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			embeddedOptional := optional
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+				embeddedOptional = true
+			}
+			if ft.Kind() == reflect.Struct {
+				sg.addFields(ft, properties, required, embeddedOptional)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		omitEmpty := false
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		properties[name] = sg.schemaOf(field.Type)
+		if !omitEmpty && !optional {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// openAPI serves the OpenAPI document of the routes of the API version requested
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, http.StatusOK, OpenAPI(documented[requestVersion(r).Name], index.LedgerNames()))
+}
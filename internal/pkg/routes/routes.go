@@ -1,14 +1,23 @@
 package routes
 
 import (
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/auth"
 	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
 )
 
@@ -17,6 +26,8 @@ type Route struct {
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// documents the route in the OpenAPI document
+	Doc RouteDoc
 }
 
 type Routes []Route
@@ -24,24 +35,62 @@ type Routes []Route
 var log logr.Logger
 var index *templateindex.TemplateIndexer
 
-func NewRouter() *mux.Router {
-	router := mux.NewRouter().StrictSlash(true)
-	for _, route := range routes {
-		var handler http.Handler
+// authorizer hides the templates the callers cannot see; nil if everything is visible to everyone
+var authorizer *auth.Authorizer
 
-		handler = route.HandlerFunc
-		handler = Logger(handler, route.Name)
+// documented are the routes served by each API version, described by its OpenAPI document
+var documented map[string]Routes
+
+// NewRouter returns the router of the HTTP API. The routes, and the extra ones, are served under the prefix
+// of each API version, and at the root as deprecated aliases of the legacy version.
+func NewRouter(extra Routes) *mux.Router {
+	router := mux.NewRouter().StrictSlash(true)
+	apiRoutes := append(append(Routes{}, routes...), extra...)
+	documented = make(map[string]Routes)
+	gqlSchema = &graphQLSchema{}
 
-		router.
-			Methods(route.Method).
-			Path(route.Pattern).
-			Name(route.Name).
-			Handler(handler)
+	for _, version := range apiVersions {
+		for _, route := range apiRoutes {
+			route.Name = version.Name + "/" + route.Name
+			route.Pattern = version.Prefix() + route.Pattern
+			addRoute(router, route, withVersion(route.HandlerFunc, version))
+			documented[version.Name] = append(documented[version.Name], versionedDoc(route, version))
+		}
+	}
+	for _, route := range apiRoutes {
+		addRoute(router, route, deprecated(withVersion(route.HandlerFunc, legacyVersion), legacyVersion.Prefix()))
+		route.Doc.Deprecated = true
+		documented[legacyVersion.Name] = append(documented[legacyVersion.Name], versionedDoc(route, legacyVersion))
+	}
+	for _, route := range operationalRoutes {
+		addRoute(router, route, route.HandlerFunc)
+		for _, version := range apiVersions {
+			documented[version.Name] = append(documented[version.Name], route)
+		}
 	}
 
 	return router
 }
 
+func addRoute(router *mux.Router, route Route, handler http.Handler) {
+	handler = Compress(handler)
+	handler = Logger(handler, route.Name)
+
+	router.
+		Methods(route.Method).
+		Path(route.Pattern).
+		Name(route.Name).
+		Handler(handler)
+}
+
+// versionedDoc returns the route documenting the responses of the given version
+func versionedDoc(route Route, version APIVersion) Route {
+	if route.Doc.Response != nil {
+		route.Doc.Response = version.convert(route.Doc.Response)
+	}
+	return route
+}
+
 func Logger(inner http.Handler, name string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -58,78 +107,487 @@ func Logger(inner http.Handler, name string) http.Handler {
 
 var routes = Routes{
 	Route{
-		"oses",
+		"templates",
 		"GET",
-		"/oses",
-		oses,
+		"/templates",
+		templates,
+		RouteDoc{
+			Summary:  "Describe the templates",
+			Filtered: true,
+			Response: []templateindex.Description{},
+		},
 	},
 	Route{
-		"workloads",
+		"template",
 		"GET",
-		"/workloads",
-		workloads,
+		"/templates/{namespace}/{name}",
+		template,
+		RouteDoc{
+			Summary: "Get the template",
+			Params: []ParamDoc{
+				{Name: "apiVersion", Description: `convert the VM objects to this API version; "current" is the newest supported`},
+			},
+			Response: templatev1.Template{},
+		},
 	},
 	Route{
-		"sizes",
+		"revisions",
 		"GET",
-		"/sizes",
-		sizes,
+		"/templates/{namespace}/{name}/revisions",
+		revisions,
+		RouteDoc{
+			Summary:  "List the revisions of the template",
+			Response: templateindex.History{},
+		},
 	},
 	Route{
-		"templates",
+		"revisionsdiff",
 		"GET",
-		"/templates",
-		templates,
+		"/templates/{namespace}/{name}/revisions/diff",
+		revisionsDiff,
+		RouteDoc{
+			Summary: "Compare two revisions of the template",
+			Params: []ParamDoc{
+				{Name: "from", Description: "the older revision; by default the one before the current"},
+				{Name: "to", Description: "the newer revision; by default the current"},
+			},
+			Response: templateindex.RevisionDiff{},
+		},
+	},
+	Route{
+		"search",
+		"GET",
+		"/search",
+		search,
+		RouteDoc{
+			Summary:  "Search the templates",
+			Filtered: true,
+			Params: []ParamDoc{
+				{Name: "q", Description: "the words to search", Required: true},
+				{Name: "limit", Description: "the maximum number of results", Type: "integer"},
+			},
+			Response: []templateindex.SearchResult{},
+		},
+	},
+	Route{
+		"recommend",
+		"GET",
+		"/recommend",
+		recommend,
+		RouteDoc{
+			Summary:  "Recommend the templates fitting the resources",
+			Filtered: true,
+			Params: []ParamDoc{
+				{Name: "cores", Description: "the CPU cores needed", Type: "integer"},
+				{Name: "memory", Description: `the memory needed, as a Kubernetes quantity like "2Gi"`},
+				{Name: "limit", Description: "the maximum number of results", Type: "integer"},
+			},
+			Response: []templateindex.Recommendation{},
+		},
+	},
+	Route{
+		"facets",
+		"GET",
+		"/facets",
+		facets,
+		RouteDoc{
+			Summary:  "Count the templates by each ledger",
+			Filtered: true,
+			Response: map[string][]templateindex.Summary{},
+		},
+	},
+	Route{
+		"deprecations",
+		"GET",
+		"/deprecations",
+		deprecations,
+		RouteDoc{
+			Summary:  "Describe the deprecated templates",
+			Filtered: true,
+			Response: []templateindex.Description{},
+		},
+	},
+	Route{
+		"icon",
+		"GET",
+		"/icons/{id}",
+		icon,
+		RouteDoc{
+			Summary:    "Get the icon of templates, linked by the iconURL of their descriptions",
+			MediaTypes: []string{"image/svg+xml", "image/png"},
+		},
+	},
+	Route{
+		"openapi",
+		"GET",
+		"/openapi.json",
+		openAPI,
+		RouteDoc{
+			Summary:  "This OpenAPI document",
+			Response: map[string]interface{}{},
+		},
+	},
+	Route{
+		"namemaps",
+		"GET",
+		"/admin/namemaps",
+		nameMaps,
+		RouteDoc{
+			Summary:  "The localized names, by ledger and language",
+			Response: map[string]map[string]map[string]string{},
+		},
 	},
 }
 
-func oses(w http.ResponseWriter, r *http.Request) {
-	summarize("os", w, r)
+// operationalRoutes are served only at the root, outside of the API versions.
+// The GraphQL schema evolves deprecating its fields instead.
+var operationalRoutes = Routes{
+	Route{
+		"metrics",
+		"GET",
+		"/metrics",
+		// compressed by the router
+		promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{DisableCompression: true}).ServeHTTP,
+		RouteDoc{
+			Summary: "Prometheus metrics",
+		},
+	},
+	Route{
+		"graphql",
+		"GET",
+		"/graphql",
+		graphQL,
+		RouteDoc{
+			Summary: "Query the templates with GraphQL",
+			Params: []ParamDoc{
+				{Name: "query", Description: "the GraphQL query", Required: true},
+				{Name: "operationName", Description: "the operation to run, if the query has more"},
+				{Name: "variables", Description: "the values of the variables, as a JSON object"},
+			},
+			Response: map[string]interface{}{},
+		},
+	},
+	Route{
+		"graphqlpost",
+		"POST",
+		"/graphql",
+		graphQL,
+		RouteDoc{
+			Summary:  `Query the templates with GraphQL: the body is {"query": ..., "operationName": ..., "variables": ...}, or the query with the application/graphql content type`,
+			Response: map[string]interface{}{},
+		},
+	},
 }
 
-func workloads(w http.ResponseWriter, r *http.Request) {
-	summarize("workload", w, r)
+// CheckRoute tells if an extra route, like the summary of a ledger, can be served at path:
+// the builtin routes would hide it, and the paths under APIPrefix are reserved to the API versions
+func CheckRoute(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("route %s: must start with /", path)
+	}
+	if strings.HasPrefix(path+"/", APIPrefix) {
+		return fmt.Errorf("route %s: the paths under %s are reserved to the API versions", path, APIPrefix)
+	}
+
+	router := mux.NewRouter().StrictSlash(true)
+	for _, route := range append(append(Routes{}, routes...), operationalRoutes...) {
+		router.Path(route.Pattern).Name(route.Name)
+	}
+	match := mux.RouteMatch{}
+	if router.Match(&http.Request{Method: "GET", URL: &url.URL{Path: path}}, &match) {
+		return fmt.Errorf("route %s: taken by the builtin route %s", path, match.Route.GetName())
+	}
+	return nil
 }
 
-func sizes(w http.ResponseWriter, r *http.Request) {
-	summarize("size", w, r)
+// SummaryRoute returns the route which summarizes the templates using the given ledger
+func SummaryRoute(name, pattern, ledger string) Route {
+	return Route{
+		name,
+		"GET",
+		pattern,
+		func(w http.ResponseWriter, r *http.Request) {
+			summarize(ledger, w, r)
+		},
+		RouteDoc{
+			Summary:  fmt.Sprintf("Summarize the templates by %s", ledger),
+			Filtered: true,
+			Params: []ParamDoc{
+				{Name: "counts", Description: "count the templates of each entry", Type: "boolean"},
+				{Name: "group", Description: `group the entries: only "family" is supported, returning the groups instead`},
+			},
+			Response: []templateindex.Summary{},
+		},
+	}
 }
 
 func templates(w http.ResponseWriter, r *http.Request) {
 
-	descriptions, err := index.DescribeBy(templateindex.FilterOptionsFromURL(r.URL))
+	opts, ok := visibleOptions(w, r, templateindex.FilterOptionsFromURL(r.URL, index.LedgerNames()...))
+	if !ok {
+		return
+	}
+	descriptions, err := index.DescribeBy(opts, templateindex.LanguagesFromRequest(r)...)
+	if err != nil {
+		panic(err)
+	}
+
+	respond(w, r, http.StatusOK, descriptions)
+}
+
+// template returns the template. The VM objects are converted to the "apiVersion" query parameter
+// if given; "current" stands for the newest API version supported.
+func template(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !visibleTemplate(w, r, vars["namespace"], vars["name"]) {
+		return
+	}
+	t, err := index.Template(vars["namespace"], vars["name"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if apiVersion := r.URL.Query().Get("apiVersion"); apiVersion != "" {
+		if apiVersion == "current" {
+			apiVersion = templateindex.CurrentVMAPIVersion
+		}
+		converted, err := templateindex.ConvertTemplate(&t, apiVersion)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t = *converted
+	}
+
+	respond(w, r, http.StatusOK, t)
+}
+
+func revisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !visibleTemplate(w, r, vars["namespace"], vars["name"]) {
+		return
+	}
+	history, err := index.Revisions(vars["namespace"], vars["name"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	respond(w, r, http.StatusOK, history)
+}
+
+// revisionsDiff compares the revisions given by the "from" and "to" query parameters,
+// by default the current revision and the one before it.
+func revisionsDiff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !visibleTemplate(w, r, vars["namespace"], vars["name"]) {
+		return
+	}
+	query := r.URL.Query()
+	diff, err := index.DiffRevisions(vars["namespace"], vars["name"], query.Get("from"), query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	respond(w, r, http.StatusOK, diff)
+}
+
+func deprecations(w http.ResponseWriter, r *http.Request) {
+	opts, ok := visibleOptions(w, r, templateindex.FilterOptionsFromURL(r.URL, index.LedgerNames()...))
+	if !ok {
+		return
+	}
+	descriptions, err := index.Deprecations(opts, templateindex.LanguagesFromRequest(r)...)
 	if err != nil {
 		panic(err)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = json.NewEncoder(w).Encode(descriptions)
+	respond(w, r, http.StatusOK, descriptions)
+}
+
+func nameMaps(w http.ResponseWriter, r *http.Request) {
+	respond(w, r, http.StatusOK, index.NameMaps())
+}
+
+func search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if strings.TrimSpace(query.Get("q")) == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	opts, ok := visibleOptions(w, r, templateindex.FilterOptionsFromURL(r.URL, index.LedgerNames()...))
+	if !ok {
+		return
+	}
+	results, err := index.Search(query.Get("q"), opts, limit, templateindex.LanguagesFromRequest(r)...)
 	if err != nil {
 		panic(err)
 	}
+
+	respond(w, r, http.StatusOK, results)
 }
 
-func summarize(label string, w http.ResponseWriter, r *http.Request) {
-	summaries, err := index.SummarizeBy(label)
+func recommend(w http.ResponseWriter, r *http.Request) {
+	req, err := templateindex.RequirementsFromURL(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	opts, ok := visibleOptions(w, r, templateindex.FilterOptionsFromURL(r.URL, index.LedgerNames()...))
+	if !ok {
+		return
+	}
+	recommendations, err := index.Recommend(opts, req, limit, templateindex.LanguagesFromRequest(r)...)
 	if err != nil {
 		panic(err)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	err = json.NewEncoder(w).Encode(summaries)
+	respond(w, r, http.StatusOK, recommendations)
+}
+
+func facets(w http.ResponseWriter, r *http.Request) {
+	opts, ok := visibleOptions(w, r, templateindex.FilterOptionsFromURL(r.URL, index.LedgerNames()...))
+	if !ok {
+		return
+	}
+	facets, err := index.Facets(opts, templateindex.LanguagesFromRequest(r)...)
 	if err != nil {
 		panic(err)
 	}
+
+	respond(w, r, http.StatusOK, facets)
 }
 
-func Serve(host string, port int, index_ *templateindex.TemplateIndexer, log_ logr.Logger) error {
+func summarize(label string, w http.ResponseWriter, r *http.Request) {
+	var summaries []templateindex.Summary
+	var err error
+	opts, ok := visibleOptions(w, r, templateindex.FilterOptionsFromURL(r.URL, index.LedgerNames()...))
+	if !ok {
+		return
+	}
+	if group := r.URL.Query().Get("group"); group != "" {
+		groupSummaries(label, group, opts, w, r)
+		return
+	}
+	if counts, _ := strconv.ParseBool(r.URL.Query().Get("counts")); counts {
+		summaries, err = index.CountBy(label, opts, templateindex.LanguagesFromRequest(r)...)
+	} else {
+		summaries, err = index.SummarizeBy(label, opts, templateindex.LanguagesFromRequest(r)...)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	respond(w, r, http.StatusOK, summaries)
+}
+
+func groupSummaries(label, group string, opts templateindex.FilterOptions, w http.ResponseWriter, r *http.Request) {
+	if group != "family" {
+		http.Error(w, fmt.Sprintf("unsupported group: %q", group), http.StatusBadRequest)
+		return
+	}
+	groups, err := index.GroupBy(label, opts, templateindex.LanguagesFromRequest(r)...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respond(w, r, http.StatusOK, groups)
+}
+
+// EnableAuth makes the HTTP API authenticate the callers, and show them only the templates of the namespaces
+// they are allowed to see. Must be called before Serve.
+func EnableAuth(authorizer_ *auth.Authorizer) {
+	authorizer = authorizer_
+}
+
+// authenticate the caller. On failure, writes the error response and returns nil.
+func authenticate(w http.ResponseWriter, r *http.Request) *auth.User {
+	user, err := authorizer.AuthenticateRequest(r)
+	if err == auth.ErrUnauthenticated {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	return user
+}
+
+// visibleOptions restricts opts to the namespaces the caller may see, if the authorization is enabled.
+// On failure, writes the error response and returns false.
+func visibleOptions(w http.ResponseWriter, r *http.Request, opts templateindex.FilterOptions) (templateindex.FilterOptions, bool) {
+	if authorizer == nil {
+		return opts, true
+	}
+	user := authenticate(w, r)
+	if user == nil {
+		return opts, false
+	}
+	namespaces, err := authorizer.VisibleNamespaces(user, index.Namespaces())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return opts, false
+	}
+	return opts.WithNamespaces(namespaces), true
+}
+
+// visibleTemplate tells if the caller may see the template, if the authorization is enabled.
+// The templates the caller cannot see are not found, so their existence is not disclosed.
+// On failure, writes the error response and returns false.
+func visibleTemplate(w http.ResponseWriter, r *http.Request, namespace, name string) bool {
+	if authorizer == nil {
+		return true
+	}
+	user := authenticate(w, r)
+	if user == nil {
+		return false
+	}
+	allowed, err := authorizer.CanGet(user, namespace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, fmt.Sprintf("unknown template: %s/%s", namespace, name), http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// Handler returns the handler of the HTTP API, with the limits applied, to serve it with a custom server
+// or in process. The extra routes are served along the builtin ones.
+func Handler(index_ *templateindex.TemplateIndexer, log_ logr.Logger, extra Routes) http.Handler {
 	index = index_
 	log = log_
 
-	return http.ListenAndServe(
-		fmt.Sprintf("%s:%d", host, port),
-		NewRouter(),
-	)
+	return sharedLimiter.Handler(NewRouter(extra))
+}
+
+// Serve the HTTP API. The extra routes are served along the builtin ones.
+func Serve(host string, port int, index_ *templateindex.TemplateIndexer, log_ logr.Logger, extra Routes) error {
+	return newServer(host, port, multiplex(Handler(index_, log_, extra))).ListenAndServe()
+}
+
+// ServeTLS is like Serve, but serves HTTPS using the given configuration
+func ServeTLS(host string, port int, config *tls.Config, index_ *templateindex.TemplateIndexer, log_ logr.Logger, extra Routes) error {
+	server := newServer(host, port, multiplex(Handler(index_, log_, extra)))
+	server.TLSConfig = config
+	// the certificate comes from the configuration
+	return server.ListenAndServeTLS("", "")
+}
+
+func newServer(host string, port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", host, port),
+		Handler:           handler,
+		ReadHeaderTimeout: limits.Timeout,
+		MaxHeaderBytes:    limits.MaxHeaderBytes,
+	}
 }
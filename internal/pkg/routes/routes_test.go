@@ -0,0 +1,71 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+func TestCheckRoute(t *testing.T) {
+	for _, path := range []string{"/search", "/recommend", "/templates", "/templates/", "/templates/openshift/fedora",
+		"/metrics", "/graphql", "/api", "/api/v1/gpus", "gpus"} {
+		if err := CheckRoute(path); err == nil {
+			t.Errorf("route %s unexpectedly accepted", path)
+		}
+	}
+	for _, lc := range templateindex.DefaultLedgersConfig().Ledgers {
+		if lc.Route == "" {
+			continue
+		}
+		if err := CheckRoute(lc.Route); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if err := CheckRoute("/gpus"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSearchMissingQuery(t *testing.T) {
+	server, _ := setupGraphQL(t)
+	defer server.Close()
+
+	for _, query := range []string{"", "?q=", "?q=%20%20", "?limit=5"} {
+		resp, err := http.Get(server.URL + "/api/v1/search" + query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("search%s: unexpected status: %v", query, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/api/v1/search?q=fedora")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: %v", resp.StatusCode)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// TLSOptions configures the HTTPS server; the certificate is served by a CertificateReloader
+type TLSOptions struct {
+	// if set, the clients must present a certificate signed by one of the CAs in this bundle
+	ClientCAFile string
+	// like "1.2"; the default is 1.2
+	MinVersion string
+	// the names of the cipher suites, like "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"; the default is Go's
+	CipherSuites []string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// NewTLSConfig creates the configuration of the HTTPS server, whose certificate is served by the reloader
+func NewTLSConfig(opts TLSOptions, reloader *CertificateReloader) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if opts.MinVersion != "" {
+		version, ok := tlsVersions[opts.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version: %q", opts.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	for _, name := range opts.CipherSuites {
+		suite, ok := cipherSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite: %q", name)
+		}
+		config.CipherSuites = append(config.CipherSuites, suite)
+	}
+	if opts.ClientCAFile != "" {
+		// the bundle is reloaded along the certificate: every handshake gets the current one
+		if err := reloader.setClientCAFile(opts.ClientCAFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = reloader.ClientCAs()
+		config.GetConfigForClient = reloader.getConfigForClient(config)
+	}
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// CertificateReloader serves the certificate and the key found in the files, and reloads them when they change,
+// e.g. when the service serving certificates are rotated. Like the NameMapWatcher, it looks at the resolved
+// paths as well as at the file metadata, to follow the atomic swaps of the mounted secrets.
+// The bundle of the client CAs, if configured by NewTLSConfig, is reloaded the same way.
+type CertificateReloader struct {
+	lock         sync.RWMutex
+	log          logr.Logger
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	cert         *tls.Certificate
+	clientCAs    *x509.CertPool
+	stamp        string
+}
+
+// NewCertificateReloader loads the certificate and the key, which must be valid
+func NewCertificateReloader(certFile, keyFile string, log logr.Logger) (*CertificateReloader, error) {
+	cr := &CertificateReloader{
+		log:      log,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *CertificateReloader) load() error {
+	stamp := cr.currentStamp()
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if cr.clientCAFile != "" {
+		if clientCAs, err = loadCertPool(cr.clientCAFile); err != nil {
+			return err
+		}
+	}
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	cr.cert = &cert
+	cr.clientCAs = clientCAs
+	cr.stamp = stamp
+	return nil
+}
+
+func (cr *CertificateReloader) currentStamp() string {
+	if cr.clientCAFile == "" {
+		return certStamp(cr.certFile, cr.keyFile)
+	}
+	return certStamp(cr.certFile, cr.keyFile, cr.clientCAFile)
+}
+
+// setClientCAFile loads also the bundle of the client CAs, which must be valid. Must be called before Run.
+func (cr *CertificateReloader) setClientCAFile(path string) error {
+	cr.clientCAFile = path
+	return cr.load()
+}
+
+// Check reloads the certificate if the files changed since the last check. Returns true if it was reloaded.
+// If the new files are not valid, the old certificate is kept.
+func (cr *CertificateReloader) Check() bool {
+	cr.lock.RLock()
+	unchanged := cr.currentStamp() == cr.stamp
+	cr.lock.RUnlock()
+	if unchanged {
+		return false
+	}
+
+	if err := cr.load(); err != nil {
+		// the certificate and the key may be updated one after the other: retry at the next check
+		cr.log.Error(err, fmt.Sprintf("unable to reload certificate %s", cr.certFile))
+		return false
+	}
+	cr.log.Info(fmt.Sprintf("reloaded certificate %s", cr.certFile))
+	return true
+}
+
+// Run checks the certificate every interval, until stop is closed.
+func (cr *CertificateReloader) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cr.Check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// GetCertificate is the tls.Config callback
+func (cr *CertificateReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	return cr.cert, nil
+}
+
+// ClientCAs returns the current bundle of the client CAs; nil if not configured
+func (cr *CertificateReloader) ClientCAs() *x509.CertPool {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	return cr.clientCAs
+}
+
+// getConfigForClient returns the tls.Config callback giving the handshakes the base configuration,
+// with the current client CAs
+func (cr *CertificateReloader) getConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		config := base.Clone()
+		config.ClientCAs = cr.ClientCAs()
+		return config, nil
+	}
+}
+
+func certStamp(paths ...string) string {
+	stamps := []string{}
+	for _, path := range paths {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			stamps = append(stamps, "")
+			continue
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			stamps = append(stamps, "")
+			continue
+		}
+		stamps = append(stamps, fmt.Sprintf("%s:%d:%d", resolved, info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(stamps, ",")
+}
+
+// RedirectToHTTPS serves plain HTTP on the given port, redirecting all the requests to the HTTPS port
+func RedirectToHTTPS(host string, port, httpsPort int) error {
+	return http.ListenAndServe(fmt.Sprintf("%s:%d", host, port), redirectHandler(httpsPort))
+}
+
+// redirectHandler redirects to the same URL on the HTTPS port. The redirect is permanent and keeps the method
+// and the body, so POST /graphql stays a POST.
+func redirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hostname := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			hostname = h
+		}
+		target := fmt.Sprintf("https://%s%s", net.JoinHostPort(hostname, fmt.Sprintf("%d", httpsPort)), r.URL.RequestURI())
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,258 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// newTestCertificate returns a self-signed certificate, and its key, in PEM
+func newTestCertificate(t *testing.T, name string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTestFile writes the file with a modification time different from the previous one
+func writeTestFile(t *testing.T, path string, data []byte, mtime time.Time) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("cannot write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("cannot touch %s: %v", path, err)
+	}
+}
+
+// subjectOf returns the common name of the certificate served
+func subjectOf(t *testing.T, cr *CertificateReloader) string {
+	cert, err := cr.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || cert == nil {
+		t.Fatalf("no certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("cannot parse certificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func hasSubject(pool *x509.CertPool, certPEM []byte) bool {
+	block, _ := pem.Decode(certPEM)
+	cert, _ := x509.ParseCertificate(block.Bytes)
+	for _, subject := range pool.Subjects() {
+		if bytes.Equal(subject, cert.RawSubject) {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestReloader(t *testing.T, dir string) *CertificateReloader {
+	certPEM, keyPEM := newTestCertificate(t, "first")
+	mtime := time.Now().Add(-time.Hour)
+	writeTestFile(t, filepath.Join(dir, "tls.crt"), certPEM, mtime)
+	writeTestFile(t, filepath.Join(dir, "tls.key"), keyPEM, mtime)
+	cr, err := NewCertificateReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), logf.NullLogger{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return cr
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cr := newTestReloader(t, dir)
+
+	config, err := NewTLSConfig(TLSOptions{}, cr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MinVersion != tls.VersionTLS12 || config.CipherSuites != nil || config.ClientAuth != tls.NoClientCert {
+		t.Errorf("unexpected default configuration: %#v", config)
+	}
+
+	config, err = NewTLSConfig(TLSOptions{
+		MinVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305"},
+	}, cr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MinVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected min version: %x", config.MinVersion)
+	}
+	expected := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305}
+	if len(config.CipherSuites) != len(expected) || config.CipherSuites[0] != expected[0] || config.CipherSuites[1] != expected[1] {
+		t.Errorf("unexpected cipher suites: %v", config.CipherSuites)
+	}
+
+	for _, opts := range []TLSOptions{
+		{MinVersion: "1.4"},
+		{MinVersion: "TLS1.2"},
+		{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{ClientCAFile: filepath.Join(dir, "missing.crt")},
+		// a key is not a CA bundle
+		{ClientCAFile: filepath.Join(dir, "tls.key")},
+	} {
+		if _, err := NewTLSConfig(opts, cr); err == nil {
+			t.Errorf("unexpectedly accepted %#v", opts)
+		}
+	}
+
+	caPEM, _ := newTestCertificate(t, "ca")
+	writeTestFile(t, filepath.Join(dir, "ca.crt"), caPEM, time.Now().Add(-time.Hour))
+	config, err = NewTLSConfig(TLSOptions{ClientCAFile: filepath.Join(dir, "ca.crt")}, cr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("unexpected client auth: %v", config.ClientAuth)
+	}
+	handshake, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil || !hasSubject(handshake.ClientCAs, caPEM) {
+		t.Errorf("unexpected client CAs: %v", err)
+	}
+}
+
+func TestCertificateReloaderCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cr := newTestReloader(t, dir)
+	if cr.Check() {
+		t.Errorf("reloaded without changes")
+	}
+	if subject := subjectOf(t, cr); subject != "first" {
+		t.Errorf("unexpected certificate: %v", subject)
+	}
+
+	// the certificate is written before the key: the pair is invalid until both are there
+	certPEM, keyPEM := newTestCertificate(t, "second")
+	mtime := time.Now().Add(-time.Minute)
+	writeTestFile(t, filepath.Join(dir, "tls.crt"), certPEM, mtime)
+	if cr.Check() {
+		t.Errorf("reloaded an invalid pair")
+	}
+	if subject := subjectOf(t, cr); subject != "first" {
+		t.Errorf("the old certificate was not kept: %v", subject)
+	}
+	writeTestFile(t, filepath.Join(dir, "tls.key"), keyPEM, mtime)
+	if !cr.Check() {
+		t.Errorf("not reloaded after the rotation")
+	}
+	if subject := subjectOf(t, cr); subject != "second" {
+		t.Errorf("unexpected certificate: %v", subject)
+	}
+	if cr.Check() {
+		t.Errorf("reloaded without changes")
+	}
+}
+
+func TestCertificateReloaderClientCAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cr := newTestReloader(t, dir)
+	caFile := filepath.Join(dir, "ca.crt")
+	oldCA, _ := newTestCertificate(t, "old ca")
+	writeTestFile(t, caFile, oldCA, time.Now().Add(-time.Hour))
+	config, err := NewTLSConfig(TLSOptions{ClientCAFile: caFile}, cr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	newCA, _ := newTestCertificate(t, "new ca")
+	writeTestFile(t, caFile, append(oldCA, newCA...), time.Now().Add(-time.Minute))
+	if !cr.Check() {
+		t.Errorf("not reloaded after the rotation of the CA")
+	}
+	handshake, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil || !hasSubject(handshake.ClientCAs, oldCA) || !hasSubject(handshake.ClientCAs, newCA) {
+		t.Errorf("unexpected client CAs: %v", err)
+	}
+	if handshake.MinVersion != config.MinVersion || handshake.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("unexpected configuration: %#v", handshake)
+	}
+
+	// an invalid bundle keeps the previous one
+	writeTestFile(t, caFile, []byte("garbage"), time.Now())
+	if cr.Check() {
+		t.Errorf("reloaded an invalid CA bundle")
+	}
+	if handshake, _ := config.GetConfigForClient(&tls.ClientHelloInfo{}); !hasSubject(handshake.ClientCAs, newCA) {
+		t.Errorf("the old CA bundle was not kept")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://example.com:8080/graphql?query=x", bytes.NewBufferString("{}"))
+	rec := httptest.NewRecorder()
+	redirectHandler(8443).ServeHTTP(rec, req)
+	if rec.Code != http.StatusPermanentRedirect {
+		t.Errorf("unexpected status: %v", rec.Code)
+	}
+	if location := rec.Header().Get("Location"); location != "https://example.com:8443/graphql?query=x" {
+		t.Errorf("unexpected location: %v", location)
+	}
+}
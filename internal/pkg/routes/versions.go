@@ -0,0 +1,85 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"context"
+	"net/http"
+)
+
+// APIPrefix is the prefix of the paths of the versioned API, followed by the name of the version
+const APIPrefix = "/api/"
+
+// APIVersion is a version of the HTTP API, served under APIPrefix + Name, like "/api/v1/templates".
+// All the versions are served by the same handlers: Convert adapts their responses to the version.
+type APIVersion struct {
+	Name string
+	// Convert turns a response of the handlers into the one of this version. nil if they are the same.
+	// It must map the empty values to the empty values of the new types: the OpenAPI schemas come from them.
+	Convert func(value interface{}) interface{}
+}
+
+func (v APIVersion) convert(value interface{}) interface{} {
+	if v.Convert == nil {
+		return value
+	}
+	return v.Convert(value)
+}
+
+// Prefix returns the prefix of the paths of the version
+func (v APIVersion) Prefix() string {
+	return APIPrefix + v.Name
+}
+
+// apiVersions are the versions served, oldest first
+var apiVersions = []APIVersion{
+	APIVersion{Name: "v1"},
+}
+
+// legacyVersion is the version served by the deprecated paths without prefix
+var legacyVersion = apiVersions[0]
+
+type contextKey int
+
+const apiVersionKey contextKey = iota
+
+// withVersion makes the responses of inner follow the given version
+func withVersion(inner http.Handler, version APIVersion) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey, version)))
+	})
+}
+
+// requestVersion returns the version requested; the legacy one if the route is not versioned
+func requestVersion(r *http.Request) APIVersion {
+	if version, ok := r.Context().Value(apiVersionKey).(APIVersion); ok {
+		return version
+	}
+	return legacyVersion
+}
+
+// deprecated marks the responses as deprecated (draft-ietf-httpapi-deprecation-header),
+// linking the same path under the given prefix
+func deprecated(inner http.Handler, successorPrefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Add("Link", "<"+successorPrefix+r.URL.EscapedPath()+`>; rel="successor-version"`)
+		inner.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+// templateV2 is the description of the templates in the test version "v2"
+type templateV2 struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+func convertV2(value interface{}) interface{} {
+	descriptions, ok := value.([]templateindex.Description)
+	if !ok {
+		return value
+	}
+	templates := []templateV2{}
+	for _, desc := range descriptions {
+		templates = append(templates, templateV2{ID: desc.ID, DisplayName: desc.Name})
+	}
+	return templates
+}
+
+func getJSON(t *testing.T, server *httptest.Server, path string, value interface{}) {
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("%s: unexpected status: %v", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+		t.Fatalf("%s: unexpected error: %v", path, err)
+	}
+}
+
+func TestAPIVersionConvert(t *testing.T) {
+	saved := apiVersions
+	apiVersions = append(append([]APIVersion{}, apiVersions...), APIVersion{Name: "v2", Convert: convertV2})
+	defer func() { apiVersions = saved }()
+
+	server, templates := setupGraphQL(t)
+	defer server.Close()
+
+	converted := []map[string]interface{}{}
+	getJSON(t, server, "/api/v2/templates", &converted)
+	if len(converted) != len(templates) {
+		t.Fatalf("unexpected templates: %v expected %v", len(converted), len(templates))
+	}
+	for _, tmpl := range converted {
+		if len(tmpl) != 2 || tmpl["id"] == "" || tmpl["displayName"] == "" {
+			t.Errorf("unexpected v2 template: %v", tmpl)
+		}
+	}
+	for _, path := range []string{"/api/v1/templates", "/templates"} {
+		descriptions := []map[string]interface{}{}
+		getJSON(t, server, path, &descriptions)
+		if len(descriptions) != len(templates) || descriptions[0]["displayName"] != nil || descriptions[0]["name"] == "" {
+			t.Errorf("%s: unexpected v1 templates: %v", path, descriptions)
+		}
+	}
+
+	for version, component := range map[string]string{"v1": "templateindex.Description", "v2": "routes.templateV2"} {
+		doc := struct {
+			Paths map[string]map[string]struct {
+				Responses map[string]struct {
+					Content map[string]struct {
+						Schema struct {
+							Items map[string]string `json:"items"`
+						} `json:"schema"`
+					} `json:"content"`
+				} `json:"responses"`
+			} `json:"paths"`
+			Components struct {
+				Schemas map[string]struct {
+					Properties map[string]interface{} `json:"properties"`
+				} `json:"schemas"`
+			} `json:"components"`
+		}{}
+		getJSON(t, server, "/api/"+version+"/openapi.json", &doc)
+		items := doc.Paths["/api/"+version+"/templates"]["get"].Responses["200"].Content["application/json"].Schema.Items
+		if items["$ref"] != "#/components/schemas/"+component {
+			t.Errorf("%s: unexpected schema of the templates: %v", version, items)
+		}
+		if _, ok := doc.Components.Schemas[component]; !ok {
+			t.Errorf("%s: missing component %s", version, component)
+		}
+		if version == "v2" {
+			properties := doc.Components.Schemas[component].Properties
+			if len(properties) != 2 || properties["id"] == nil || properties["displayName"] == nil {
+				t.Errorf("unexpected properties of %s: %v", component, properties)
+			}
+		}
+	}
+}
@@ -0,0 +1,278 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+// Package auth tells which templates the callers of the HTTP API may see, asking the API server
+// who they are (TokenReview) and what they are allowed to do (SubjectAccessReview).
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultCacheTTL is how long the reviews are remembered
+const DefaultCacheTTL = time.Minute
+
+// how many reviews of each kind are remembered: the least recently used are forgotten first,
+// so the random tokens can't grow the caches without bound
+const cacheSize = 4096
+
+// ErrUnauthenticated is returned when the caller has no valid bearer token
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Resource is what the callers must be allowed to "get" in a namespace to see its templates
+type Resource struct {
+	Group    string
+	Resource string
+}
+
+// DefaultResource are the OpenShift templates
+var DefaultResource = Resource{
+	Group:    "template.openshift.io",
+	Resource: "templates",
+}
+
+// User is the caller, as told by the TokenReview
+type User struct {
+	Name   string
+	UID    string
+	Groups []string
+	Extra  map[string][]string
+}
+
+// key identifies the user in the cache of the decisions. It includes everything the SubjectAccessReview sees:
+// the same user with a scoped token (OpenShift puts the scopes in Extra) must not share the decisions of a full one.
+func (u *User) key() string {
+	groups := append([]string{}, u.Groups...)
+	sort.Strings(groups)
+	extra := make(map[string][]string)
+	for k, v := range u.Extra {
+		values := append([]string{}, v...)
+		sort.Strings(values)
+		extra[k] = values
+	}
+	// encoding/json sorts the keys of the maps
+	data, _ := json.Marshal(struct {
+		Name   string
+		UID    string
+		Groups []string
+		Extra  map[string][]string
+	}{u.Name, u.UID, groups, extra})
+	return string(data)
+}
+
+// tokenKey identifies the token in the cache of the users, without keeping the token itself in memory
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authorizer authenticates the bearer tokens, and tells in which namespaces the users may get the templates.
+// Both the answers are cached for the configured TTL.
+type Authorizer struct {
+	client   kubernetes.Interface
+	resource Resource
+	ttl      time.Duration
+	log      logr.Logger
+	now      func() time.Time
+
+	lock sync.Mutex
+	// the users by tokenKey; nil for the tokens not authenticated
+	users *lruCache
+	// the decisions by user key and namespace
+	decisions *lruCache
+}
+
+// NewAuthorizer creates an Authorizer checking the access to the DefaultResource, with the DefaultCacheTTL
+func NewAuthorizer(client kubernetes.Interface, log logr.Logger) *Authorizer {
+	return &Authorizer{
+		client:    client,
+		resource:  DefaultResource,
+		ttl:       DefaultCacheTTL,
+		log:       log,
+		now:       time.Now,
+		users:     newLRUCache(cacheSize),
+		decisions: newLRUCache(cacheSize),
+	}
+}
+
+// SetResource changes what the users must be allowed to get
+func (a *Authorizer) SetResource(resource Resource) {
+	a.resource = resource
+}
+
+// SetCacheTTL changes how long the reviews are remembered. Zero disables the cache.
+func (a *Authorizer) SetCacheTTL(ttl time.Duration) {
+	a.ttl = ttl
+}
+
+// bearerToken returns the bearer token of the request, if any
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(parts[1]), true
+}
+
+// AuthenticateRequest authenticates the bearer token of the request
+func (a *Authorizer) AuthenticateRequest(r *http.Request) (*User, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return a.Authenticate(token)
+}
+
+// CachedRequestUser is CachedUser for the bearer token of the request
+func (a *Authorizer) CachedRequestUser(r *http.Request) (*User, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, false
+	}
+	return a.CachedUser(token)
+}
+
+// CachedUser tells who the token belongs to only if it was already authenticated, never asking the API server:
+// unlike Authenticate, it can be used before the rate limits.
+func (a *Authorizer) CachedUser(token string) (*User, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	cached, ok := a.users.get(tokenKey(token), a.now())
+	if !ok || cached.(*User) == nil {
+		return nil, false
+	}
+	return cached.(*User), true
+}
+
+// Authenticate tells who the token belongs to, using a TokenReview
+func (a *Authorizer) Authenticate(token string) (*User, error) {
+	now := a.now()
+	key := tokenKey(token)
+	a.lock.Lock()
+	cached, ok := a.users.get(key, now)
+	a.lock.Unlock()
+	if ok {
+		if cached.(*User) == nil {
+			return nil, ErrUnauthenticated
+		}
+		return cached.(*User), nil
+	}
+
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	})
+	if err != nil {
+		a.log.Error(err, "failed to review token")
+		return nil, err
+	}
+
+	var user *User
+	if review.Status.Authenticated {
+		user = &User{
+			Name:   review.Status.User.Username,
+			UID:    review.Status.User.UID,
+			Groups: review.Status.User.Groups,
+			Extra:  make(map[string][]string),
+		}
+		for key, value := range review.Status.User.Extra {
+			user.Extra[key] = []string(value)
+		}
+	}
+	a.lock.Lock()
+	a.users.add(key, user, now.Add(a.ttl))
+	a.lock.Unlock()
+
+	if user == nil {
+		return nil, ErrUnauthenticated
+	}
+	return user, nil
+}
+
+// CanGet tells if the user may get the templates of the namespace, using a SubjectAccessReview
+func (a *Authorizer) CanGet(user *User, namespace string) (bool, error) {
+	now := a.now()
+	key := user.key() + "|" + namespace
+	a.lock.Lock()
+	cached, ok := a.decisions.get(key, now)
+	a.lock.Unlock()
+	if ok {
+		return cached.(bool), nil
+	}
+
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Name,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "get",
+				Group:     a.resource.Group,
+				Resource:  a.resource.Resource,
+			},
+		},
+	})
+	if err != nil {
+		a.log.Error(err, fmt.Sprintf("failed to review the access of %s to namespace %s", user.Name, namespace))
+		return false, err
+	}
+
+	allowed := review.Status.Allowed && !review.Status.Denied
+	a.lock.Lock()
+	a.decisions.add(key, allowed, now.Add(a.ttl))
+	a.lock.Unlock()
+	return allowed, nil
+}
+
+// VisibleNamespaces returns the namespaces, among the given ones, in which the user may get the templates
+func (a *Authorizer) VisibleNamespaces(user *User, namespaces []string) ([]string, error) {
+	visible := []string{}
+	for _, namespace := range namespaces {
+		allowed, err := a.CanGet(user, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			visible = append(visible, namespace)
+		}
+	}
+	return visible, nil
+}
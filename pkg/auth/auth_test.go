@@ -0,0 +1,254 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// newFakeClient knows the token "alice-token", and lets alice get the templates only in "team-a".
+// "alice-scoped-token" is alice too, but restricted to the user info by its scopes: it can't get the templates.
+func newFakeClient(reviews *int) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*reviews += 1
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview).DeepCopy()
+		if review.Spec.Token == "alice-token" || review.Spec.Token == "alice-scoped-token" {
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{
+				Username: "alice",
+				Groups:   []string{"team-a", "system:authenticated"},
+			}
+		}
+		if review.Spec.Token == "alice-scoped-token" {
+			review.Status.User.Extra = map[string]authenticationv1.ExtraValue{
+				scopesExtra: {"user:info", "user:check-access"},
+			}
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*reviews += 1
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview).DeepCopy()
+		attrs := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == "alice" && attrs.Namespace == "team-a" &&
+			attrs.Verb == "get" && attrs.Group == DefaultResource.Group && attrs.Resource == DefaultResource.Resource &&
+			len(review.Spec.Extra[scopesExtra]) == 0
+		return true, review, nil
+	})
+	return client
+}
+
+const scopesExtra = "scopes.authorization.openshift.io"
+
+func newRequest(token string) *http.Request {
+	r, _ := http.NewRequest("GET", "/templates", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	reviews := 0
+	a := NewAuthorizer(newFakeClient(&reviews), logf.NullLogger{})
+
+	user, err := a.AuthenticateRequest(newRequest("alice-token"))
+	if err != nil || user.Name != "alice" || len(user.Groups) != 2 {
+		t.Errorf("unexpected user: %v %v", user, err)
+	}
+
+	if _, err := a.AuthenticateRequest(newRequest("bogus-token")); err != ErrUnauthenticated {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := a.AuthenticateRequest(newRequest("")); err != ErrUnauthenticated {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if reviews != 2 {
+		t.Errorf("unexpected reviews: %v", reviews)
+	}
+}
+
+func TestCachedUser(t *testing.T) {
+	reviews := 0
+	a := NewAuthorizer(newFakeClient(&reviews), logf.NullLogger{})
+
+	if user, ok := a.CachedRequestUser(newRequest("alice-token")); ok {
+		t.Errorf("unexpected user: %v", user)
+	}
+	if reviews != 0 {
+		t.Errorf("the API server was asked: %v", reviews)
+	}
+
+	a.Authenticate("alice-token")
+	a.Authenticate("bogus-token")
+	if user, ok := a.CachedRequestUser(newRequest("alice-token")); !ok || user.Name != "alice" {
+		t.Errorf("unexpected user: %v %v", user, ok)
+	}
+	if user, ok := a.CachedUser("bogus-token"); ok {
+		t.Errorf("unexpected user: %v", user)
+	}
+	if _, ok := a.CachedRequestUser(newRequest("")); ok {
+		t.Errorf("unexpected user")
+	}
+	if reviews != 2 {
+		t.Errorf("unexpected reviews: %v", reviews)
+	}
+}
+
+func TestVisibleNamespaces(t *testing.T) {
+	reviews := 0
+	a := NewAuthorizer(newFakeClient(&reviews), logf.NullLogger{})
+
+	user, err := a.Authenticate("alice-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	namespaces, err := a.VisibleNamespaces(user, []string{"openshift", "team-a", "team-b"})
+	if err != nil || len(namespaces) != 1 || namespaces[0] != "team-a" {
+		t.Errorf("unexpected namespaces: %v %v", namespaces, err)
+	}
+	if reviews != 4 {
+		t.Errorf("unexpected reviews: %v", reviews)
+	}
+}
+
+func TestCacheExpiration(t *testing.T) {
+	reviews := 0
+	a := NewAuthorizer(newFakeClient(&reviews), logf.NullLogger{})
+	now := time.Date(2018, 11, 5, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		user, err := a.Authenticate("alice-token")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if allowed, err := a.CanGet(user, "team-a"); err != nil || !allowed {
+			t.Errorf("unexpected decision: %v %v", allowed, err)
+		}
+	}
+	if reviews != 2 {
+		t.Errorf("reviews not cached: %v", reviews)
+	}
+
+	now = now.Add(DefaultCacheTTL)
+	user, _ := a.Authenticate("alice-token")
+	a.CanGet(user, "team-a")
+	if reviews != 4 {
+		t.Errorf("reviews not expired: %v", reviews)
+	}
+}
+
+func TestScopedTokenDecisions(t *testing.T) {
+	reviews := 0
+	a := NewAuthorizer(newFakeClient(&reviews), logf.NullLogger{})
+
+	user, err := a.Authenticate("alice-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allowed, err := a.CanGet(user, "team-a"); err != nil || !allowed {
+		t.Errorf("unexpected decision: %v %v", allowed, err)
+	}
+
+	scoped, err := a.Authenticate("alice-scoped-token")
+	if err != nil || scoped.Name != "alice" {
+		t.Fatalf("unexpected user: %v %v", scoped, err)
+	}
+	if allowed, err := a.CanGet(scoped, "team-a"); err != nil || allowed {
+		t.Errorf("the scoped token got the decision of the full one: %v %v", allowed, err)
+	}
+	if reviews != 4 {
+		t.Errorf("unexpected reviews: %v", reviews)
+	}
+
+	// the order of the scopes does not matter
+	reordered := *scoped
+	reordered.Extra = map[string][]string{scopesExtra: {"user:check-access", "user:info"}}
+	if reordered.key() != scoped.key() || reordered.key() == user.key() {
+		t.Errorf("unexpected keys: %v %v %v", scoped.key(), reordered.key(), user.key())
+	}
+}
+
+func TestCacheBounded(t *testing.T) {
+	reviews := 0
+	a := NewAuthorizer(newFakeClient(&reviews), logf.NullLogger{})
+
+	if _, err := a.Authenticate("alice-token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < cacheSize+10; i++ {
+		if _, err := a.Authenticate(fmt.Sprintf("random-token-%d", i)); err != ErrUnauthenticated {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if i%100 == 0 {
+			// keep alice recently used
+			a.Authenticate("alice-token")
+		}
+	}
+	if a.users.len() != cacheSize {
+		t.Errorf("unexpected cached users: %v", a.users.len())
+	}
+	if _, ok := a.users.entries["alice-token"]; ok {
+		t.Errorf("the token is kept in memory")
+	}
+
+	reviews = 0
+	a.Authenticate("alice-token")
+	a.Authenticate("random-token-0")
+	if reviews != 1 {
+		t.Errorf("unexpected reviews: %v", reviews)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	now := time.Date(2018, 11, 5, 12, 0, 0, 0, time.UTC)
+	c := newLRUCache(2)
+	c.add("a", 1, now.Add(time.Minute))
+	c.add("b", 2, now.Add(time.Minute))
+	if value, ok := c.get("a", now); !ok || value != 1 {
+		t.Errorf("unexpected value: %v %v", value, ok)
+	}
+	// b is the least recently used
+	c.add("c", 3, now.Add(time.Second))
+	if _, ok := c.get("b", now); ok {
+		t.Errorf("b not dropped")
+	}
+	if _, ok := c.get("a", now); !ok {
+		t.Errorf("a dropped")
+	}
+	if _, ok := c.get("c", now.Add(time.Second)); ok {
+		t.Errorf("c not expired")
+	}
+	if c.len() != 1 {
+		t.Errorf("unexpected length: %v", c.len())
+	}
+}
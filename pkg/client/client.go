@@ -0,0 +1,298 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+// Package client is a typed client of the HTTP API of the template indexer
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+// Error is a response of the HTTP API which is not a success
+type Error struct {
+	StatusCode int
+	Message    string
+	// how long to wait before retrying, for the 429 responses
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound tells if err is a 404 response, e.g. because the template does not exist
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// APIPath is the prefix of the paths of the version of the HTTP API the client speaks
+const APIPath = "/api/v1"
+
+// Client calls the HTTP API of a template indexer
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	langs      []string
+}
+
+// New returns a client of the HTTP API served at baseURL, like "https://indexer.example.com:8080"
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL: %q", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+	}, nil
+}
+
+// SetHTTPClient sets the client making the requests, e.g. to configure TLS. The default is http.DefaultClient.
+func (c *Client) SetHTTPClient(httpClient *http.Client) {
+	c.httpClient = httpClient
+}
+
+// SetToken sets the bearer token sent to the servers with the authentication enabled
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// SetLanguages sets the preferred languages of the names and the descriptions, most preferred first
+func (c *Client) SetLanguages(langs ...string) {
+	c.langs = langs
+}
+
+// Templates describes the templates matching the options
+func (c *Client) Templates(opts templateindex.FilterOptions) ([]templateindex.Description, error) {
+	res := []templateindex.Description{}
+	err := c.get("/templates", filterQuery(opts), &res)
+	return res, err
+}
+
+// Template returns the template. If apiVersion is not empty, the VM objects are converted to it;
+// "current" stands for the newest API version supported by the server.
+func (c *Client) Template(namespace, name, apiVersion string) (*templatev1.Template, error) {
+	query := url.Values{}
+	if apiVersion != "" {
+		query.Set("apiVersion", apiVersion)
+	}
+	res := &templatev1.Template{}
+	err := c.get(templatePath(namespace, name), query, res)
+	return res, err
+}
+
+// Revisions returns the revisions of the template
+func (c *Client) Revisions(namespace, name string) (*templateindex.History, error) {
+	res := &templateindex.History{}
+	err := c.get(templatePath(namespace, name)+"/revisions", nil, res)
+	return res, err
+}
+
+// DiffRevisions compares two revisions of the template. Empty from and to stand for
+// the revision before the current one, and the current one.
+func (c *Client) DiffRevisions(namespace, name, from, to string) (*templateindex.RevisionDiff, error) {
+	query := url.Values{}
+	if from != "" {
+		query.Set("from", from)
+	}
+	if to != "" {
+		query.Set("to", to)
+	}
+	res := &templateindex.RevisionDiff{}
+	err := c.get(templatePath(namespace, name)+"/revisions/diff", query, res)
+	return res, err
+}
+
+// Search returns at most limit templates matching the query, all of them if limit is zero
+func (c *Client) Search(q string, opts templateindex.FilterOptions, limit int) ([]templateindex.SearchResult, error) {
+	query := filterQuery(opts)
+	query.Set("q", q)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	res := []templateindex.SearchResult{}
+	err := c.get("/search", query, &res)
+	return res, err
+}
+
+// Recommend returns at most limit templates fitting the requirements, all of them if limit is zero
+func (c *Client) Recommend(opts templateindex.FilterOptions, req templateindex.Requirements, limit int) ([]templateindex.Recommendation, error) {
+	query := filterQuery(opts)
+	if req.Cores > 0 {
+		query.Set("cores", strconv.FormatInt(req.Cores, 10))
+	}
+	if req.Memory > 0 {
+		query.Set("memory", strconv.FormatInt(req.Memory, 10))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	res := []templateindex.Recommendation{}
+	err := c.get("/recommend", query, &res)
+	return res, err
+}
+
+// Facets counts the templates matching the options by each ledger
+func (c *Client) Facets(opts templateindex.FilterOptions) (map[string][]templateindex.Summary, error) {
+	res := map[string][]templateindex.Summary{}
+	err := c.get("/facets", filterQuery(opts), &res)
+	return res, err
+}
+
+// Deprecations describes the deprecated templates matching the options
+func (c *Client) Deprecations(opts templateindex.FilterOptions) ([]templateindex.Description, error) {
+	res := []templateindex.Description{}
+	err := c.get("/deprecations", filterQuery(opts), &res)
+	return res, err
+}
+
+// Summaries summarizes the templates using the ledger served at route, without the API prefix, like "/oses".
+// If counts, each entry has the number of the templates matching it.
+func (c *Client) Summaries(route string, opts templateindex.FilterOptions, counts bool) ([]templateindex.Summary, error) {
+	query := filterQuery(opts)
+	if counts {
+		query.Set("counts", "true")
+	}
+	res := []templateindex.Summary{}
+	err := c.get(route, query, &res)
+	return res, err
+}
+
+// GroupedSummaries is like Summaries, but groups the entries, e.g. by "family"
+func (c *Client) GroupedSummaries(route, group string, opts templateindex.FilterOptions) ([]templateindex.SummaryGroup, error) {
+	query := filterQuery(opts)
+	query.Set("group", group)
+	res := []templateindex.SummaryGroup{}
+	err := c.get(route, query, &res)
+	return res, err
+}
+
+// OSes summarizes the templates by operating system, using the default route
+func (c *Client) OSes(opts templateindex.FilterOptions) ([]templateindex.Summary, error) {
+	return c.Summaries("/oses", opts, false)
+}
+
+// Workloads summarizes the templates by workload, using the default route
+func (c *Client) Workloads(opts templateindex.FilterOptions) ([]templateindex.Summary, error) {
+	return c.Summaries("/workloads", opts, false)
+}
+
+// Sizes summarizes the templates by size, using the default route
+func (c *Client) Sizes(opts templateindex.FilterOptions) ([]templateindex.Summary, error) {
+	return c.Summaries("/sizes", opts, false)
+}
+
+// OpenAPI returns the OpenAPI document of the HTTP API
+func (c *Client) OpenAPI() (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	err := c.get("/openapi.json", nil, &res)
+	return res, err
+}
+
+// Icon returns the image of the icon and its media type. The descriptions link the icons
+// in their IconURL, which ends with the ID.
+func (c *Client) Icon(id string) ([]byte, string, error) {
+	resp, err := c.do("/icons/"+id, nil, "image/svg+xml, image/png")
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+func (c *Client) get(path string, query url.Values, res interface{}) error {
+	resp, err := c.do(path, query, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// do sends the request, returning the response if it is a success, which the caller must close
+func (c *Client) do(path string, query url.Values, accept string) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += APIPath + path
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if len(c.langs) > 0 {
+		req.Header.Set("Accept-Language", strings.Join(c.langs, ", "))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		apiErr := &Error{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+func templatePath(namespace, name string) string {
+	return "/templates/" + namespace + "/" + name
+}
+
+func filterQuery(opts templateindex.FilterOptions) url.Values {
+	query := url.Values{}
+	for key, value := range opts {
+		query.Set(key, value)
+	}
+	return query
+}
@@ -0,0 +1,309 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/routes"
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+func setupServer(t *testing.T) (*httptest.Server, []templatev1.Template) {
+	templates, err := testutils.LoadTemplates("../templateindex/test-data-alltemplates.yaml")
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	for i := range templates {
+		templates[i].Namespace = "openshift"
+	}
+
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", templateindex.NewOSLedger(templateindex.NewJSONLedger("os")))
+	ti.AddLedger("workload", templateindex.NewJSONLedger("workload"))
+	ti.AddLedger("size", templateindex.NewJSONLedger("flavor"))
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Fatalf("failed to add test templates! %v", err)
+	}
+
+	summaryRoutes := routes.Routes{
+		routes.SummaryRoute("os", "/oses", "os"),
+		routes.SummaryRoute("workload", "/workloads", "workload"),
+		routes.SummaryRoute("size", "/sizes", "size"),
+	}
+	return httptest.NewServer(routes.Handler(ti, logf.NullLogger{}, summaryRoutes)), templates
+}
+
+func setupClient(t *testing.T, server *httptest.Server) *Client {
+	c, err := New(server.URL + "/")
+	if err != nil {
+		t.Fatalf("cannot create the client: %v", err)
+	}
+	return c
+}
+
+func TestNewInvalidURL(t *testing.T) {
+	if _, err := New("ftp://example.com"); err == nil {
+		t.Errorf("unexpected success")
+	}
+}
+
+func TestClientTemplates(t *testing.T) {
+	server, templates := setupServer(t)
+	defer server.Close()
+	c := setupClient(t, server)
+
+	descs, err := c.Templates(templateindex.FilterOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(descs) != len(templates) {
+		t.Errorf("unexpected templates: %v expected %v", len(descs), len(templates))
+	}
+
+	oses, err := c.OSes(templateindex.FilterOptions{})
+	if err != nil || len(oses) == 0 {
+		t.Fatalf("unexpected oses: %v %v", oses, err)
+	}
+	filtered, err := c.Templates(templateindex.FilterOptions{"os": oses[0].ID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(filtered) == 0 || len(filtered) > len(descs) {
+		t.Errorf("unexpected filtered templates: %v", len(filtered))
+	}
+	for _, desc := range filtered {
+		if desc.OS != oses[0].ID {
+			t.Errorf("template %v has os %v expected %v", desc.Name, desc.OS, oses[0].ID)
+		}
+	}
+}
+
+func TestClientTemplate(t *testing.T) {
+	server, templates := setupServer(t)
+	defer server.Close()
+	c := setupClient(t, server)
+
+	tmpl, err := c.Template("openshift", templates[0].Name, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tmpl.Name != templates[0].Name || len(tmpl.Objects) != len(templates[0].Objects) {
+		t.Errorf("unexpected template: %v", tmpl.Name)
+	}
+
+	_, err = c.Template("openshift", "does-not-exist", "")
+	if !IsNotFound(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	history, err := c.Revisions("openshift", templates[0].Name)
+	if err != nil || len(history.Revisions) == 0 {
+		t.Errorf("unexpected revisions: %v %v", history, err)
+	}
+}
+
+func TestClientSummaries(t *testing.T) {
+	server, templates := setupServer(t)
+	defer server.Close()
+	c := setupClient(t, server)
+
+	for _, route := range []string{"/oses", "/workloads", "/sizes"} {
+		summaries, err := c.Summaries(route, templateindex.FilterOptions{}, true)
+		if err != nil || len(summaries) == 0 {
+			t.Errorf("unexpected summaries for %v: %v %v", route, summaries, err)
+		}
+		total := 0
+		for _, summary := range summaries {
+			total += summary.Count
+		}
+		if total == 0 || total > len(templates)*len(summaries) {
+			t.Errorf("unexpected counts for %v: %v", route, total)
+		}
+	}
+
+	if _, err := c.GroupedSummaries("/oses", "bogus", templateindex.FilterOptions{}); err == nil {
+		t.Errorf("unexpected success grouping by bogus")
+	} else if apiErr, ok := err.(*Error); !ok || apiErr.StatusCode != 400 {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestClientSearchRecommend(t *testing.T) {
+	server, _ := setupServer(t)
+	defer server.Close()
+	c := setupClient(t, server)
+
+	results, err := c.Search("fedora", templateindex.FilterOptions{}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) == 0 || len(results) > 2 {
+		t.Errorf("unexpected results: %v", len(results))
+	}
+
+	recommendations, err := c.Recommend(templateindex.FilterOptions{}, templateindex.Requirements{Cores: 1, Memory: 1 << 30}, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recommendations) == 0 || len(recommendations) > 3 {
+		t.Errorf("unexpected recommendations: %v", len(recommendations))
+	}
+}
+
+func TestClientOpenAPI(t *testing.T) {
+	server, _ := setupServer(t)
+	defer server.Close()
+	c := setupClient(t, server)
+
+	doc, err := c.OpenAPI()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	paths, ok := doc["paths"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing paths: %v", doc)
+	}
+	for _, path := range []string{"/api/v1/templates", "/api/v1/templates/{namespace}/{name}", "/api/v1/sizes", "/api/v1/openapi.json", "/metrics"} {
+		if _, ok := paths[path].(map[string]interface{})["get"]; !ok {
+			t.Errorf("missing path: %v", path)
+		}
+	}
+	legacy, ok := paths["/templates"].(map[string]interface{})["get"].(map[string]interface{})
+	if !ok || legacy["deprecated"] != true {
+		t.Errorf("unexpected legacy path: %v", legacy)
+	}
+
+	// the descriptions served must match their schema
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	schema, ok := schemas["templateindex.Description"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing schema of the descriptions: %v", schemas)
+	}
+	properties := schema["properties"].(map[string]interface{})
+
+	descs, err := c.Templates(templateindex.FilterOptions{})
+	if err != nil || len(descs) == 0 {
+		t.Fatalf("unexpected templates: %v %v", descs, err)
+	}
+	for _, desc := range descs {
+		data, _ := json.Marshal(desc)
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for name := range fields {
+			if _, ok := properties[name]; !ok {
+				t.Errorf("field %v of %v missing from the schema", name, desc.Name)
+			}
+		}
+		for _, name := range schema["required"].([]interface{}) {
+			if _, ok := fields[name.(string)]; !ok {
+				t.Errorf("required field %v missing from %v", name, desc.Name)
+			}
+		}
+	}
+}
+
+func TestDeprecatedRootPaths(t *testing.T) {
+	server, _ := setupServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/oses")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "true" {
+		t.Errorf("unexpected response: %v %v", resp.StatusCode, resp.Header)
+	}
+	if link := resp.Header.Get("Link"); link != `</api/v1/oses>; rel="successor-version"` {
+		t.Errorf("unexpected link: %v", link)
+	}
+
+	resp, err = http.Get(server.URL + "/api/v1/oses")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "" {
+		t.Errorf("unexpected response: %v %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestClientIcon(t *testing.T) {
+	templates, err := testutils.LoadTemplates("../templateindex/test-data-alltemplates.yaml")
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	templates[0].Annotations[templateindex.IconDataAnnotation] = "data:image/svg+xml,%3Csvg/%3E"
+
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	ti.SetIcons(nil, routes.IconsPath())
+	ti.Set(&templates[0])
+	server := httptest.NewServer(routes.Handler(ti, logf.NullLogger{}, nil))
+	defer server.Close()
+	c := setupClient(t, server)
+
+	descs, err := c.Templates(templateindex.FilterOptions{})
+	if err != nil || len(descs) != 1 {
+		t.Fatalf("unexpected descriptions: %v %v", descs, err)
+	}
+	iconURL := descs[0].IconURL
+	if !strings.HasPrefix(iconURL, APIPath+"/icons/") {
+		t.Fatalf("unexpected icon URL: %q", iconURL)
+	}
+	data, contentType, err := c.Icon(strings.TrimPrefix(iconURL, APIPath+"/icons/"))
+	if err != nil || contentType != "image/svg+xml" || string(data) != "<svg/>" {
+		t.Errorf("unexpected icon: %q %v %v", data, contentType, err)
+	}
+	if _, _, err := c.Icon("icon-missing"); !IsNotFound(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	resp, err := http.Get(server.URL + iconURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" || !strings.Contains(resp.Header.Get("Cache-Control"), "immutable") {
+		t.Errorf("unexpected caching headers: %v", resp.Header)
+	}
+	req, _ := http.NewRequest("GET", server.URL+iconURL, nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("unexpected status: %v", resp.StatusCode)
+	}
+}
@@ -0,0 +1,34 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package grpcapi
+
+import (
+	"encoding/json"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative templateindexer.proto
+
+// DecodeTemplate decodes the template of the response
+func (res *GetTemplateResponse) DecodeTemplate() (*templatev1.Template, error) {
+	t := &templatev1.Template{}
+	err := json.Unmarshal(res.GetTemplate(), t)
+	return t, err
+}
@@ -0,0 +1,1147 @@
+//
+// This file is part of the KubeVirt project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Copyright 2018 Red Hat, Inc.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: templateindexer.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type WatchEvent_Type int32
+
+const (
+	WatchEvent_TYPE_UNSPECIFIED WatchEvent_Type = 0
+	WatchEvent_ADDED            WatchEvent_Type = 1
+	WatchEvent_MODIFIED         WatchEvent_Type = 2
+	WatchEvent_DELETED          WatchEvent_Type = 3
+)
+
+// Enum value maps for WatchEvent_Type.
+var (
+	WatchEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "ADDED",
+		2: "MODIFIED",
+		3: "DELETED",
+	}
+	WatchEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"ADDED":            1,
+		"MODIFIED":         2,
+		"DELETED":          3,
+	}
+)
+
+func (x WatchEvent_Type) Enum() *WatchEvent_Type {
+	p := new(WatchEvent_Type)
+	*p = x
+	return p
+}
+
+func (x WatchEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (WatchEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_templateindexer_proto_enumTypes[0].Descriptor()
+}
+
+func (WatchEvent_Type) Type() protoreflect.EnumType {
+	return &file_templateindexer_proto_enumTypes[0]
+}
+
+func (x WatchEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use WatchEvent_Type.Descriptor instead.
+func (WatchEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{12, 0}
+}
+
+type OSInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Vendor        string                 `protobuf:"bytes,1,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	Family        string                 `protobuf:"bytes,2,opt,name=family,proto3" json:"family,omitempty"`
+	Distro        string                 `protobuf:"bytes,3,opt,name=distro,proto3" json:"distro,omitempty"`
+	Version       string                 `protobuf:"bytes,4,opt,name=version,proto3" json:"version,omitempty"`
+	ReleaseDate   string                 `protobuf:"bytes,5,opt,name=release_date,json=releaseDate,proto3" json:"release_date,omitempty"`
+	EolDate       string                 `protobuf:"bytes,6,opt,name=eol_date,json=eolDate,proto3" json:"eol_date,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OSInfo) Reset() {
+	*x = OSInfo{}
+	mi := &file_templateindexer_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OSInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OSInfo) ProtoMessage() {}
+
+func (x *OSInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OSInfo.ProtoReflect.Descriptor instead.
+func (*OSInfo) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *OSInfo) GetVendor() string {
+	if x != nil {
+		return x.Vendor
+	}
+	return ""
+}
+
+func (x *OSInfo) GetFamily() string {
+	if x != nil {
+		return x.Family
+	}
+	return ""
+}
+
+func (x *OSInfo) GetDistro() string {
+	if x != nil {
+		return x.Distro
+	}
+	return ""
+}
+
+func (x *OSInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *OSInfo) GetReleaseDate() string {
+	if x != nil {
+		return x.ReleaseDate
+	}
+	return ""
+}
+
+func (x *OSInfo) GetEolDate() string {
+	if x != nil {
+		return x.EolDate
+	}
+	return ""
+}
+
+type Summary struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name  string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// how many templates have this id. Filled only on request.
+	Count int32 `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	// only the OS ledger fills this
+	OsInfo        *OSInfo `protobuf:"bytes,4,opt,name=os_info,json=osInfo,proto3" json:"os_info,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Summary) Reset() {
+	*x = Summary{}
+	mi := &file_templateindexer_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Summary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Summary) ProtoMessage() {}
+
+func (x *Summary) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Summary.ProtoReflect.Descriptor instead.
+func (*Summary) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Summary) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Summary) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Summary) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *Summary) GetOsInfo() *OSInfo {
+	if x != nil {
+		return x.OsInfo
+	}
+	return nil
+}
+
+type Lifecycle struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deprecated    bool                   `protobuf:"varint,1,opt,name=deprecated,proto3" json:"deprecated,omitempty"`
+	ReplacedBy    string                 `protobuf:"bytes,2,opt,name=replaced_by,json=replacedBy,proto3" json:"replaced_by,omitempty"`
+	EndOfSupport  string                 `protobuf:"bytes,3,opt,name=end_of_support,json=endOfSupport,proto3" json:"end_of_support,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Lifecycle) Reset() {
+	*x = Lifecycle{}
+	mi := &file_templateindexer_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Lifecycle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Lifecycle) ProtoMessage() {}
+
+func (x *Lifecycle) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Lifecycle.ProtoReflect.Descriptor instead.
+func (*Lifecycle) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Lifecycle) GetDeprecated() bool {
+	if x != nil {
+		return x.Deprecated
+	}
+	return false
+}
+
+func (x *Lifecycle) GetReplacedBy() string {
+	if x != nil {
+		return x.ReplacedBy
+	}
+	return ""
+}
+
+func (x *Lifecycle) GetEndOfSupport() string {
+	if x != nil {
+		return x.EndOfSupport
+	}
+	return ""
+}
+
+type Values struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []string               `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Values) Reset() {
+	*x = Values{}
+	mi := &file_templateindexer_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Values) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Values) ProtoMessage() {}
+
+func (x *Values) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Values.ProtoReflect.Descriptor instead.
+func (*Values) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Values) GetValues() []string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type Description struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Summary     *Summary               `protobuf:"bytes,1,opt,name=summary,proto3" json:"summary,omitempty"`
+	Description string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	IconId      string                 `protobuf:"bytes,3,opt,name=icon_id,json=iconId,proto3" json:"icon_id,omitempty"`
+	OsId        string                 `protobuf:"bytes,4,opt,name=os_id,json=osId,proto3" json:"os_id,omitempty"`
+	Workload    string                 `protobuf:"bytes,5,opt,name=workload,proto3" json:"workload,omitempty"`
+	Size        string                 `protobuf:"bytes,6,opt,name=size,proto3" json:"size,omitempty"`
+	// the version of the schema of the template
+	Version string `protobuf:"bytes,7,opt,name=version,proto3" json:"version,omitempty"`
+	// the API version of the VM object
+	VmApiVersion string     `protobuf:"bytes,8,opt,name=vm_api_version,json=vmApiVersion,proto3" json:"vm_api_version,omitempty"`
+	Lifecycle    *Lifecycle `protobuf:"bytes,9,opt,name=lifecycle,proto3" json:"lifecycle,omitempty"`
+	// all the values of the template, for each ledger
+	Facets map[string]*Values `protobuf:"bytes,10,rep,name=facets,proto3" json:"facets,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// the path of the icon in the HTTP API; empty if it has none
+	IconUrl       string `protobuf:"bytes,11,opt,name=icon_url,json=iconUrl,proto3" json:"icon_url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Description) Reset() {
+	*x = Description{}
+	mi := &file_templateindexer_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Description) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Description) ProtoMessage() {}
+
+func (x *Description) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Description.ProtoReflect.Descriptor instead.
+func (*Description) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Description) GetSummary() *Summary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+func (x *Description) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Description) GetIconId() string {
+	if x != nil {
+		return x.IconId
+	}
+	return ""
+}
+
+func (x *Description) GetOsId() string {
+	if x != nil {
+		return x.OsId
+	}
+	return ""
+}
+
+func (x *Description) GetWorkload() string {
+	if x != nil {
+		return x.Workload
+	}
+	return ""
+}
+
+func (x *Description) GetSize() string {
+	if x != nil {
+		return x.Size
+	}
+	return ""
+}
+
+func (x *Description) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Description) GetVmApiVersion() string {
+	if x != nil {
+		return x.VmApiVersion
+	}
+	return ""
+}
+
+func (x *Description) GetLifecycle() *Lifecycle {
+	if x != nil {
+		return x.Lifecycle
+	}
+	return nil
+}
+
+func (x *Description) GetFacets() map[string]*Values {
+	if x != nil {
+		return x.Facets
+	}
+	return nil
+}
+
+func (x *Description) GetIconUrl() string {
+	if x != nil {
+		return x.IconUrl
+	}
+	return ""
+}
+
+type ListTemplatesRequest struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Filters           map[string]string      `protobuf:"bytes,1,rep,name=filters,proto3" json:"filters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	IncludeDeprecated bool                   `protobuf:"varint,2,opt,name=include_deprecated,json=includeDeprecated,proto3" json:"include_deprecated,omitempty"`
+	Languages         []string               `protobuf:"bytes,3,rep,name=languages,proto3" json:"languages,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *ListTemplatesRequest) Reset() {
+	*x = ListTemplatesRequest{}
+	mi := &file_templateindexer_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTemplatesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTemplatesRequest) ProtoMessage() {}
+
+func (x *ListTemplatesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTemplatesRequest.ProtoReflect.Descriptor instead.
+func (*ListTemplatesRequest) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListTemplatesRequest) GetFilters() map[string]string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *ListTemplatesRequest) GetIncludeDeprecated() bool {
+	if x != nil {
+		return x.IncludeDeprecated
+	}
+	return false
+}
+
+func (x *ListTemplatesRequest) GetLanguages() []string {
+	if x != nil {
+		return x.Languages
+	}
+	return nil
+}
+
+type ListTemplatesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Templates     []*Description         `protobuf:"bytes,1,rep,name=templates,proto3" json:"templates,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTemplatesResponse) Reset() {
+	*x = ListTemplatesResponse{}
+	mi := &file_templateindexer_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTemplatesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTemplatesResponse) ProtoMessage() {}
+
+func (x *ListTemplatesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTemplatesResponse.ProtoReflect.Descriptor instead.
+func (*ListTemplatesResponse) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListTemplatesResponse) GetTemplates() []*Description {
+	if x != nil {
+		return x.Templates
+	}
+	return nil
+}
+
+type GetTemplateRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Namespace string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name      string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// convert the VM objects to this API version; "current" is the newest supported
+	ApiVersion    string   `protobuf:"bytes,3,opt,name=api_version,json=apiVersion,proto3" json:"api_version,omitempty"`
+	Languages     []string `protobuf:"bytes,4,rep,name=languages,proto3" json:"languages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTemplateRequest) Reset() {
+	*x = GetTemplateRequest{}
+	mi := &file_templateindexer_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTemplateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTemplateRequest) ProtoMessage() {}
+
+func (x *GetTemplateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTemplateRequest.ProtoReflect.Descriptor instead.
+func (*GetTemplateRequest) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetTemplateRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *GetTemplateRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *GetTemplateRequest) GetApiVersion() string {
+	if x != nil {
+		return x.ApiVersion
+	}
+	return ""
+}
+
+func (x *GetTemplateRequest) GetLanguages() []string {
+	if x != nil {
+		return x.Languages
+	}
+	return nil
+}
+
+type GetTemplateResponse struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Description *Description           `protobuf:"bytes,1,opt,name=description,proto3" json:"description,omitempty"`
+	// the template, as a JSON encoded Kubernetes object
+	Template      []byte `protobuf:"bytes,2,opt,name=template,proto3" json:"template,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTemplateResponse) Reset() {
+	*x = GetTemplateResponse{}
+	mi := &file_templateindexer_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTemplateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTemplateResponse) ProtoMessage() {}
+
+func (x *GetTemplateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTemplateResponse.ProtoReflect.Descriptor instead.
+func (*GetTemplateResponse) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetTemplateResponse) GetDescription() *Description {
+	if x != nil {
+		return x.Description
+	}
+	return nil
+}
+
+func (x *GetTemplateResponse) GetTemplate() []byte {
+	if x != nil {
+		return x.Template
+	}
+	return nil
+}
+
+type SummarizeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the name of the ledger, like "os"
+	Ledger            string            `protobuf:"bytes,1,opt,name=ledger,proto3" json:"ledger,omitempty"`
+	Filters           map[string]string `protobuf:"bytes,2,rep,name=filters,proto3" json:"filters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	IncludeDeprecated bool              `protobuf:"varint,3,opt,name=include_deprecated,json=includeDeprecated,proto3" json:"include_deprecated,omitempty"`
+	// count the templates of each summary
+	Counts        bool     `protobuf:"varint,4,opt,name=counts,proto3" json:"counts,omitempty"`
+	Languages     []string `protobuf:"bytes,5,rep,name=languages,proto3" json:"languages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SummarizeRequest) Reset() {
+	*x = SummarizeRequest{}
+	mi := &file_templateindexer_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SummarizeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SummarizeRequest) ProtoMessage() {}
+
+func (x *SummarizeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SummarizeRequest.ProtoReflect.Descriptor instead.
+func (*SummarizeRequest) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SummarizeRequest) GetLedger() string {
+	if x != nil {
+		return x.Ledger
+	}
+	return ""
+}
+
+func (x *SummarizeRequest) GetFilters() map[string]string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *SummarizeRequest) GetIncludeDeprecated() bool {
+	if x != nil {
+		return x.IncludeDeprecated
+	}
+	return false
+}
+
+func (x *SummarizeRequest) GetCounts() bool {
+	if x != nil {
+		return x.Counts
+	}
+	return false
+}
+
+func (x *SummarizeRequest) GetLanguages() []string {
+	if x != nil {
+		return x.Languages
+	}
+	return nil
+}
+
+type SummarizeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Summaries     []*Summary             `protobuf:"bytes,1,rep,name=summaries,proto3" json:"summaries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SummarizeResponse) Reset() {
+	*x = SummarizeResponse{}
+	mi := &file_templateindexer_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SummarizeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SummarizeResponse) ProtoMessage() {}
+
+func (x *SummarizeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SummarizeResponse.ProtoReflect.Descriptor instead.
+func (*SummarizeResponse) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SummarizeResponse) GetSummaries() []*Summary {
+	if x != nil {
+		return x.Summaries
+	}
+	return nil
+}
+
+type WatchRequest struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Filters           map[string]string      `protobuf:"bytes,1,rep,name=filters,proto3" json:"filters,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	IncludeDeprecated bool                   `protobuf:"varint,2,opt,name=include_deprecated,json=includeDeprecated,proto3" json:"include_deprecated,omitempty"`
+	Languages         []string               `protobuf:"bytes,3,rep,name=languages,proto3" json:"languages,omitempty"`
+	// send the templates already in the index as ADDED events, before the changes
+	InitialTemplates bool `protobuf:"varint,4,opt,name=initial_templates,json=initialTemplates,proto3" json:"initial_templates,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_templateindexer_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *WatchRequest) GetFilters() map[string]string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *WatchRequest) GetIncludeDeprecated() bool {
+	if x != nil {
+		return x.IncludeDeprecated
+	}
+	return false
+}
+
+func (x *WatchRequest) GetLanguages() []string {
+	if x != nil {
+		return x.Languages
+	}
+	return nil
+}
+
+func (x *WatchRequest) GetInitialTemplates() bool {
+	if x != nil {
+		return x.InitialTemplates
+	}
+	return false
+}
+
+type WatchEvent struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Type      WatchEvent_Type        `protobuf:"varint,1,opt,name=type,proto3,enum=templateindexer.v1.WatchEvent_Type" json:"type,omitempty"`
+	Namespace string                 `protobuf:"bytes,2,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name      string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"`
+	// the template as it is now, or as it was when deleted
+	Description   *Description `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEvent) Reset() {
+	*x = WatchEvent{}
+	mi := &file_templateindexer_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEvent) ProtoMessage() {}
+
+func (x *WatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_templateindexer_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEvent.ProtoReflect.Descriptor instead.
+func (*WatchEvent) Descriptor() ([]byte, []int) {
+	return file_templateindexer_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *WatchEvent) GetType() WatchEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return WatchEvent_TYPE_UNSPECIFIED
+}
+
+func (x *WatchEvent) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *WatchEvent) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *WatchEvent) GetDescription() *Description {
+	if x != nil {
+		return x.Description
+	}
+	return nil
+}
+
+var File_templateindexer_proto protoreflect.FileDescriptor
+
+const file_templateindexer_proto_rawDesc = "" +
+	"\n" +
+	"\x15templateindexer.proto\x12\x12templateindexer.v1\"\xa8\x01\n" +
+	"\x06OSInfo\x12\x16\n" +
+	"\x06vendor\x18\x01 \x01(\tR\x06vendor\x12\x16\n" +
+	"\x06family\x18\x02 \x01(\tR\x06family\x12\x16\n" +
+	"\x06distro\x18\x03 \x01(\tR\x06distro\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\tR\aversion\x12!\n" +
+	"\frelease_date\x18\x05 \x01(\tR\vreleaseDate\x12\x19\n" +
+	"\beol_date\x18\x06 \x01(\tR\aeolDate\"x\n" +
+	"\aSummary\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x05R\x05count\x123\n" +
+	"\aos_info\x18\x04 \x01(\v2\x1a.templateindexer.v1.OSInfoR\x06osInfo\"r\n" +
+	"\tLifecycle\x12\x1e\n" +
+	"\n" +
+	"deprecated\x18\x01 \x01(\bR\n" +
+	"deprecated\x12\x1f\n" +
+	"\vreplaced_by\x18\x02 \x01(\tR\n" +
+	"replacedBy\x12$\n" +
+	"\x0eend_of_support\x18\x03 \x01(\tR\fendOfSupport\" \n" +
+	"\x06Values\x12\x16\n" +
+	"\x06values\x18\x01 \x03(\tR\x06values\"\xf8\x03\n" +
+	"\vDescription\x125\n" +
+	"\asummary\x18\x01 \x01(\v2\x1b.templateindexer.v1.SummaryR\asummary\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12\x17\n" +
+	"\aicon_id\x18\x03 \x01(\tR\x06iconId\x12\x13\n" +
+	"\x05os_id\x18\x04 \x01(\tR\x04osId\x12\x1a\n" +
+	"\bworkload\x18\x05 \x01(\tR\bworkload\x12\x12\n" +
+	"\x04size\x18\x06 \x01(\tR\x04size\x12\x18\n" +
+	"\aversion\x18\a \x01(\tR\aversion\x12$\n" +
+	"\x0evm_api_version\x18\b \x01(\tR\fvmApiVersion\x12;\n" +
+	"\tlifecycle\x18\t \x01(\v2\x1d.templateindexer.v1.LifecycleR\tlifecycle\x12C\n" +
+	"\x06facets\x18\n" +
+	" \x03(\v2+.templateindexer.v1.Description.FacetsEntryR\x06facets\x12\x19\n" +
+	"\bicon_url\x18\v \x01(\tR\aiconUrl\x1aU\n" +
+	"\vFacetsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x120\n" +
+	"\x05value\x18\x02 \x01(\v2\x1a.templateindexer.v1.ValuesR\x05value:\x028\x01\"\xf0\x01\n" +
+	"\x14ListTemplatesRequest\x12O\n" +
+	"\afilters\x18\x01 \x03(\v25.templateindexer.v1.ListTemplatesRequest.FiltersEntryR\afilters\x12-\n" +
+	"\x12include_deprecated\x18\x02 \x01(\bR\x11includeDeprecated\x12\x1c\n" +
+	"\tlanguages\x18\x03 \x03(\tR\tlanguages\x1a:\n" +
+	"\fFiltersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"V\n" +
+	"\x15ListTemplatesResponse\x12=\n" +
+	"\ttemplates\x18\x01 \x03(\v2\x1f.templateindexer.v1.DescriptionR\ttemplates\"\x85\x01\n" +
+	"\x12GetTemplateRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1f\n" +
+	"\vapi_version\x18\x03 \x01(\tR\n" +
+	"apiVersion\x12\x1c\n" +
+	"\tlanguages\x18\x04 \x03(\tR\tlanguages\"t\n" +
+	"\x13GetTemplateResponse\x12A\n" +
+	"\vdescription\x18\x01 \x01(\v2\x1f.templateindexer.v1.DescriptionR\vdescription\x12\x1a\n" +
+	"\btemplate\x18\x02 \x01(\fR\btemplate\"\x98\x02\n" +
+	"\x10SummarizeRequest\x12\x16\n" +
+	"\x06ledger\x18\x01 \x01(\tR\x06ledger\x12K\n" +
+	"\afilters\x18\x02 \x03(\v21.templateindexer.v1.SummarizeRequest.FiltersEntryR\afilters\x12-\n" +
+	"\x12include_deprecated\x18\x03 \x01(\bR\x11includeDeprecated\x12\x16\n" +
+	"\x06counts\x18\x04 \x01(\bR\x06counts\x12\x1c\n" +
+	"\tlanguages\x18\x05 \x03(\tR\tlanguages\x1a:\n" +
+	"\fFiltersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"N\n" +
+	"\x11SummarizeResponse\x129\n" +
+	"\tsummaries\x18\x01 \x03(\v2\x1b.templateindexer.v1.SummaryR\tsummaries\"\x8d\x02\n" +
+	"\fWatchRequest\x12G\n" +
+	"\afilters\x18\x01 \x03(\v2-.templateindexer.v1.WatchRequest.FiltersEntryR\afilters\x12-\n" +
+	"\x12include_deprecated\x18\x02 \x01(\bR\x11includeDeprecated\x12\x1c\n" +
+	"\tlanguages\x18\x03 \x03(\tR\tlanguages\x12+\n" +
+	"\x11initial_templates\x18\x04 \x01(\bR\x10initialTemplates\x1a:\n" +
+	"\fFiltersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xfe\x01\n" +
+	"\n" +
+	"WatchEvent\x127\n" +
+	"\x04type\x18\x01 \x01(\x0e2#.templateindexer.v1.WatchEvent.TypeR\x04type\x12\x1c\n" +
+	"\tnamespace\x18\x02 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12A\n" +
+	"\vdescription\x18\x04 \x01(\v2\x1f.templateindexer.v1.DescriptionR\vdescription\"B\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\t\n" +
+	"\x05ADDED\x10\x01\x12\f\n" +
+	"\bMODIFIED\x10\x02\x12\v\n" +
+	"\aDELETED\x10\x032\xfe\x02\n" +
+	"\x0fTemplateIndexer\x12d\n" +
+	"\rListTemplates\x12(.templateindexer.v1.ListTemplatesRequest\x1a).templateindexer.v1.ListTemplatesResponse\x12^\n" +
+	"\vGetTemplate\x12&.templateindexer.v1.GetTemplateRequest\x1a'.templateindexer.v1.GetTemplateResponse\x12X\n" +
+	"\tSummarize\x12$.templateindexer.v1.SummarizeRequest\x1a%.templateindexer.v1.SummarizeResponse\x12K\n" +
+	"\x05Watch\x12 .templateindexer.v1.WatchRequest\x1a\x1e.templateindexer.v1.WatchEvent0\x01B<Z:github.com/fromanirh/kubevirt-template-indexer/pkg/grpcapib\x06proto3"
+
+var (
+	file_templateindexer_proto_rawDescOnce sync.Once
+	file_templateindexer_proto_rawDescData []byte
+)
+
+func file_templateindexer_proto_rawDescGZIP() []byte {
+	file_templateindexer_proto_rawDescOnce.Do(func() {
+		file_templateindexer_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_templateindexer_proto_rawDesc), len(file_templateindexer_proto_rawDesc)))
+	})
+	return file_templateindexer_proto_rawDescData
+}
+
+var file_templateindexer_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_templateindexer_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_templateindexer_proto_goTypes = []any{
+	(WatchEvent_Type)(0),          // 0: templateindexer.v1.WatchEvent.Type
+	(*OSInfo)(nil),                // 1: templateindexer.v1.OSInfo
+	(*Summary)(nil),               // 2: templateindexer.v1.Summary
+	(*Lifecycle)(nil),             // 3: templateindexer.v1.Lifecycle
+	(*Values)(nil),                // 4: templateindexer.v1.Values
+	(*Description)(nil),           // 5: templateindexer.v1.Description
+	(*ListTemplatesRequest)(nil),  // 6: templateindexer.v1.ListTemplatesRequest
+	(*ListTemplatesResponse)(nil), // 7: templateindexer.v1.ListTemplatesResponse
+	(*GetTemplateRequest)(nil),    // 8: templateindexer.v1.GetTemplateRequest
+	(*GetTemplateResponse)(nil),   // 9: templateindexer.v1.GetTemplateResponse
+	(*SummarizeRequest)(nil),      // 10: templateindexer.v1.SummarizeRequest
+	(*SummarizeResponse)(nil),     // 11: templateindexer.v1.SummarizeResponse
+	(*WatchRequest)(nil),          // 12: templateindexer.v1.WatchRequest
+	(*WatchEvent)(nil),            // 13: templateindexer.v1.WatchEvent
+	nil,                           // 14: templateindexer.v1.Description.FacetsEntry
+	nil,                           // 15: templateindexer.v1.ListTemplatesRequest.FiltersEntry
+	nil,                           // 16: templateindexer.v1.SummarizeRequest.FiltersEntry
+	nil,                           // 17: templateindexer.v1.WatchRequest.FiltersEntry
+}
+var file_templateindexer_proto_depIdxs = []int32{
+	1,  // 0: templateindexer.v1.Summary.os_info:type_name -> templateindexer.v1.OSInfo
+	2,  // 1: templateindexer.v1.Description.summary:type_name -> templateindexer.v1.Summary
+	3,  // 2: templateindexer.v1.Description.lifecycle:type_name -> templateindexer.v1.Lifecycle
+	14, // 3: templateindexer.v1.Description.facets:type_name -> templateindexer.v1.Description.FacetsEntry
+	15, // 4: templateindexer.v1.ListTemplatesRequest.filters:type_name -> templateindexer.v1.ListTemplatesRequest.FiltersEntry
+	5,  // 5: templateindexer.v1.ListTemplatesResponse.templates:type_name -> templateindexer.v1.Description
+	5,  // 6: templateindexer.v1.GetTemplateResponse.description:type_name -> templateindexer.v1.Description
+	16, // 7: templateindexer.v1.SummarizeRequest.filters:type_name -> templateindexer.v1.SummarizeRequest.FiltersEntry
+	2,  // 8: templateindexer.v1.SummarizeResponse.summaries:type_name -> templateindexer.v1.Summary
+	17, // 9: templateindexer.v1.WatchRequest.filters:type_name -> templateindexer.v1.WatchRequest.FiltersEntry
+	0,  // 10: templateindexer.v1.WatchEvent.type:type_name -> templateindexer.v1.WatchEvent.Type
+	5,  // 11: templateindexer.v1.WatchEvent.description:type_name -> templateindexer.v1.Description
+	4,  // 12: templateindexer.v1.Description.FacetsEntry.value:type_name -> templateindexer.v1.Values
+	6,  // 13: templateindexer.v1.TemplateIndexer.ListTemplates:input_type -> templateindexer.v1.ListTemplatesRequest
+	8,  // 14: templateindexer.v1.TemplateIndexer.GetTemplate:input_type -> templateindexer.v1.GetTemplateRequest
+	10, // 15: templateindexer.v1.TemplateIndexer.Summarize:input_type -> templateindexer.v1.SummarizeRequest
+	12, // 16: templateindexer.v1.TemplateIndexer.Watch:input_type -> templateindexer.v1.WatchRequest
+	7,  // 17: templateindexer.v1.TemplateIndexer.ListTemplates:output_type -> templateindexer.v1.ListTemplatesResponse
+	9,  // 18: templateindexer.v1.TemplateIndexer.GetTemplate:output_type -> templateindexer.v1.GetTemplateResponse
+	11, // 19: templateindexer.v1.TemplateIndexer.Summarize:output_type -> templateindexer.v1.SummarizeResponse
+	13, // 20: templateindexer.v1.TemplateIndexer.Watch:output_type -> templateindexer.v1.WatchEvent
+	17, // [17:21] is the sub-list for method output_type
+	13, // [13:17] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_templateindexer_proto_init() }
+func file_templateindexer_proto_init() {
+	if File_templateindexer_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_templateindexer_proto_rawDesc), len(file_templateindexer_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   17,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_templateindexer_proto_goTypes,
+		DependencyIndexes: file_templateindexer_proto_depIdxs,
+		EnumInfos:         file_templateindexer_proto_enumTypes,
+		MessageInfos:      file_templateindexer_proto_msgTypes,
+	}.Build()
+	File_templateindexer_proto = out.File
+	file_templateindexer_proto_goTypes = nil
+	file_templateindexer_proto_depIdxs = nil
+}
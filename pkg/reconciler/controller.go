@@ -31,6 +31,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/sources"
 	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
 )
 
@@ -38,10 +39,12 @@ type TemplateReconciler struct {
 	// client can be used to retrieve objects from the APIServer.
 	client client.Client
 	log    logr.Logger
-	index  *templateindex.TemplateIndexer
+	index  sources.Indexer
+	// the templates to index, all if nil
+	filter *sources.Filter
 }
 
-func NewTemplateReconciler(client client.Client, log logr.Logger, index *templateindex.TemplateIndexer) *TemplateReconciler {
+func NewTemplateReconciler(client client.Client, log logr.Logger, index sources.Indexer) *TemplateReconciler {
 	return &TemplateReconciler{
 		client: client,
 		log:    log,
@@ -54,7 +57,8 @@ func (tr *TemplateReconciler) SyncWithCluster(namespace string) error {
 	templates := &templatev1.TemplateList{}
 
 	opts := &client.ListOptions{
-		Namespace: namespace,
+		Namespace:     namespace,
+		LabelSelector: tr.filter.Selector(),
 	}
 	err := tr.client.List(context.TODO(), opts, templates)
 	if err != nil {
@@ -62,15 +66,29 @@ func (tr *TemplateReconciler) SyncWithCluster(namespace string) error {
 		return err
 	}
 
-	tr.log.Info(fmt.Sprintf("syncing %v templates", len(templates.Items)))
-	start := time.Now()
-	count, err := tr.index.AddTemplates(templates.Items)
-	end := time.Now()
+	selected := []templatev1.Template{}
+	for i := range templates.Items {
+		if tr.filter.Matches(&templates.Items[i]) {
+			selected = append(selected, templates.Items[i])
+		}
+	}
 
-	if err != nil {
-		tr.log.Error(err, "failed to sync existing templates")
-		return err
+	tr.log.Info(fmt.Sprintf("syncing %v templates (%v skipped)", len(selected), len(templates.Items)-len(selected)))
+	start := time.Now()
+	count := 0
+	for i := range selected {
+		err := tr.index.SetFrom(sources.SourceTemplates, &selected[i])
+		if templateindex.IsConflict(err) {
+			tr.log.Info(fmt.Sprintf("skipping template: %v", err))
+			continue
+		}
+		if err != nil {
+			tr.log.Error(err, "failed to sync existing templates")
+			return err
+		}
+		count += 1
 	}
+	end := time.Now()
 
 	tr.log.Info(fmt.Sprintf("synced %v templates in %v", count, end.Sub(start)))
 	return nil
@@ -87,8 +105,8 @@ func (tr *TemplateReconciler) Reconcile(request reconcile.Request) (reconcile.Re
 	t := &templatev1.Template{}
 	err := tr.client.Get(context.TODO(), request.NamespacedName, t)
 	if errors.IsNotFound(err) {
-		log.Error(nil, "could not find Template")
-		return reconcile.Result{}, nil
+		log.Info("Template deleted")
+		return reconcile.Result{}, tr.index.DeleteFrom(sources.SourceTemplates, request.Namespace, request.Name)
 	}
 
 	if err != nil {
@@ -96,5 +114,18 @@ func (tr *TemplateReconciler) Reconcile(request reconcile.Request) (reconcile.Re
 		return reconcile.Result{}, err
 	}
 
-	return reconcile.Result{}, tr.index.Update(t)
+	if !tr.filter.Matches(t) {
+		// it may have been selected before
+		log.Info("Template not selected")
+		return reconcile.Result{}, tr.index.DeleteFrom(sources.SourceTemplates, t.Namespace, t.Name)
+	}
+
+	// the cache resyncs deliver again the same resourceVersion: setting it is harmless
+	err = tr.index.SetFrom(sources.SourceTemplates, t)
+	if templateindex.IsConflict(err) {
+		// retrying would not help: the template is indexed once the other one is deleted and this one changes
+		log.Info(fmt.Sprintf("Template not indexed: %v", err))
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{}, err
 }
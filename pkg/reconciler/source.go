@@ -0,0 +1,122 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package reconciler
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/sources"
+)
+
+// TemplateSource indexes the OpenShift templates of one namespace, using a controller run by its own manager,
+// so each namespace has its own cache.
+type TemplateSource struct {
+	manager    manager.Manager
+	reconciler *TemplateReconciler
+	controller controller.Controller
+	namespace  string
+	filter     *sources.Filter
+}
+
+// NewTemplateSource creates a TemplateSource indexing only the templates selected by filter (all if nil).
+// The empty namespace means all of them.
+func NewTemplateSource(cfg *rest.Config, namespace string, filter *sources.Filter, log logr.Logger, index sources.Indexer) (*TemplateSource, error) {
+	mgr, err := manager.New(cfg, manager.Options{
+		Namespace: namespace,
+		// there may be many managers, and the HTTP port is ours
+		MetricsBindAddress: "0",
+	})
+	if err != nil {
+		return nil, err
+	}
+	tr := NewTemplateReconciler(mgr.GetClient(), log, index)
+	tr.filter = filter
+	c, err := controller.New("foo-controller", mgr, controller.Options{
+		Reconciler: tr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateSource{
+		manager:    mgr,
+		reconciler: tr,
+		controller: c,
+		namespace:  namespace,
+		filter:     filter,
+	}, nil
+}
+
+func (ts *TemplateSource) Name() string {
+	return sources.SourceTemplates
+}
+
+func (ts *TemplateSource) Sync() error {
+	return ts.reconciler.SyncWithCluster(ts.namespace)
+}
+
+// Start sets up the watch, and runs the manager until stop is closed
+func (ts *TemplateSource) Start(stop <-chan struct{}) error {
+	err := ts.controller.Watch(&source.Kind{Type: &templatev1.Template{}}, &handler.EnqueueRequestForObject{}, ts.predicate())
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := ts.manager.Start(stop); err != nil {
+			ts.reconciler.log.Error(err, fmt.Sprintf("unable to run the manager of namespace %q", ts.namespace))
+		}
+	}()
+	return nil
+}
+
+// predicate drops the events of the templates not selected by the filter.
+// The updates are kept if either version is selected, so the templates no longer selected are removed.
+func (ts *TemplateSource) predicate() predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return ts.selected(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return ts.selected(e.ObjectOld) || ts.selected(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return ts.selected(e.Object)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return ts.selected(e.Object)
+		},
+	}
+}
+
+func (ts *TemplateSource) selected(obj runtime.Object) bool {
+	t, ok := obj.(*templatev1.Template)
+	return ok && ts.filter.Matches(t)
+}
@@ -0,0 +1,69 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package sources
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+// Filter selects the templates to index. The nil Filter selects all of them.
+type Filter struct {
+	selector labels.Selector
+	vmOnly   bool
+}
+
+// NewFilter creates a Filter for the Kubernetes label selector, like "template.cnv.io/type=base".
+// If vmOnly is set, only the templates creating a kubevirt.io VirtualMachine are selected.
+func NewFilter(selector string, vmOnly bool) (*Filter, error) {
+	sel := labels.Everything()
+	if selector != "" {
+		var err error
+		sel, err = labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Filter{
+		selector: sel,
+		vmOnly:   vmOnly,
+	}, nil
+}
+
+// Selector returns the label selector, to be used when listing and watching the objects
+func (f *Filter) Selector() labels.Selector {
+	if f == nil {
+		return labels.Everything()
+	}
+	return f.selector
+}
+
+// Matches tells if the template must be indexed
+func (f *Filter) Matches(t *templatev1.Template) bool {
+	if f == nil {
+		return true
+	}
+	if !f.selector.Matches(labels.Set(t.Labels)) {
+		return false
+	}
+	return !f.vmOnly || templateindex.HasVirtualMachine(t)
+}
@@ -0,0 +1,346 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package sources
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// NamespaceIndexer is an Indexer which can drop all the templates of a namespace; the TemplateIndexer implements it
+type NamespaceIndexer interface {
+	Indexer
+	DeleteNamespace(namespace string) (int, error)
+}
+
+// SourceFactory creates the sources of the templates of the namespace, which must put them in index
+type SourceFactory func(namespace string, index Indexer) ([]Source, error)
+
+// NamespaceSet runs the sources of a set of namespaces: the ones given by name, and the ones matching
+// a label selector, which are added and removed while they come and go.
+// When a namespace is dropped, all its templates are removed from the index.
+type NamespaceSet struct {
+	client   corev1client.NamespaceInterface
+	names    []string
+	selector labels.Selector
+	factory  SourceFactory
+	index    NamespaceIndexer
+	sync     bool
+	log      logr.Logger
+
+	lock            sync.Mutex
+	running         map[string]*namespaceSources
+	stopped         bool
+	resourceVersion string
+}
+
+type namespaceSources struct {
+	stop  chan struct{}
+	index *guardedIndexer
+}
+
+// NewNamespaceSet creates a NamespaceSet for the given names. The empty name stands for all the namespaces.
+// If selector is nil, the namespaces are not watched and client can be nil.
+// If sync is set, the sources of each namespace are synced before to start them.
+func NewNamespaceSet(client corev1client.NamespaceInterface, names []string, selector labels.Selector, factory SourceFactory, index NamespaceIndexer, sync bool, log logr.Logger) *NamespaceSet {
+	return &NamespaceSet{
+		client:   client,
+		names:    names,
+		selector: selector,
+		factory:  factory,
+		index:    index,
+		sync:     sync,
+		log:      log,
+		running:  make(map[string]*namespaceSources),
+	}
+}
+
+// Namespaces returns the namespaces currently indexed
+func (ns *NamespaceSet) Namespaces() []string {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	names := []string{}
+	for name := range ns.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start the sources of the namespaces given by name, and of the ones currently matching the selector,
+// then watch for the namespaces matching the selector, until stop is closed. Does not block.
+func (ns *NamespaceSet) Start(stop <-chan struct{}) error {
+	for _, name := range ns.names {
+		if err := ns.add(name); err != nil {
+			ns.stopAll()
+			return err
+		}
+	}
+	if ns.selector == nil {
+		go func() {
+			<-stop
+			ns.stopAll()
+		}()
+		return nil
+	}
+
+	if err := ns.Sync(); err != nil {
+		ns.stopAll()
+		return err
+	}
+	go ns.run(stop)
+	return nil
+}
+
+// Sync adds the namespaces matching the selector, and drops the ones which no longer match
+func (ns *NamespaceSet) Sync() error {
+	list, err := ns.client.List(metav1.ListOptions{LabelSelector: ns.selector.String()})
+	if err != nil {
+		ns.log.Error(err, "failed to list namespaces")
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for i := range list.Items {
+		name := list.Items[i].Name
+		seen[name] = true
+		if err := ns.add(name); err != nil {
+			ns.log.Error(err, fmt.Sprintf("cannot index namespace %s", name))
+		}
+	}
+	for _, name := range ns.Namespaces() {
+		if !seen[name] {
+			ns.drop(name)
+		}
+	}
+	ns.resourceVersion = list.ResourceVersion
+	return nil
+}
+
+// run watches the namespaces, listing them again every time the watch breaks
+func (ns *NamespaceSet) run(stop <-chan struct{}) {
+	defer ns.stopAll()
+	for {
+		err := ns.watch(stop)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err != nil {
+			ns.log.Error(err, "failed to watch namespaces")
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(retryInterval):
+		}
+		if err := ns.Sync(); err != nil {
+			ns.resourceVersion = ""
+		}
+	}
+}
+
+func (ns *NamespaceSet) watch(stop <-chan struct{}) error {
+	w, err := ns.client.Watch(metav1.ListOptions{
+		LabelSelector:   ns.selector.String(),
+		ResourceVersion: ns.resourceVersion,
+	})
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			if event.Type == watch.Error {
+				return fmt.Errorf("watch error: %v", event.Object)
+			}
+			namespace, ok := event.Object.(*corev1.Namespace)
+			if !ok {
+				continue
+			}
+			ns.handle(event.Type, namespace)
+			ns.resourceVersion = namespace.ResourceVersion
+		}
+	}
+}
+
+func (ns *NamespaceSet) handle(eventType watch.EventType, namespace *corev1.Namespace) {
+	// the watch reports as deleted also the namespaces whose labels no longer match the selector
+	if eventType == watch.Deleted || namespace.Status.Phase == corev1.NamespaceTerminating {
+		ns.drop(namespace.Name)
+		return
+	}
+	if err := ns.add(namespace.Name); err != nil {
+		ns.log.Error(err, fmt.Sprintf("cannot index namespace %s", namespace.Name))
+	}
+}
+
+// add starts the sources of the namespace, if they are not running yet.
+// The sources are synced without holding the lock: that may take long, and meanwhile the set must answer.
+func (ns *NamespaceSet) add(name string) error {
+	ns.lock.Lock()
+	_, ok := ns.running[name]
+	ns.lock.Unlock()
+	if ok {
+		return nil
+	}
+
+	run := &namespaceSources{
+		stop:  make(chan struct{}),
+		index: &guardedIndexer{index: ns.index},
+	}
+	srcs, err := ns.factory(name, run.index)
+	if err != nil {
+		return err
+	}
+	for _, src := range srcs {
+		if ns.sync {
+			if err := src.Sync(); err != nil {
+				ns.cleanup(name, run)
+				return fmt.Errorf("unable to sync %s: %v", src.Name(), err)
+			}
+		}
+		if err := src.Start(run.stop); err != nil {
+			ns.cleanup(name, run)
+			return fmt.Errorf("unable to watch %s: %v", src.Name(), err)
+		}
+	}
+
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	if _, ok := ns.running[name]; ok || ns.stopped {
+		// added meanwhile, or the set was stopped: these sources are not needed
+		close(run.stop)
+		run.index.close()
+		return nil
+	}
+	ns.running[name] = run
+	ns.log.Info(fmt.Sprintf("indexing namespace %s", displayNamespace(name)))
+	return nil
+}
+
+// drop stops the sources of the namespace, and removes its templates from the index.
+// The namespaces given by name are never dropped.
+func (ns *NamespaceSet) drop(name string) {
+	for _, n := range ns.names {
+		if n == name {
+			return
+		}
+	}
+
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	run, ok := ns.running[name]
+	if !ok {
+		return
+	}
+	delete(ns.running, name)
+	ns.cleanup(name, run)
+}
+
+// cleanup stops the sources, and removes their templates
+func (ns *NamespaceSet) cleanup(name string, run *namespaceSources) {
+	close(run.stop)
+	// the sources may still be handling some events: make sure they no longer touch the index
+	run.index.close()
+	count, err := ns.index.DeleteNamespace(name)
+	if err != nil {
+		ns.log.Error(err, fmt.Sprintf("cannot remove the templates of namespace %s", name))
+		return
+	}
+	ns.log.Info(fmt.Sprintf("dropped namespace %s, removed %v templates", name, count))
+}
+
+// stopAll stops the sources of all the namespaces, leaving the index as it is
+func (ns *NamespaceSet) stopAll() {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	ns.stopped = true
+	for name, run := range ns.running {
+		close(run.stop)
+		delete(ns.running, name)
+	}
+}
+
+func displayNamespace(name string) string {
+	if name == "" {
+		return "(all)"
+	}
+	return name
+}
+
+// guardedIndexer forwards to the index until it is closed, then ignores all the changes
+type guardedIndexer struct {
+	lock   sync.RWMutex
+	index  Indexer
+	closed bool
+}
+
+func (gi *guardedIndexer) SetFrom(source string, t *templatev1.Template) error {
+	gi.lock.RLock()
+	defer gi.lock.RUnlock()
+
+	if gi.closed {
+		return nil
+	}
+	return gi.index.SetFrom(source, t)
+}
+
+func (gi *guardedIndexer) DeleteFrom(source, namespace, name string) error {
+	gi.lock.RLock()
+	defer gi.lock.RUnlock()
+
+	if gi.closed {
+		return nil
+	}
+	return gi.index.DeleteFrom(source, namespace, name)
+}
+
+// close waits for the changes in progress to complete
+func (gi *guardedIndexer) close() {
+	gi.lock.Lock()
+	defer gi.lock.Unlock()
+
+	gi.closed = true
+}
@@ -0,0 +1,202 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package sources
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+// fakeSource indexes the template "fedora" of its namespace when synced
+type fakeSource struct {
+	namespace string
+	index     Indexer
+	// if set, Sync closes syncing, then waits for release
+	syncing chan struct{}
+	release chan struct{}
+}
+
+func (fs *fakeSource) Name() string {
+	return "fake"
+}
+
+func (fs *fakeSource) Sync() error {
+	if fs.syncing != nil {
+		close(fs.syncing)
+		<-fs.release
+	}
+	return fs.index.SetFrom(SourceTemplates, newTemplate(fs.namespace, "fedora"))
+}
+
+func (fs *fakeSource) Start(stop <-chan struct{}) error {
+	return nil
+}
+
+func newTemplate(namespace, name string) *templatev1.Template {
+	return &templatev1.Template{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			ResourceVersion: "1",
+		},
+	}
+}
+
+func newNamespace(name string, labels map[string]string, phase corev1.NamespacePhase) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Status: corev1.NamespaceStatus{
+			Phase: phase,
+		},
+	}
+}
+
+// waitForNamespaces waits until the set indexes exactly the given namespaces
+func waitForNamespaces(t *testing.T, set *NamespaceSet, expected ...string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		names := set.Namespaces()
+		if strings.Join(names, ",") == strings.Join(expected, ",") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected namespaces: %v, expected %v", names, expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNamespaceSetWatch(t *testing.T) {
+	indexed := map[string]string{"indexer": "yes"}
+	client := fake.NewSimpleClientset(
+		newNamespace("team-a", indexed, corev1.NamespaceActive),
+		newNamespace("team-b", nil, corev1.NamespaceActive),
+	)
+	watcher := watch.NewFake()
+	client.PrependWatchReactor("namespaces", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		return true, watcher, nil
+	})
+
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	indexers := make(map[string]Indexer)
+	factory := func(namespace string, index Indexer) ([]Source, error) {
+		indexers[namespace] = index
+		return []Source{&fakeSource{namespace: namespace, index: index}}, nil
+	}
+	selector, err := labels.Parse("indexer=yes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	set := NewNamespaceSet(client.CoreV1().Namespaces(), nil, selector, factory, ti, true, logf.NullLogger{})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := set.Start(stop); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForNamespaces(t, set, "team-a")
+	if _, err := ti.Template("team-a", "fedora"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	watcher.Add(newNamespace("team-c", indexed, corev1.NamespaceActive))
+	waitForNamespaces(t, set, "team-a", "team-c")
+	if _, err := ti.Template("team-c", "fedora"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// relabeled: the watch reports it as deleted
+	watcher.Delete(newNamespace("team-c", nil, corev1.NamespaceActive))
+	waitForNamespaces(t, set, "team-a")
+	if _, err := ti.Template("team-c", "fedora"); err == nil {
+		t.Errorf("template of a dropped namespace still indexed")
+	}
+
+	watcher.Modify(newNamespace("team-a", indexed, corev1.NamespaceTerminating))
+	waitForNamespaces(t, set)
+	if ti.Count() != 0 {
+		t.Errorf("unexpected count: %v", ti.Count())
+	}
+
+	// the sources of the dropped namespaces may still be handling some events
+	if err := indexers["team-a"].SetFrom(SourceTemplates, newTemplate("team-a", "late")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if ti.Count() != 0 {
+		t.Errorf("late template of a dropped namespace indexed")
+	}
+}
+
+func TestNamespaceSetSyncUnlocked(t *testing.T) {
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	src := &fakeSource{
+		namespace: "team-a",
+		syncing:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	factory := func(namespace string, index Indexer) ([]Source, error) {
+		src.index = index
+		return []Source{src}, nil
+	}
+	set := NewNamespaceSet(nil, []string{"team-a"}, nil, factory, ti, true, logf.NullLogger{})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	started := make(chan error)
+	go func() {
+		started <- set.Start(stop)
+	}()
+
+	<-src.syncing
+	answered := make(chan []string)
+	go func() {
+		answered <- set.Namespaces()
+	}()
+	select {
+	case names := <-answered:
+		if len(names) != 0 {
+			t.Errorf("unexpected namespaces: %v", names)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the set is locked while syncing")
+	}
+
+	close(src.release)
+	if err := <-started; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForNamespaces(t, set, "team-a")
+}
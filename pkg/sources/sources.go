@@ -0,0 +1,259 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package sources
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+const (
+	// SourceTemplates are the OpenShift templates
+	SourceTemplates = templateindex.DefaultSource
+	// SourceVirtualMachines are the stopped KubeVirt VirtualMachines
+	SourceVirtualMachines = "virtualmachines"
+	// SourceVirtualMachineTemplates are the objects of the VirtualMachineTemplate CRD
+	SourceVirtualMachineTemplates = "virtualmachinetemplates"
+)
+
+// how long to wait before to list again the objects when the watch fails
+const retryInterval = 5 * time.Second
+
+var (
+	VirtualMachineResource = schema.GroupVersionResource{
+		Group:    "kubevirt.io",
+		Version:  "v1alpha2",
+		Resource: "virtualmachines",
+	}
+	VirtualMachineTemplateResource = schema.GroupVersionResource{
+		Group:    templateindex.VirtualMachineTemplateGroup,
+		Version:  "v1alpha1",
+		Resource: "virtualmachinetemplates",
+	}
+)
+
+// Source feeds the index with the templates found in the cluster
+type Source interface {
+	// Name identifies the source, like SourceTemplates
+	Name() string
+	// Sync adds to the index all the templates currently in the cluster. Do that before to start watching.
+	Sync() error
+	// Start watching for changes, until stop is closed. Does not block.
+	Start(stop <-chan struct{}) error
+}
+
+// Indexer is where the sources put the templates; the TemplateIndexer implements it.
+// The templates are added and removed on behalf of a source, named like SourceTemplates: the objects of different
+// kinds may have the same namespace and name, and a source must not replace, nor remove, the templates of the others.
+type Indexer interface {
+	SetFrom(source string, t *templatev1.Template) error
+	DeleteFrom(source, namespace, name string) error
+}
+
+// Converter turns an object into a template, or returns nil if the object must not be indexed
+type Converter func(obj map[string]interface{}) (*templatev1.Template, error)
+
+// UnstructuredSource indexes any kind of object, using the dynamic client, and a Converter
+type UnstructuredSource struct {
+	name      string
+	client    dynamic.Interface
+	resource  schema.GroupVersionResource
+	namespace string
+	convert   Converter
+	index     Indexer
+	log       logr.Logger
+	filter    *Filter
+	// the objects indexed, to delete them if they disappear while we don't watch
+	indexed         map[string]*templatev1.Template
+	resourceVersion string
+}
+
+// NewUnstructuredSource creates a source for the given resource. An empty namespace means all of them.
+func NewUnstructuredSource(name string, client dynamic.Interface, resource schema.GroupVersionResource, namespace string, convert Converter, index Indexer, log logr.Logger) *UnstructuredSource {
+	return &UnstructuredSource{
+		name:      name,
+		client:    client,
+		resource:  resource,
+		namespace: namespace,
+		convert:   convert,
+		index:     index,
+		log:       log,
+		indexed:   make(map[string]*templatev1.Template),
+	}
+}
+
+// NewVirtualMachineSource indexes the stopped VirtualMachines
+func NewVirtualMachineSource(client dynamic.Interface, namespace string, index Indexer, log logr.Logger) *UnstructuredSource {
+	return NewUnstructuredSource(SourceVirtualMachines, client, VirtualMachineResource, namespace, templateindex.TemplateFromVirtualMachine, index, log)
+}
+
+// NewVirtualMachineTemplateSource indexes the VirtualMachineTemplates
+func NewVirtualMachineTemplateSource(client dynamic.Interface, namespace string, index Indexer, log logr.Logger) *UnstructuredSource {
+	return NewUnstructuredSource(SourceVirtualMachineTemplates, client, VirtualMachineTemplateResource, namespace, templateindex.TemplateFromVirtualMachineTemplate, index, log)
+}
+
+// SetFilter restricts the objects indexed. Must be called before Sync.
+func (us *UnstructuredSource) SetFilter(filter *Filter) {
+	us.filter = filter
+}
+
+func (us *UnstructuredSource) Name() string {
+	return us.name
+}
+
+func (us *UnstructuredSource) resourceInterface() dynamic.ResourceInterface {
+	return us.client.Resource(us.resource).Namespace(us.namespace)
+}
+
+func (us *UnstructuredSource) Sync() error {
+	list, err := us.resourceInterface().List(metav1.ListOptions{LabelSelector: us.filter.Selector().String()})
+	if err != nil {
+		us.log.Error(err, fmt.Sprintf("failed to list %s", us.resource.Resource))
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for i := range list.Items {
+		us.handle(watch.Modified, &list.Items[i])
+		seen[objectKey(&list.Items[i])] = true
+	}
+	for key, t := range us.indexed {
+		if !seen[key] {
+			us.remove(key, t)
+		}
+	}
+	us.resourceVersion = list.GetResourceVersion()
+	us.log.Info(fmt.Sprintf("synced %v %s", len(list.Items), us.resource.Resource))
+	return nil
+}
+
+func (us *UnstructuredSource) Start(stop <-chan struct{}) error {
+	go us.run(stop)
+	return nil
+}
+
+// run watches the objects, listing them again every time the watch breaks
+func (us *UnstructuredSource) run(stop <-chan struct{}) {
+	for {
+		err := us.watch(stop)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err != nil {
+			us.log.Error(err, fmt.Sprintf("failed to watch %s", us.resource.Resource))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(retryInterval):
+		}
+		if err := us.Sync(); err != nil {
+			us.resourceVersion = ""
+		}
+	}
+}
+
+func (us *UnstructuredSource) watch(stop <-chan struct{}) error {
+	w, err := us.resourceInterface().Watch(metav1.ListOptions{
+		LabelSelector:   us.filter.Selector().String(),
+		ResourceVersion: us.resourceVersion,
+	})
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			if event.Type == watch.Error {
+				return fmt.Errorf("watch error: %v", event.Object)
+			}
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			us.handle(event.Type, obj)
+			us.resourceVersion = obj.GetResourceVersion()
+		}
+	}
+}
+
+func (us *UnstructuredSource) handle(eventType watch.EventType, obj *unstructured.Unstructured) {
+	key := objectKey(obj)
+	if eventType == watch.Deleted {
+		if t, ok := us.indexed[key]; ok {
+			us.remove(key, t)
+		}
+		return
+	}
+
+	t, err := us.convert(obj.Object)
+	if err != nil {
+		us.log.Error(err, fmt.Sprintf("cannot index %s %s", us.resource.Resource, key))
+		return
+	}
+	if t == nil || !us.filter.Matches(t) {
+		// e.g. a VM which was started: it is no longer a template
+		if old, ok := us.indexed[key]; ok {
+			us.remove(key, old)
+		}
+		return
+	}
+	if old, ok := us.indexed[key]; ok && old.ResourceVersion == t.ResourceVersion {
+		return
+	}
+	if err := us.index.SetFrom(us.name, t); err != nil {
+		us.log.Error(err, fmt.Sprintf("cannot index %s %s", us.resource.Resource, key))
+		return
+	}
+	us.indexed[key] = t
+}
+
+func (us *UnstructuredSource) remove(key string, t *templatev1.Template) {
+	if err := us.index.DeleteFrom(us.name, t.Namespace, t.Name); err != nil {
+		us.log.Error(err, fmt.Sprintf("cannot remove %s %s", us.resource.Resource, key))
+		return
+	}
+	delete(us.indexed, key)
+}
+
+func objectKey(obj *unstructured.Unstructured) string {
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
@@ -0,0 +1,200 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package sources
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/pkg/templateindex"
+)
+
+var baseLabels = map[string]interface{}{"template.cnv.io/type": "base"}
+
+func newVM(name, resourceVersion string, running bool, labels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "kubevirt.io/v1alpha2",
+		"kind":       "VirtualMachine",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       "kubevirt",
+			"resourceVersion": resourceVersion,
+			"labels":          labels,
+		},
+		"spec": map[string]interface{}{
+			"running": running,
+		},
+	}}
+}
+
+// startFakeWatch starts the source, feeding it the events sent to the returned watcher
+func startFakeWatch(t *testing.T, client *fake.FakeDynamicClient, src Source, stop chan struct{}) *watch.FakeWatcher {
+	watcher := watch.NewFake()
+	watching := make(chan struct{}, 1)
+	client.PrependWatchReactor("virtualmachines", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		select {
+		case watching <- struct{}{}:
+		default:
+		}
+		return true, watcher, nil
+	})
+	if err := src.Start(stop); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-watching:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the source does not watch")
+	}
+	return watcher
+}
+
+// waitForTemplate waits until the template is indexed, or not, as told by present
+func waitForTemplate(t *testing.T, ti *templateindex.TemplateIndexer, name string, present bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := ti.Template("kubevirt", name)
+		if (err == nil) == present {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("template %s: expected present=%v", name, present)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUnstructuredSourceSync(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), newVM("fedora", "1", false, baseLabels), newVM("running", "1", true, baseLabels))
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	src := NewVirtualMachineSource(client, "kubevirt", ti, logf.NullLogger{})
+
+	if err := src.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForTemplate(t, ti, "fedora", true)
+	waitForTemplate(t, ti, "running", false)
+
+	// deleted while we don't watch
+	if err := client.Resource(VirtualMachineResource).Namespace("kubevirt").Delete("fedora", &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := src.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForTemplate(t, ti, "fedora", false)
+}
+
+func TestUnstructuredSourceWatch(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), newVM("other", "1", false, baseLabels))
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	src := NewVirtualMachineSource(client, "kubevirt", ti, logf.NullLogger{})
+	if err := src.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	watcher := startFakeWatch(t, client, src, stop)
+
+	watcher.Add(newVM("fedora", "2", false, baseLabels))
+	waitForTemplate(t, ti, "fedora", true)
+
+	// once started, the VM is no longer a template
+	watcher.Modify(newVM("fedora", "3", true, baseLabels))
+	waitForTemplate(t, ti, "fedora", false)
+	watcher.Modify(newVM("fedora", "4", false, baseLabels))
+	waitForTemplate(t, ti, "fedora", true)
+
+	watcher.Delete(newVM("fedora", "5", false, baseLabels))
+	waitForTemplate(t, ti, "fedora", false)
+	waitForTemplate(t, ti, "other", true)
+}
+
+func TestUnstructuredSourceFilter(t *testing.T) {
+	custom := map[string]interface{}{"template.cnv.io/type": "custom"}
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), newVM("fedora", "1", false, baseLabels), newVM("custom", "1", false, custom))
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	src := NewVirtualMachineSource(client, "kubevirt", ti, logf.NullLogger{})
+	filter, err := NewFilter("template.cnv.io/type=base", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	src.SetFilter(filter)
+
+	if err := src.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForTemplate(t, ti, "fedora", true)
+	waitForTemplate(t, ti, "custom", false)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	watcher := startFakeWatch(t, client, src, stop)
+
+	// relabeled: no longer selected
+	watcher.Modify(newVM("fedora", "2", false, custom))
+	waitForTemplate(t, ti, "fedora", false)
+	watcher.Modify(newVM("custom", "2", false, baseLabels))
+	waitForTemplate(t, ti, "custom", true)
+}
+
+func TestUnstructuredSourceConflict(t *testing.T) {
+	ti := templateindex.NewTemplateIndexer(logf.NullLogger{})
+	template := &templatev1.Template{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "fedora",
+			Namespace:       "kubevirt",
+			ResourceVersion: "7",
+		},
+	}
+	if err := ti.SetFrom(SourceTemplates, template); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), newVM("fedora", "1", false, baseLabels))
+	src := NewVirtualMachineSource(client, "kubevirt", ti, logf.NullLogger{})
+	if err := src.Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found, err := ti.Template("kubevirt", "fedora"); err != nil || found.ResourceVersion != "7" {
+		t.Errorf("the template was replaced by the VM: %v %v", found.ResourceVersion, err)
+	}
+
+	// the VM must not take the template away with it
+	stop := make(chan struct{})
+	defer close(stop)
+	watcher := startFakeWatch(t, client, src, stop)
+	watcher.Delete(newVM("fedora", "2", false, baseLabels))
+	watcher.Add(newVM("sentinel", "3", false, baseLabels))
+	waitForTemplate(t, ti, "sentinel", true)
+	if found, err := ti.Template("kubevirt", "fedora"); err != nil || found.ResourceVersion != "7" {
+		t.Errorf("the template was removed with the VM: %v %v", found.ResourceVersion, err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+const (
+	// VirtualMachineTemplateGroup is the API group of the VirtualMachineTemplate CRD
+	VirtualMachineTemplateGroup = "template.kubevirt.io"
+	// VirtualMachineTemplateKind has the same fields as the OpenShift Templates
+	VirtualMachineTemplateKind = "VirtualMachineTemplate"
+)
+
+// the fields of the VM objects which make sense only for the object in the cluster
+var vmClusterFields = []string{"resourceVersion", "generation", "uid", "selfLink", "creationTimestamp"}
+
+// TemplateFromVirtualMachine wraps the VirtualMachine object, decoded from JSON (like the content
+// of an unstructured.Unstructured), in a template with its same metadata, so the labels of the VM
+// drive the ledgers. Only the stopped VMs are templates: for the running ones, nil is returned.
+func TemplateFromVirtualMachine(obj map[string]interface{}) (*templatev1.Template, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	vm := struct {
+		APIVersion string            `json:"apiVersion"`
+		Kind       string            `json:"kind"`
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Spec       struct {
+			Running bool `json:"running"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(data, &vm); err != nil {
+		return nil, err
+	}
+	if !isVirtualMachine(vm.APIVersion, vm.Kind) {
+		return nil, fmt.Errorf("not a VirtualMachine: %s %s", vm.APIVersion, vm.Kind)
+	}
+	if vm.Spec.Running {
+		return nil, nil
+	}
+
+	// the object of the template is the VM to create, not the one in the cluster
+	object := make(map[string]interface{})
+	for key, value := range obj {
+		if key != "status" {
+			object[key] = value
+		}
+	}
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		clean := make(map[string]interface{})
+		for key, value := range metadata {
+			clean[key] = value
+		}
+		for _, field := range vmClusterFields {
+			delete(clean, field)
+		}
+		object["metadata"] = clean
+	}
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	return &templatev1.Template{
+		ObjectMeta: vm.Metadata,
+		Objects:    []runtime.RawExtension{runtime.RawExtension{Raw: raw}},
+	}, nil
+}
+
+// TemplateFromVirtualMachineTemplate converts the VirtualMachineTemplate object, decoded from JSON,
+// to the equivalent OpenShift template
+func TemplateFromVirtualMachineTemplate(obj map[string]interface{}) (*templatev1.Template, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	t := &templatev1.Template{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	if t.Kind != VirtualMachineTemplateKind {
+		return nil, fmt.Errorf("not a %s: %s", VirtualMachineTemplateKind, t.Kind)
+	}
+	return t, nil
+}
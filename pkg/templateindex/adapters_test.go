@@ -0,0 +1,158 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"encoding/json"
+	"testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+)
+
+const testVirtualMachine = `{
+	"apiVersion": "kubevirt.io/v1alpha2",
+	"kind": "VirtualMachine",
+	"metadata": {
+		"name": "fedora-template",
+		"namespace": "kubevirt",
+		"resourceVersion": "1234",
+		"labels": {
+			"os.template.cnv.io/fedora28": "true",
+			"workload.template.cnv.io/generic": "true",
+			"flavor.template.cnv.io/small": "true"
+		},
+		"annotations": {"openshift.io/display-name": "Fedora 28 VM"}
+	},
+	"spec": {
+		"running": false,
+		"template": {"spec": {"domain": {"cpu": {"cores": 2}, "resources": {"requests": {"memory": "2G"}}}}}
+	},
+	"status": {"created": true}
+}`
+
+const testVirtualMachineTemplate = `{
+	"apiVersion": "template.kubevirt.io/v1alpha1",
+	"kind": "VirtualMachineTemplate",
+	"metadata": {
+		"name": "centos-template",
+		"namespace": "kubevirt",
+		"labels": {"os.template.cnv.io/centos7.0": "true"}
+	},
+	"objects": [{
+		"apiVersion": "kubevirt.io/v1alpha2",
+		"kind": "VirtualMachine",
+		"metadata": {"name": "${NAME}"}
+	}],
+	"parameters": [{"name": "NAME", "generate": "expression", "from": "centos-[a-z0-9]{8}"}]
+}`
+
+func decodeTestObject(t *testing.T, data string) map[string]interface{} {
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatalf("cannot decode test object: %v", err)
+	}
+	return obj
+}
+
+func TestTemplateFromVirtualMachine(t *testing.T) {
+	template, err := TemplateFromVirtualMachine(decodeTestObject(t, testVirtualMachine))
+	if err != nil || template == nil {
+		t.Fatalf("unexpected result: %v %v", template, err)
+	}
+	if template.Name != "fedora-template" || template.Namespace != "kubevirt" || template.ResourceVersion != "1234" {
+		t.Errorf("unexpected metadata: %#v", template.ObjectMeta)
+	}
+
+	vms := virtualMachines(template)
+	if len(vms) != 1 || vms[0].resources().Cores != 2 {
+		t.Fatalf("unexpected VMs: %v", vms)
+	}
+	object := make(map[string]interface{})
+	if err := json.Unmarshal(template.Objects[0].Raw, &object); err != nil {
+		t.Fatalf("cannot decode the VM: %v", err)
+	}
+	if _, ok := object["status"]; ok {
+		t.Errorf("status not removed")
+	}
+	if _, ok := object["metadata"].(map[string]interface{})["resourceVersion"]; ok {
+		t.Errorf("resourceVersion not removed")
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", NewJSONLedger("os"))
+	ti.Set(template)
+	descs, err := ti.DescribeBy(FilterOptions{"os": "fedora28"})
+	if err != nil || len(descs) != 1 || descs[0].Name != "Fedora 28 VM" {
+		t.Errorf("unexpected descriptions: %v %v", descs, err)
+	}
+	ti.Delete("kubevirt", "fedora-template")
+	if ti.Count() != 0 {
+		t.Errorf("template not deleted")
+	}
+}
+
+func TestTemplateFromRunningVirtualMachine(t *testing.T) {
+	obj := decodeTestObject(t, testVirtualMachine)
+	obj["spec"].(map[string]interface{})["running"] = true
+	template, err := TemplateFromVirtualMachine(obj)
+	if err != nil || template != nil {
+		t.Errorf("unexpected result: %v %v", template, err)
+	}
+
+	if _, err := TemplateFromVirtualMachine(decodeTestObject(t, testVirtualMachineTemplate)); err == nil {
+		t.Errorf("unexpectedly converted a VirtualMachineTemplate")
+	}
+}
+
+func TestTemplateFromVirtualMachineTemplate(t *testing.T) {
+	template, err := TemplateFromVirtualMachineTemplate(decodeTestObject(t, testVirtualMachineTemplate))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if template.Name != "centos-template" || len(template.Objects) != 1 || len(template.Parameters) != 1 {
+		t.Errorf("unexpected template: %#v", template)
+	}
+	if vms := virtualMachines(template); len(vms) != 1 {
+		t.Errorf("unexpected VMs: %v", vms)
+	}
+
+	if _, err := TemplateFromVirtualMachineTemplate(decodeTestObject(t, testVirtualMachine)); err == nil {
+		t.Errorf("unexpectedly converted a VirtualMachine")
+	}
+}
+
+func TestHasVirtualMachine(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i := range templates {
+		if !HasVirtualMachine(&templates[i]) {
+			t.Errorf("template %s has no VM", templates[i].Name)
+		}
+	}
+
+	template := templates[0].DeepCopy()
+	template.Objects = template.Objects[:0]
+	if HasVirtualMachine(template) {
+		t.Errorf("template without objects has a VM")
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+const (
+	// the annotation with the version of the schema of the template
+	templateVersionAnnotation = "template.cnv.io/version"
+
+	// CurrentVMAPIVersion is the newest KubeVirt API we can convert the VM objects to
+	CurrentVMAPIVersion = kubevirtGroup + "/v1alpha3"
+
+	offlineVMKind = "OfflineVirtualMachine"
+)
+
+// VMConverter converts a VM object, decoded from JSON, from an API version to the next one
+type VMConverter struct {
+	From    string
+	To      string
+	Convert func(vm map[string]interface{}) error
+}
+
+// VMConverters are chained to bring a VM object up to the requested API version
+var VMConverters = []VMConverter{
+	VMConverter{
+		From:    kubevirtGroup + "/v1alpha1",
+		To:      kubevirtGroup + "/v1alpha2",
+		Convert: convertVMV1alpha1ToV1alpha2,
+	},
+	VMConverter{
+		From:    kubevirtGroup + "/v1alpha2",
+		To:      kubevirtGroup + "/v1alpha3",
+		Convert: convertVMV1alpha2ToV1alpha3,
+	},
+}
+
+// OfflineVirtualMachine was renamed VirtualMachine
+func convertVMV1alpha1ToV1alpha2(vm map[string]interface{}) error {
+	if vm["kind"] == offlineVMKind {
+		vm["kind"] = vmKind
+	}
+	return nil
+}
+
+// registryDisk volumes became containerDisk volumes, and the disks lost volumeName:
+// a disk now uses the volume with its same name
+func convertVMV1alpha2ToV1alpha3(vm map[string]interface{}) error {
+	spec := nestedMap(vm, "spec", "template", "spec")
+	if spec == nil {
+		return nil
+	}
+
+	renames := make(map[string]string)
+	devices := nestedMap(spec, "domain", "devices")
+	if devices != nil {
+		disks, _ := devices["disks"].([]interface{})
+		for _, item := range disks {
+			disk, ok := item.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("malformed disk: %v", item)
+			}
+			volumeName, _ := disk["volumeName"].(string)
+			name, _ := disk["name"].(string)
+			if volumeName != "" && name != "" {
+				renames[volumeName] = name
+			}
+			delete(disk, "volumeName")
+		}
+	}
+
+	volumes, _ := spec["volumes"].([]interface{})
+	for _, item := range volumes {
+		volume, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("malformed volume: %v", item)
+		}
+		if name, ok := volume["name"].(string); ok && renames[name] != "" {
+			volume["name"] = renames[name]
+		}
+		if registryDisk, ok := volume["registryDisk"]; ok {
+			volume["containerDisk"] = registryDisk
+			delete(volume, "registryDisk")
+		}
+	}
+	return nil
+}
+
+func nestedMap(obj map[string]interface{}, fields ...string) map[string]interface{} {
+	for _, field := range fields {
+		next, ok := obj[field].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		obj = next
+	}
+	return obj
+}
+
+// ConvertVM converts the JSON VM object to the given API version.
+// Objects already at that version are returned unchanged; downgrades are not supported.
+func ConvertVM(raw []byte, apiVersion string) ([]byte, error) {
+	vm := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &vm); err != nil {
+		return nil, err
+	}
+	current, _ := vm["apiVersion"].(string)
+	if current == apiVersion {
+		return raw, nil
+	}
+
+	for current != apiVersion {
+		conv, ok := findVMConverter(current)
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %s to %s", current, apiVersion)
+		}
+		if err := conv.Convert(vm); err != nil {
+			return nil, fmt.Errorf("cannot convert %s to %s: %v", conv.From, conv.To, err)
+		}
+		current = conv.To
+		vm["apiVersion"] = current
+	}
+	return json.Marshal(vm)
+}
+
+func findVMConverter(from string) (VMConverter, bool) {
+	for _, conv := range VMConverters {
+		if conv.From == from {
+			return conv, true
+		}
+	}
+	return VMConverter{}, false
+}
+
+// ConvertTemplate returns a copy of the template, with the VM objects converted to the given API version
+func ConvertTemplate(t *templatev1.Template, apiVersion string) (*templatev1.Template, error) {
+	converted := t.DeepCopy()
+	for i, obj := range converted.Objects {
+		if obj.Raw == nil {
+			continue
+		}
+		meta := objectMeta{}
+		if err := json.Unmarshal(obj.Raw, &meta); err != nil || !isVirtualMachine(meta.APIVersion, meta.Kind) {
+			continue
+		}
+		raw, err := ConvertVM(obj.Raw, apiVersion)
+		if err != nil {
+			return nil, fmt.Errorf("template %s, object %d: %v", t.Name, i, err)
+		}
+		converted.Objects[i] = runtime.RawExtension{Raw: raw}
+	}
+	return converted, nil
+}
+
+type objectMeta struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+}
+
+// objectAPIVersions returns the API versions of the objects of the given API group in the template
+func objectAPIVersions(t *templatev1.Template, group string) []string {
+	seen := NewStringSet()
+	versions := []string{}
+	for _, obj := range t.Objects {
+		if obj.Raw == nil {
+			continue
+		}
+		meta := objectMeta{}
+		if err := json.Unmarshal(obj.Raw, &meta); err != nil {
+			continue
+		}
+		if !strings.HasPrefix(meta.APIVersion, group+"/") || seen.Contains(meta.APIVersion) {
+			continue
+		}
+		versions = append(versions, meta.APIVersion)
+		seen.Add(meta.APIVersion)
+	}
+	return versions
+}
@@ -0,0 +1,143 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+)
+
+func TestConvertTemplate(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-template.yaml")
+	if err != nil || len(templates) != 1 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+
+	converted, err := ConvertTemplate(&templates[0], CurrentVMAPIVersion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vm := make(map[string]interface{})
+	if err := json.Unmarshal(converted.Objects[0].Raw, &vm); err != nil {
+		t.Fatalf("cannot decode the converted VM: %v", err)
+	}
+	if vm["apiVersion"] != CurrentVMAPIVersion || vm["kind"] != vmKind {
+		t.Errorf("unexpected VM: %v %v", vm["apiVersion"], vm["kind"])
+	}
+	spec := nestedMap(vm, "spec", "template", "spec")
+	disk := nestedMap(spec, "domain", "devices")["disks"].([]interface{})[0].(map[string]interface{})
+	if _, ok := disk["volumeName"]; ok {
+		t.Errorf("volumeName not removed: %v", disk)
+	}
+	volume := spec["volumes"].([]interface{})[0].(map[string]interface{})
+	if volume["name"] != disk["name"] {
+		t.Errorf("volume not renamed: %v", volume)
+	}
+
+	// the original is untouched
+	if vms := virtualMachines(&templates[0]); len(vms) != 1 || vms[0].APIVersion != kubevirtGroup+"/v1alpha2" {
+		t.Errorf("original template modified: %v", vms)
+	}
+}
+
+func TestConvertVMFromV1alpha1(t *testing.T) {
+	raw := []byte(`{
+		"apiVersion": "kubevirt.io/v1alpha1",
+		"kind": "OfflineVirtualMachine",
+		"spec": {"template": {"spec": {
+			"domain": {"devices": {"disks": [{"name": "rootdisk", "volumeName": "registryvolume", "disk": {}}]}},
+			"volumes": [{"name": "registryvolume", "registryDisk": {"image": "kubevirt/fedora-cloud-registry-disk-demo"}}]
+		}}}
+	}`)
+	converted, err := ConvertVM(raw, CurrentVMAPIVersion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vm := make(map[string]interface{})
+	if err := json.Unmarshal(converted, &vm); err != nil {
+		t.Fatalf("cannot decode the converted VM: %v", err)
+	}
+	if vm["apiVersion"] != CurrentVMAPIVersion || vm["kind"] != vmKind {
+		t.Errorf("unexpected VM: %v %v", vm["apiVersion"], vm["kind"])
+	}
+	volume := nestedMap(vm, "spec", "template", "spec")["volumes"].([]interface{})[0].(map[string]interface{})
+	if volume["name"] != "rootdisk" || volume["registryDisk"] != nil || volume["containerDisk"] == nil {
+		t.Errorf("unexpected volume: %v", volume)
+	}
+
+	if _, err := ConvertVM(converted, kubevirtGroup+"/v1alpha2"); err == nil {
+		t.Errorf("unexpectedly downgraded the VM")
+	}
+}
+
+func TestConvertTemplateSkipsOtherObjects(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-template.yaml")
+	if err != nil || len(templates) != 1 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	service := []byte(`{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "foo"}}`)
+	templates[0].Objects = append(templates[0].Objects, runtime.RawExtension{Raw: service})
+
+	converted, err := ConvertTemplate(&templates[0], CurrentVMAPIVersion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(converted.Objects[1].Raw) != string(service) {
+		t.Errorf("unexpected object: %s", converted.Objects[1].Raw)
+	}
+}
+
+func TestDescribeByAPIVersion(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("version", NewValueLedger(NewJSONLedger(templateVersionAnnotation), LedgerTypeAnnotation))
+	ti.AddLedger("apiversion", NewValueLedger(NewJSONLedger(kubevirtGroup), LedgerTypeAPIVersion))
+	if _, err := ti.AddTemplates(templates); err != nil {
+		t.Fatalf("cannot add test templates! %v", err)
+	}
+
+	descs, err := ti.DescribeBy(FilterOptions{"version": "v1alpha1", "apiversion": "kubevirt.io/v1alpha2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(descs) != len(templates) {
+		t.Errorf("expected %v templates, received %v", len(templates), len(descs))
+	}
+	for _, desc := range descs {
+		if desc.Version != "v1alpha1" || desc.VMAPIVersion != "kubevirt.io/v1alpha2" {
+			t.Errorf("unexpected versions: %v %v", desc.Version, desc.VMAPIVersion)
+		}
+	}
+
+	descs, err = ti.DescribeBy(FilterOptions{"apiversion": CurrentVMAPIVersion})
+	if err != nil || len(descs) != 0 {
+		t.Errorf("unexpected descriptions: %v %v", descs, err)
+	}
+}
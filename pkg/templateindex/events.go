@@ -0,0 +1,115 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"fmt"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// EventType tells how a template changed in the index
+type EventType string
+
+const (
+	EventAdded    EventType = "ADDED"
+	EventModified EventType = "MODIFIED"
+	EventDeleted  EventType = "DELETED"
+)
+
+// Event is a change of a template in the index
+type Event struct {
+	Type EventType
+	// the new template, or the removed one
+	Template templatev1.Template
+}
+
+// Subscription receives the changes of the templates in the index
+type Subscription struct {
+	ti     *TemplateIndexer
+	events chan Event
+}
+
+// Subscribe returns a subscription to the changes of the templates, buffering up to buffer events.
+// A subscriber which falls behind is dropped, and its Events channel closed: it must subscribe again,
+// and resync with the index.
+func (ti *TemplateIndexer) Subscribe(buffer int) *Subscription {
+	ti.rwlock.Lock()
+	defer ti.rwlock.Unlock()
+
+	s := &Subscription{
+		ti:     ti,
+		events: make(chan Event, buffer),
+	}
+	ti.subscribers[s] = struct{}{}
+	return s
+}
+
+// Events returns the channel of the changes, closed when the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close ends the subscription. It is safe to call it more than once.
+func (s *Subscription) Close() {
+	s.ti.rwlock.Lock()
+	defer s.ti.rwlock.Unlock()
+
+	s.ti.unsubscribe(s)
+}
+
+// unsubscribe must be called with the write lock held
+func (ti *TemplateIndexer) unsubscribe(s *Subscription) {
+	if _, ok := ti.subscribers[s]; ok {
+		delete(ti.subscribers, s)
+		close(s.events)
+	}
+}
+
+// notify must be called with the write lock held. It never blocks.
+func (ti *TemplateIndexer) notify(eventType EventType, t *templatev1.Template) {
+	if len(ti.subscribers) == 0 {
+		return
+	}
+	ev := Event{
+		Type:     eventType,
+		Template: *t.DeepCopy(),
+	}
+	for s := range ti.subscribers {
+		select {
+		case s.events <- ev:
+		default:
+			ti.log.Info(fmt.Sprintf("dropping a subscriber falling behind, at %s %s", eventType, t.Name))
+			ti.unsubscribe(s)
+		}
+	}
+}
+
+// DescribeMatching describes the template, in the first available of langs, if it matches opts.
+// The template needs not to be in the index, e.g. it may come from an Event.
+func (ti *TemplateIndexer) DescribeMatching(t *templatev1.Template, opts FilterOptions, langs ...string) (Description, bool) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	f := ti.newFilter(opts)
+	if !ti.matches(t, f) {
+		return Description{}, false
+	}
+	return ti.describe(t, f, langs), true
+}
@@ -0,0 +1,102 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+)
+
+func TestTemplateIndexerSubscribe(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 2 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", NewJSONLedger("os"))
+	sub := ti.Subscribe(8)
+	defer sub.Close()
+
+	ti.Set(&templates[0])
+	updated := templates[0].DeepCopy()
+	updated.ResourceVersion = "2"
+	ti.Set(updated)
+	ti.Delete(templates[0].Namespace, templates[0].Name)
+
+	expected := []EventType{EventAdded, EventModified, EventDeleted}
+	for _, eventType := range expected {
+		ev := <-sub.Events()
+		if ev.Type != eventType || ev.Template.Name != templates[0].Name {
+			t.Errorf("unexpected event: %v %v expected %v", ev.Type, ev.Template.Name, eventType)
+		}
+	}
+
+	sub.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Errorf("events not closed")
+	}
+	// no more subscribers
+	ti.Set(&templates[1])
+	sub.Close()
+}
+
+func TestTemplateIndexerSubscribeSlow(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 3 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	sub := ti.Subscribe(1)
+	ti.AddTemplates(templates[:3])
+
+	count := 0
+	for range sub.Events() {
+		count++
+	}
+	if count != 1 {
+		t.Errorf("unexpected events: %v", count)
+	}
+}
+
+func TestTemplateIndexerDescribeMatching(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", NewJSONLedger("os"))
+	oses := ti.ledgers["os"].Values(&templates[0])
+	if len(oses) == 0 {
+		t.Fatalf("template %v without OS", templates[0].Name)
+	}
+
+	desc, ok := ti.DescribeMatching(&templates[0], FilterOptions{"os": oses[0]})
+	if !ok || desc.ID != templates[0].Name || desc.OS != oses[0] {
+		t.Errorf("unexpected description: %v %v", desc, ok)
+	}
+	if _, ok := ti.DescribeMatching(&templates[0], FilterOptions{"os": "does-not-exist"}); ok {
+		t.Errorf("unexpected match")
+	}
+}
@@ -20,19 +20,71 @@ package templateindex
 
 import (
 	"net/url"
+	"strings"
 )
 
+// FilterOptions maps the names of the ledgers to the values the templates must have
 type FilterOptions map[string]string
 
-func FilterOptionsFromURL(u *url.URL) FilterOptions {
+// NamespacesOption is the FilterOptions key restricting the templates to a comma separated list of namespaces.
+// It is not a query parameter: the HTTP API sets it to hide the namespaces the caller cannot see.
+const NamespacesOption = "namespaces"
+
+// DefaultFilterParams are the query parameters recognized if none is given explicitly
+var DefaultFilterParams = []string{"os", "workload", "size"}
+
+// FilterOptionsFromURL extracts the filter options from the query parameters of u.
+// Only params are recognized, or the DefaultFilterParams if none is given,
+// besides IncludeDeprecatedOption, which is always recognized.
+func FilterOptionsFromURL(u *url.URL, params ...string) FilterOptions {
+	if len(params) == 0 {
+		params = DefaultFilterParams
+	}
 	query := u.Query()
 	opts := FilterOptions{}
-	for _, param := range []string{"os", "workload", "size"} {
+	for _, param := range params {
 		// intentionally ignore unknown parameters.
 		// TODO: log them?
 		if value := query.Get(param); value != "" {
 			opts[param] = value
 		}
 	}
+	if value := query.Get(IncludeDeprecatedOption); value != "" {
+		opts[IncludeDeprecatedOption] = value
+	}
 	return opts
 }
+
+// Without returns a copy of the options, without the given key
+func (opts FilterOptions) Without(key string) FilterOptions {
+	res := FilterOptions{}
+	for k, v := range opts {
+		if k != key {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// WithNamespaces returns a copy of the options, restricted to the templates of the given namespaces.
+// No namespaces means no templates.
+func (opts FilterOptions) WithNamespaces(namespaces []string) FilterOptions {
+	res := opts.Without(NamespacesOption)
+	res[NamespacesOption] = strings.Join(namespaces, ",")
+	return res
+}
+
+// namespaces returns the namespaces the templates must belong to, or nil if there are no restrictions
+func (opts FilterOptions) namespaces() *StringSet {
+	value, ok := opts[NamespacesOption]
+	if !ok {
+		return nil
+	}
+	namespaces := NewStringSet()
+	for _, namespace := range strings.Split(value, ",") {
+		if namespace != "" {
+			namespaces.Add(namespace)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,342 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// DefaultHistoryLength is how many revisions are kept for each template, unless configured otherwise
+const DefaultHistoryLength = 10
+
+// the histories of the deleted templates are kept, so their changes can be told once they are created again,
+// up to this many: the ones deleted earlier are forgotten first
+const maxDeletedHistories = 1024
+
+// Revision is one version of a template seen by the indexer
+type Revision struct {
+	// the resourceVersion of the template, or a sequence number if it has none
+	ID         string `json:"id"`
+	Generation int64  `json:"generation,omitempty"`
+	// when the indexer received this revision
+	Timestamp time.Time `json:"timestamp"`
+
+	template templatev1.Template
+}
+
+// History lists the revisions kept for a template, oldest first
+type History struct {
+	Namespace string     `json:"namespace"`
+	Name      string     `json:"name"`
+	Revisions []Revision `json:"revisions"`
+	// the template is not indexed anymore; the last revision is the one deleted
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Change is a difference between two revisions.
+// Path is a JSON pointer (RFC 6901), like "/objects/0/spec/running".
+type Change struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// RevisionDiff tells what changed from a revision to another
+type RevisionDiff struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	From      Revision `json:"from"`
+	To        Revision `json:"to"`
+	Changes   []Change `json:"changes"`
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// these change with every revision, so they are not interesting
+var ignoredChangePaths = map[string]bool{
+	"/metadata/resourceVersion": true,
+	"/metadata/generation":      true,
+}
+
+// templateHistory holds the revisions of a template; the last is the current one
+type templateHistory struct {
+	revisions []Revision
+	seq       int
+	// when the template was deleted, zero if it is indexed
+	deleted time.Time
+}
+
+// SetHistoryLength sets how many revisions are kept for each template. Non positive values disable the history.
+func (ti *TemplateIndexer) SetHistoryLength(length int) {
+	ti.rwlock.Lock()
+	defer ti.rwlock.Unlock()
+
+	ti.historyLength = length
+	for _, h := range ti.history {
+		h.trim(length)
+	}
+}
+
+// recordRevision adds the template to its history. Must be called with the lock held.
+func (ti *TemplateIndexer) recordRevision(t *templatev1.Template) {
+	if ti.historyLength <= 0 {
+		return
+	}
+	h, ok := ti.history[keyOf(t)]
+	if !ok {
+		h = &templateHistory{}
+		ti.history[keyOf(t)] = h
+	}
+	h.deleted = time.Time{}
+	if n := len(h.revisions); n > 0 && t.ResourceVersion != "" && h.revisions[n-1].ID == t.ResourceVersion {
+		// resync, nothing changed
+		return
+	}
+
+	h.seq += 1
+	id := t.ResourceVersion
+	if id == "" {
+		id = strconv.Itoa(h.seq)
+	}
+	h.revisions = append(h.revisions, Revision{
+		ID:         id,
+		Generation: t.Generation,
+		Timestamp:  ti.now(),
+		template:   *t.DeepCopy(),
+	})
+	h.trim(ti.historyLength)
+}
+
+// forgetRevisions marks the history of the template as deleted, forgetting the histories deleted earliest
+// once there are too many. Must be called with the lock held.
+func (ti *TemplateIndexer) forgetRevisions(key string) {
+	h, ok := ti.history[key]
+	if !ok {
+		return
+	}
+	h.deleted = ti.now()
+
+	deleted := 0
+	oldest := ""
+	for k, h := range ti.history {
+		if h.deleted.IsZero() {
+			continue
+		}
+		deleted++
+		if oldest == "" || h.deleted.Before(ti.history[oldest].deleted) {
+			oldest = k
+		}
+	}
+	if deleted > maxDeletedHistories {
+		delete(ti.history, oldest)
+	}
+}
+
+func (h *templateHistory) trim(length int) {
+	if extra := len(h.revisions) - length; extra > 0 {
+		h.revisions = append([]Revision{}, h.revisions[extra:]...)
+	}
+}
+
+func (h *templateHistory) find(id string) (Revision, bool) {
+	for _, rev := range h.revisions {
+		if rev.ID == id {
+			return rev, true
+		}
+	}
+	return Revision{}, false
+}
+
+// lookupHistory returns the history of the template with the given namespace and name.
+// Must be called with the lock held.
+func (ti *TemplateIndexer) lookupHistory(namespace, name string) (*templateHistory, error) {
+	h, ok := ti.history[templateKey(namespace, name)]
+	if !ok || len(h.revisions) == 0 {
+		return nil, fmt.Errorf("unknown template: %s/%s", namespace, name)
+	}
+	return h, nil
+}
+
+// Revisions returns the revisions kept for the template, oldest first, also once it was deleted
+func (ti *TemplateIndexer) Revisions(namespace, name string) (History, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	h, err := ti.lookupHistory(namespace, name)
+	if err != nil {
+		return History{}, err
+	}
+	return History{
+		Namespace: namespace,
+		Name:      name,
+		Revisions: append([]Revision{}, h.revisions...),
+		Deleted:   !h.deleted.IsZero(),
+	}, nil
+}
+
+// DiffRevisions tells what changed in the template from a revision to another.
+// If empty, to defaults to the current revision, and from to the one before to.
+func (ti *TemplateIndexer) DiffRevisions(namespace, name, from, to string) (RevisionDiff, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	h, err := ti.lookupHistory(namespace, name)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+
+	toIdx := len(h.revisions) - 1
+	if to != "" {
+		toIdx = revisionIndex(h.revisions, to)
+		if toIdx < 0 {
+			return RevisionDiff{}, fmt.Errorf("unknown revision: %s", to)
+		}
+	}
+	fromIdx := toIdx - 1
+	if from != "" {
+		fromIdx = revisionIndex(h.revisions, from)
+		if fromIdx < 0 {
+			return RevisionDiff{}, fmt.Errorf("unknown revision: %s", from)
+		}
+	}
+	if fromIdx < 0 {
+		return RevisionDiff{}, fmt.Errorf("no revision before %s", h.revisions[toIdx].ID)
+	}
+
+	changes, err := diffTemplates(&h.revisions[fromIdx].template, &h.revisions[toIdx].template)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	return RevisionDiff{
+		Namespace: namespace,
+		Name:      name,
+		From:      h.revisions[fromIdx],
+		To:        h.revisions[toIdx],
+		Changes:   changes,
+	}, nil
+}
+
+func revisionIndex(revisions []Revision, id string) int {
+	for i, rev := range revisions {
+		if rev.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// diffTemplates compares the JSON representation of the templates
+func diffTemplates(a, b *templatev1.Template) ([]Change, error) {
+	va, err := toGeneric(a)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := toGeneric(b)
+	if err != nil {
+		return nil, err
+	}
+	changes := []Change{}
+	diffValues("", va, vb, &changes)
+	return changes, nil
+}
+
+func toGeneric(t *templatev1.Template) (interface{}, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+func diffValues(path string, a, b interface{}, changes *[]Change) {
+	if ignoredChangePaths[path] {
+		return
+	}
+	switch va := a.(type) {
+	case map[string]interface{}:
+		if vb, ok := b.(map[string]interface{}); ok {
+			diffMaps(path, va, vb, changes)
+			return
+		}
+	case []interface{}:
+		if vb, ok := b.([]interface{}); ok {
+			diffSlices(path, va, vb, changes)
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Path: path, Op: ChangeChanged, From: a, To: b})
+	}
+}
+
+func diffMaps(path string, a, b map[string]interface{}, changes *[]Change) {
+	keys := NewStringSet()
+	for key := range a {
+		keys.Add(key)
+	}
+	for key := range b {
+		keys.Add(key)
+	}
+	for _, key := range keys.Keys() {
+		subPath := path + "/" + jsonPointerEscaper.Replace(key)
+		va, inA := a[key]
+		vb, inB := b[key]
+		if ignoredChangePaths[subPath] {
+			continue
+		}
+		switch {
+		case !inA:
+			*changes = append(*changes, Change{Path: subPath, Op: ChangeAdded, To: vb})
+		case !inB:
+			*changes = append(*changes, Change{Path: subPath, Op: ChangeRemoved, From: va})
+		default:
+			diffValues(subPath, va, vb, changes)
+		}
+	}
+}
+
+func diffSlices(path string, a, b []interface{}, changes *[]Change) {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		subPath := path + "/" + strconv.Itoa(i)
+		switch {
+		case i >= len(a):
+			*changes = append(*changes, Change{Path: subPath, Op: ChangeAdded, To: b[i]})
+		case i >= len(b):
+			*changes = append(*changes, Change{Path: subPath, Op: ChangeRemoved, From: a[i]})
+		default:
+			diffValues(subPath, a[i], b[i], changes)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// newRevision returns a copy of the template with the given resourceVersion and description
+func newRevision(t *templatev1.Template, resourceVersion, description string) *templatev1.Template {
+	rev := t.DeepCopy()
+	rev.ResourceVersion = resourceVersion
+	rev.Generation += 1
+	rev.Annotations["description"] = description
+	return rev
+}
+
+// newHistoryTestIndexer indexes only fedora-generic-large, with a clock advancing one day at every revision
+func newHistoryTestIndexer(t *testing.T) (*TemplateIndexer, *templatev1.Template) {
+	var template *templatev1.Template
+	ti := newTestIndexer(t, func(ti *TemplateIndexer, templates []templatev1.Template) []templatev1.Template {
+		clock := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+		ti.now = func() time.Time {
+			clock = clock.Add(24 * time.Hour)
+			return clock
+		}
+		for i := range templates {
+			if templates[i].Name == "fedora-generic-large" {
+				template = &templates[i]
+				template.Namespace = "openshift"
+				template.ResourceVersion = "100"
+				template.Generation = 1
+				return templates[i : i+1]
+			}
+		}
+		t.Fatalf("missing test template")
+		return nil
+	})
+	return ti, template
+}
+
+func TestRevisions(t *testing.T) {
+	ti, template := newHistoryTestIndexer(t)
+	ti.Update(newRevision(template, "101", "first change"))
+	ti.Update(newRevision(template, "102", "second change"))
+
+	history, err := ti.Revisions("openshift", "fedora-generic-large")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"100", "101", "102"}
+	if len(history.Revisions) != len(expected) {
+		t.Fatalf("unexpected revisions: %v", history.Revisions)
+	}
+	for i, id := range expected {
+		if history.Revisions[i].ID != id {
+			t.Errorf("expected=%v received=%v", id, history.Revisions[i].ID)
+		}
+	}
+	if !history.Revisions[1].Timestamp.After(history.Revisions[0].Timestamp) {
+		t.Errorf("unexpected timestamps: %v", history.Revisions)
+	}
+
+	// modifications replace the template
+	if ti.Count() != 1 {
+		t.Errorf("unexpected count: %v", ti.Count())
+	}
+	descs, err := ti.DescribeBy(FilterOptions{})
+	if err != nil || len(descs) != 1 || descs[0].Description != "second change" {
+		t.Errorf("unexpected descriptions: %v", descs)
+	}
+
+	if _, err := ti.Revisions("default", "fedora-generic-large"); err == nil {
+		t.Errorf("unexpectedly found template in the wrong namespace")
+	}
+}
+
+func TestRevisionsResyncAndLength(t *testing.T) {
+	ti, template := newHistoryTestIndexer(t)
+	ti.SetHistoryLength(2)
+	if _, err := ti.AddTemplates([]templatev1.Template{*template}); err != nil {
+		t.Fatalf("cannot add test template! %v", err)
+	}
+	ti.Update(newRevision(template, "101", "first change"))
+	ti.Update(newRevision(template, "102", "second change"))
+
+	history, err := ti.Revisions("openshift", "fedora-generic-large")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history.Revisions) != 2 || history.Revisions[0].ID != "101" || history.Revisions[1].ID != "102" {
+		t.Errorf("unexpected revisions: %v", history.Revisions)
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	ti, template := newHistoryTestIndexer(t)
+	rev := newRevision(template, "101", "first change")
+	rev.Labels["gpu.template.cnv.io/nvidia"] = "true"
+	delete(rev.Annotations, "tags")
+	ti.Update(rev)
+
+	diff, err := ti.DiffRevisions("openshift", "fedora-generic-large", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff.From.ID != "100" || diff.To.ID != "101" {
+		t.Errorf("unexpected revisions: %v -> %v", diff.From.ID, diff.To.ID)
+	}
+	expected := []Change{
+		Change{Path: "/metadata/annotations/description", Op: ChangeChanged, To: "first change"},
+		Change{Path: "/metadata/annotations/tags", Op: ChangeRemoved},
+		Change{Path: "/metadata/labels/gpu.template.cnv.io~1nvidia", Op: ChangeAdded, To: "true"},
+	}
+	if len(diff.Changes) != len(expected) {
+		t.Fatalf("unexpected changes: %v", diff.Changes)
+	}
+	for i, exp := range expected {
+		change := diff.Changes[i]
+		if change.Path != exp.Path || change.Op != exp.Op || (exp.To != nil && change.To != exp.To) {
+			t.Errorf("expected=%v received=%v", exp, change)
+		}
+	}
+
+	if _, err := ti.DiffRevisions("openshift", "fedora-generic-large", "100", "99"); err == nil {
+		t.Errorf("unexpectedly diffed an unknown revision")
+	}
+	if _, err := ti.DiffRevisions("openshift", "fedora-generic-large", "", "100"); err == nil {
+		t.Errorf("unexpectedly diffed the first revision with its previous")
+	}
+}
+
+func TestDiffValuesObjects(t *testing.T) {
+	changes := []Change{}
+	diffValues("",
+		map[string]interface{}{"objects": []interface{}{map[string]interface{}{"cores": 1.0}}},
+		map[string]interface{}{"objects": []interface{}{map[string]interface{}{"cores": 2.0}, "new"}},
+		&changes)
+	if len(changes) != 2 {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+	if changes[0].Path != "/objects/0/cores" || changes[0].Op != ChangeChanged || changes[0].From != 1.0 || changes[0].To != 2.0 {
+		t.Errorf("unexpected change: %v", changes[0])
+	}
+	if changes[1].Path != "/objects/1" || changes[1].Op != ChangeAdded {
+		t.Errorf("unexpected change: %v", changes[1])
+	}
+}
+
+func TestRevisionsAfterDelete(t *testing.T) {
+	ti, template := newHistoryTestIndexer(t)
+	ti.Update(newRevision(template, "101", "first change"))
+	if _, err := ti.DeleteNamespace("openshift"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	history, err := ti.Revisions("openshift", "fedora-generic-large")
+	if err != nil {
+		t.Fatalf("history lost on delete: %v", err)
+	}
+	if !history.Deleted || len(history.Revisions) != 2 {
+		t.Errorf("unexpected history: %v", history)
+	}
+
+	// the namespace matches again: same template, nothing changed
+	ti.Update(newRevision(template, "101", "first change"))
+	history, _ = ti.Revisions("openshift", "fedora-generic-large")
+	if history.Deleted || len(history.Revisions) != 2 {
+		t.Errorf("unexpected history: %v", history)
+	}
+
+	ti.Delete("openshift", "fedora-generic-large")
+	ti.Update(newRevision(template, "200", "recreated"))
+	diff, err := ti.DiffRevisions("openshift", "fedora-generic-large", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff.From.ID != "101" || diff.To.ID != "200" || len(diff.Changes) != 1 {
+		t.Errorf("unexpected diff: %v", diff)
+	}
+}
+
+func TestRevisionsAfterDeleteBounded(t *testing.T) {
+	ti, template := newHistoryTestIndexer(t)
+	ti.Delete(template.Namespace, template.Name)
+	for i := 0; i < maxDeletedHistories; i++ {
+		other := template.DeepCopy()
+		other.Name = fmt.Sprintf("%s-%d", template.Name, i)
+		ti.Set(other)
+		ti.Delete(other.Namespace, other.Name)
+	}
+
+	if _, err := ti.Revisions(template.Namespace, template.Name); err == nil {
+		t.Errorf("the history deleted first was not forgotten")
+	}
+	for _, i := range []int{0, maxDeletedHistories - 1} {
+		if _, err := ti.Revisions(template.Namespace, fmt.Sprintf("%s-%d", template.Name, i)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if len(ti.history) != maxDeletedHistories {
+		t.Errorf("unexpected histories: %v", len(ti.history))
+	}
+}
@@ -0,0 +1,335 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// IconDataAnnotation holds the icon of a template as a data: URL, like "data:image/svg+xml;base64,...".
+// It takes precedence over the icon files of the iconClass, which may be a data: URL too.
+const IconDataAnnotation = "template.kubevirt.io/icon"
+
+// MaxIconBytes is the maximum size of an icon; the bigger ones are ignored
+const MaxIconBytes = 256 * 1024
+
+// dataIconPrefix starts the IDs of the icons of the data: URLs, followed by a hash of their content
+const dataIconPrefix = "data-"
+
+// iconTypes are the supported media types of the icons, by file extension
+var iconTypes = map[string]string{
+	".svg": "image/svg+xml",
+	".png": "image/png",
+}
+
+// Icon is an image representing templates
+type Icon struct {
+	ID          string
+	ContentType string
+	Data        []byte
+	// a strong entity tag, quoted
+	ETag    string
+	ModTime time.Time
+}
+
+// Immutable tells if the icon never changes, because it was embedded in a template: its ID comes from its content
+func (ic Icon) Immutable() bool {
+	return strings.HasPrefix(ic.ID, dataIconPrefix)
+}
+
+func newIcon(id, contentType string, data []byte, modTime time.Time) Icon {
+	return Icon{
+		ID:          id,
+		ContentType: contentType,
+		Data:        data,
+		ETag:        fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(data))),
+		ModTime:     modTime,
+	}
+}
+
+// ParseDataIcon decodes an icon from a data: URL, like "data:image/png;base64,..." or "data:image/svg+xml,%3Csvg...".
+// Its ID is derived from its content.
+func ParseDataIcon(dataURL string) (Icon, error) {
+	if !strings.HasPrefix(dataURL, "data:") {
+		return Icon{}, fmt.Errorf("not a data URL")
+	}
+	comma := strings.Index(dataURL, ",")
+	if comma < 0 {
+		return Icon{}, fmt.Errorf("malformed data URL")
+	}
+	params := strings.Split(dataURL[len("data:"):comma], ";")
+	contentType := strings.ToLower(strings.TrimSpace(params[0]))
+	if !isIconType(contentType) {
+		return Icon{}, fmt.Errorf("unsupported icon type: %q", contentType)
+	}
+
+	var data []byte
+	var err error
+	payload := dataURL[comma+1:]
+	if params[len(params)-1] == "base64" {
+		data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+	} else {
+		var text string
+		text, err = url.PathUnescape(payload)
+		data = []byte(text)
+	}
+	if err != nil {
+		return Icon{}, fmt.Errorf("malformed data URL: %v", err)
+	}
+	if len(data) > MaxIconBytes {
+		return Icon{}, fmt.Errorf("icon too big: %d bytes", len(data))
+	}
+
+	icon := newIcon("", contentType, data, time.Time{})
+	icon.ID = fmt.Sprintf("%s%x", dataIconPrefix, sha256.Sum256(data))[:len(dataIconPrefix)+16]
+	return icon, nil
+}
+
+func isIconType(contentType string) bool {
+	for _, t := range iconTypes {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// templateDataIcon returns the icon embedded in the template, if any
+func templateDataIcon(t *templatev1.Template) (Icon, bool, error) {
+	value, ok := t.Annotations[IconDataAnnotation]
+	if !ok {
+		value = t.Annotations["iconClass"]
+		if !strings.HasPrefix(value, "data:") {
+			return Icon{}, false, nil
+		}
+	}
+	icon, err := ParseDataIcon(value)
+	if err != nil {
+		return Icon{}, false, err
+	}
+	return icon, true, nil
+}
+
+// IconStore holds the icons of the icon classes of the templates, read from the files of a directory named
+// after them, like "icon-centos.svg" or "icon-rhel.png". The directory may be a mounted ConfigMap,
+// with the PNG files as binaryData.
+type IconStore struct {
+	lock  sync.RWMutex
+	log   logr.Logger
+	dir   string
+	stamp string
+	icons map[string]Icon
+}
+
+func NewIconStore(dir string, log logr.Logger) *IconStore {
+	return &IconStore{
+		log:   log,
+		dir:   dir,
+		icons: make(map[string]Icon),
+	}
+}
+
+// Load reads the icons in the directory, replacing the ones read before
+func (is *IconStore) Load() error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	return is.load(dirStamp(is.dir))
+}
+
+func (is *IconStore) load(stamp string) error {
+	infos, err := ioutil.ReadDir(is.dir)
+	if err != nil {
+		return err
+	}
+	icons := make(map[string]Icon)
+	for _, info := range infos {
+		// the ConfigMaps keep their data in hidden directories
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(info.Name())
+		contentType, ok := iconTypes[strings.ToLower(ext)]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(is.dir, info.Name())
+		// stat again, resolving the symlinks of the ConfigMaps
+		resolved, err := os.Stat(path)
+		if err != nil || resolved.IsDir() {
+			continue
+		}
+		if resolved.Size() > MaxIconBytes {
+			is.log.Info(fmt.Sprintf("skipping icon %s: too big, %d bytes", path, resolved.Size()))
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			is.log.Error(err, fmt.Sprintf("unable to read icon %s", path))
+			continue
+		}
+		id := strings.TrimSuffix(info.Name(), ext)
+		icons[id] = newIcon(id, contentType, data, resolved.ModTime())
+	}
+	is.icons = icons
+	is.stamp = stamp
+	is.log.Info(fmt.Sprintf("loaded %d icons from %s", len(icons), is.dir))
+	return nil
+}
+
+// Check reloads the icons if the directory changed since the last load, telling if it did
+func (is *IconStore) Check() bool {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	stamp := dirStamp(is.dir)
+	if stamp == is.stamp {
+		return false
+	}
+	if err := is.load(stamp); err != nil {
+		// keep the old stamp, so we retry at the next check
+		is.log.Error(err, fmt.Sprintf("unable to reload the icons from %s", is.dir))
+		return false
+	}
+	return true
+}
+
+// Run checks the directory every interval, until stop is closed
+func (is *IconStore) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			is.Check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Icon returns the icon of the icon class
+func (is *IconStore) Icon(id string) (Icon, bool) {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+
+	icon, ok := is.icons[id]
+	return icon, ok
+}
+
+// dirStamp summarizes the state of the files in dir, following the symlinks like fileStamp does,
+// so it changes when a mounted ConfigMap is updated
+func dirStamp(dir string) string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	stamps := []string{}
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(filepath.Join(dir, info.Name()))
+		if err != nil {
+			continue
+		}
+		target, err := os.Stat(resolved)
+		if err != nil {
+			continue
+		}
+		stamps = append(stamps, fmt.Sprintf("%s:%d:%d", resolved, target.Size(), target.ModTime().UnixNano()))
+	}
+	sort.Strings(stamps)
+	return strings.Join(stamps, ",")
+}
+
+// SetIcons makes the descriptions link the icons of the store, and the ones embedded in the templates,
+// prefixing their IDs with baseURL, like "/api/v1/icons/". The store may be nil, to link only the embedded ones.
+func (ti *TemplateIndexer) SetIcons(store *IconStore, baseURL string) {
+	ti.rwlock.Lock()
+	defer ti.rwlock.Unlock()
+
+	ti.icons = store
+	ti.iconsBaseURL = baseURL
+}
+
+// Icon returns the icon with the given ID: either an icon class of the store, or an icon embedded in a template
+func (ti *TemplateIndexer) Icon(id string) (Icon, bool) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	if strings.HasPrefix(id, dataIconPrefix) {
+		for _, icon := range ti.dataIcons {
+			if icon.ID == id {
+				return icon, true
+			}
+		}
+		return Icon{}, false
+	}
+	if ti.icons == nil {
+		return Icon{}, false
+	}
+	return ti.icons.Icon(id)
+}
+
+// iconURL returns the URL of the icon of the template, or "" if it has none or SetIcons was not called
+func (ti *TemplateIndexer) iconURL(t *templatev1.Template) string {
+	if ti.iconsBaseURL == "" {
+		return ""
+	}
+	if icon, ok := ti.dataIcons[keyOf(t)]; ok {
+		return ti.iconsBaseURL + icon.ID
+	}
+	class := t.Annotations["iconClass"]
+	if ti.icons == nil || class == "" {
+		return ""
+	}
+	if _, ok := ti.icons.Icon(class); !ok {
+		return ""
+	}
+	return ti.iconsBaseURL + class
+}
+
+// indexDataIcon must be called with the write lock held
+func (ti *TemplateIndexer) indexDataIcon(t *templatev1.Template) {
+	icon, ok, err := templateDataIcon(t)
+	if err != nil {
+		ti.log.Info(fmt.Sprintf("ignoring the icon of template %s: %v", t.Name, err))
+	}
+	if !ok {
+		delete(ti.dataIcons, keyOf(t))
+		return
+	}
+	ti.dataIcons[keyOf(t)] = icon
+}
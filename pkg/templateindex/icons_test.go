@@ -0,0 +1,160 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+)
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1"/>`
+
+func TestParseDataIcon(t *testing.T) {
+	icon, err := ParseDataIcon("data:image/svg+xml;base64,PHN2Zy8+")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if icon.ContentType != "image/svg+xml" || string(icon.Data) != "<svg/>" {
+		t.Errorf("unexpected icon: %v %q", icon.ContentType, icon.Data)
+	}
+	if !strings.HasPrefix(icon.ID, dataIconPrefix) || icon.ETag == "" {
+		t.Errorf("unexpected icon ID %q or ETag %q", icon.ID, icon.ETag)
+	}
+
+	escaped, err := ParseDataIcon("data:image/svg+xml,%3Csvg/%3E")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if escaped.ID != icon.ID {
+		t.Errorf("same content, different IDs: %v %v", escaped.ID, icon.ID)
+	}
+
+	for _, bad := range []string{
+		"image/png;base64,AAAA",
+		"data:text/html,<script/>",
+		"data:image/png;base64,not base64!",
+		"data:image/png;base64",
+	} {
+		if _, err := ParseDataIcon(bad); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestIconStoreReloadsOnSymlinkSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iconstore")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigMapData(t, dir, "1", "icon-centos.svg", testSVG)
+	store := NewIconStore(dir, logf.NullLogger{})
+	if err := store.Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	icon, ok := store.Icon("icon-centos")
+	if !ok || icon.ContentType != "image/svg+xml" || string(icon.Data) != testSVG {
+		t.Errorf("unexpected icon: %v %v", ok, icon)
+	}
+	if store.Check() {
+		t.Errorf("reloaded without changes")
+	}
+
+	writeConfigMapData(t, dir, "2", "icon-centos.svg", `<svg xmlns="http://www.w3.org/2000/svg"/>`)
+	if !store.Check() {
+		t.Errorf("not reloaded after the change")
+	}
+	updated, _ := store.Icon("icon-centos")
+	if updated.ETag == icon.ETag {
+		t.Errorf("icon not reloaded: %v", updated)
+	}
+	if _, ok := store.Icon("..data"); ok {
+		t.Errorf("hidden files loaded as icons")
+	}
+}
+
+func TestTemplateIndexerIcons(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 2 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	dir, err := ioutil.TempDir("", "iconstore")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	class := templates[0].Annotations["iconClass"]
+	if err := ioutil.WriteFile(filepath.Join(dir, class+".svg"), []byte(testSVG), 0644); err != nil {
+		t.Fatalf("cannot write icon: %v", err)
+	}
+	store := NewIconStore(dir, logf.NullLogger{})
+	if err := store.Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.SetIcons(store, "/icons/")
+	ti.Set(&templates[0])
+	embedded := templates[1].DeepCopy()
+	embedded.Annotations[IconDataAnnotation] = "data:image/png;base64,iVBORw0KGgo="
+	ti.Set(embedded)
+
+	var urls []string
+	ti.View(func(v *View) error {
+		for _, dt := range v.Templates(FilterOptions{}) {
+			urls = append(urls, dt.IconURL)
+		}
+		return nil
+	})
+	if len(urls) != 2 {
+		t.Fatalf("unexpected templates: %v", urls)
+	}
+	dataURL := ""
+	for _, url := range urls {
+		if strings.HasPrefix(url, "/icons/"+dataIconPrefix) {
+			dataURL = url
+		} else if url != "/icons/"+class {
+			t.Errorf("unexpected icon URL: %q", url)
+		}
+	}
+	if dataURL == "" {
+		t.Fatalf("missing the URL of the embedded icon: %v", urls)
+	}
+
+	if icon, ok := ti.Icon(class); !ok || icon.ContentType != "image/svg+xml" {
+		t.Errorf("unexpected icon of class %v: %v %v", class, ok, icon)
+	}
+	id := strings.TrimPrefix(dataURL, "/icons/")
+	if icon, ok := ti.Icon(id); !ok || icon.ContentType != "image/png" {
+		t.Errorf("unexpected embedded icon %v: %v %v", id, ok, icon)
+	}
+
+	ti.Delete(embedded.Namespace, embedded.Name)
+	if _, ok := ti.Icon(id); ok {
+		t.Errorf("embedded icon still served after the deletion of its template")
+	}
+}
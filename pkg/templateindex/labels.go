@@ -48,9 +48,18 @@ func makeLabel(key, value string) string {
 	return fmt.Sprintf("%s.%s/%s", key, suffix, value)
 }
 
+// labelPrefix expands short labels like "os" in the full prefix "os.template.cnv.io".
+// Labels which already contain a domain are used as they are.
+func labelPrefix(label string) string {
+	if strings.Contains(label, ".") {
+		return label
+	}
+	return fmt.Sprintf("%s.%s", label, suffix)
+}
+
 func extractFlavours(t *templatev1.Template, label string) []string {
 	flavours := []string{}
-	label = fmt.Sprintf("%s.%s", label, suffix)
+	label = labelPrefix(label)
 	for key, value := range t.Labels {
 		if flavour, ok := tryToGetFlavour(key, value, label); ok {
 			flavours = append(flavours, flavour)
@@ -61,7 +70,7 @@ func extractFlavours(t *templatev1.Template, label string) []string {
 }
 
 func tryToGetFlavour(key, value, label string) (string, bool) {
-	if strings.HasPrefix(key, label) && value == "true" {
+	if strings.HasPrefix(key, label+"/") && value == "true" {
 		if flavour, ok := splitLabel(key); ok {
 			return flavour, ok
 		}
@@ -20,8 +20,13 @@ package templateindex
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	templatev1 "github.com/openshift/api/template/v1"
 )
@@ -29,6 +34,10 @@ import (
 type Summary struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
+	// how many templates have this ID. Filled only on request.
+	Count int `json:"count,omitempty"`
+	// only the OS ledger fills this
+	*OSInfo
 }
 
 type Description struct {
@@ -38,19 +47,42 @@ type Description struct {
 	OS          string `json:"osid"`
 	Workload    string `json:"workload"`
 	Size        string `json:"size"`
+	// where the HTTP API serves the icon; empty if it has none
+	IconURL string `json:"iconURL,omitempty"`
+	// the version of the schema of the template
+	Version string `json:"version,omitempty"`
+	// the API version of the VM object
+	VMAPIVersion string `json:"vm-api-version,omitempty"`
+	Lifecycle
+	// all the values of the template, for each ledger
+	Facets map[string][]string `json:"facets,omitempty"`
 }
 
-func Describe(t *templatev1.Template, opts FilterOptions) Description {
+// SearchResult is a template matching a search query
+type SearchResult struct {
+	Description
+	Score float64 `json:"score"`
+	// snippets of the matching fields, with the matching words enclosed in <em></em>
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+func Describe(t *templatev1.Template, opts FilterOptions, langs ...string) Description {
+	chain := FallbackChain(langs)
 	desc := Description{
 		Summary: Summary{
 			ID:   t.Name,
-			Name: t.Annotations["openshift.io/display-name"],
+			Name: localizedAnnotation(t.Annotations, "openshift.io/display-name", chain),
 		},
-		Description: t.Annotations["description"],
+		Description: localizedAnnotation(t.Annotations, "description", chain),
 		Icon:        t.Annotations["iconClass"],
 		OS:          opts["os"],
 		Workload:    opts["workload"],
 		Size:        opts["size"],
+		Version:     t.Annotations[templateVersionAnnotation],
+		Lifecycle:   templateLifecycle(t, time.Now()),
+	}
+	if vms := virtualMachines(t); len(vms) > 0 {
+		desc.VMAPIVersion = vms[0].APIVersion
 	}
 	for key, value := range t.Labels {
 		if os, ok := tryToGetFlavour(key, value, "os.template.cnv.io"); ok && desc.OS == "" {
@@ -67,43 +99,100 @@ func Describe(t *templatev1.Template, opts FilterOptions) Description {
 }
 
 type Ledger interface {
-	Summarize([]templatev1.Template) []Summary
+	// Summarize the given templates, using the names in the first of the given languages available.
+	Summarize(templates []templatev1.Template, langs ...string) []Summary
+	// Values returns the IDs the template has for this ledger
+	Values(t *templatev1.Template) []string
+}
+
+// NameMapper is implemented by the ledgers which can tell about the names they use.
+// The name maps are keyed by language first, then by ID.
+type NameMapper interface {
+	NameMap() map[string]map[string]string
 }
 
 type JSONLedger struct {
 	label string
-	names map[string]string
+	lock  sync.RWMutex
+	// language -> ID -> name
+	names map[string]map[string]string
 }
 
 func NewJSONLedger(label string) *JSONLedger {
 	return &JSONLedger{
 		label: label,
-		names: make(map[string]string),
+		names: make(map[string]map[string]string),
 	}
 }
 
+// ReadNameMap loads the names from the JSON file at path.
+// The values of the map can be either plain names, which are set for the DefaultLanguage,
+// or maps from languages to names. Furthermore, the names for a given language can be
+// supplied in a separate file with the language in its name: the names for "de" for
+// the file "size" (or "size.json") are looked for in "size.de.json".
 func (ld *JSONLedger) ReadNameMap(path string) error {
 	if path == "" {
 		return nil
 	}
 
-	src, err := os.Open(path)
-	defer src.Close()
+	// decode in a fresh map, so a broken file never leaves us half-updated
+	names := make(map[string]map[string]string)
+	err := readNameMapFile(path, names)
 	if err != nil {
 		return err
 	}
 
-	dec := json.NewDecoder(src)
-	err = dec.Decode(&ld.names)
-	return err
+	for _, localePath := range nameMapFiles(path)[1:] {
+		lang := localeFromPath(path, localePath)
+		localeNames := make(map[string]string)
+		err = decodeJSONFile(localePath, &localeNames)
+		if err != nil {
+			return err
+		}
+		for id, name := range localeNames {
+			setName(names, lang, id, name)
+		}
+	}
+
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+	ld.names = names
+	return nil
 }
 
-func (ld *JSONLedger) Summarize(templates []templatev1.Template) []Summary {
+// NameMap returns a copy of the name map currently in use
+func (ld *JSONLedger) NameMap() map[string]map[string]string {
+	ld.lock.RLock()
+	defer ld.lock.RUnlock()
+
+	names := make(map[string]map[string]string)
+	for lang, langNames := range ld.names {
+		for id, name := range langNames {
+			setName(names, lang, id, name)
+		}
+	}
+	return names
+}
+
+func (ld *JSONLedger) Values(t *templatev1.Template) []string {
+	return extractFlavours(t, ld.label)
+}
+
+func (ld *JSONLedger) Summarize(templates []templatev1.Template, langs ...string) []Summary {
+	return ld.summarize(templates, ld.Values, langs)
+}
+
+// summarize the templates using the names of the ledger, and the values extracted by the given function
+func (ld *JSONLedger) summarize(templates []templatev1.Template, values func(*templatev1.Template) []string, langs []string) []Summary {
+	ld.lock.RLock()
+	defer ld.lock.RUnlock()
+
+	chain := FallbackChain(langs)
 	seen := NewStringSet()
 	summaries := []Summary{}
 
 	for _, template := range templates {
-		flavours := extractFlavours(&template, ld.label)
+		flavours := values(&template)
 
 		for _, flavour := range flavours {
 			if seen.Contains(flavour) {
@@ -112,7 +201,7 @@ func (ld *JSONLedger) Summarize(templates []templatev1.Template) []Summary {
 
 			summaries = append(summaries, Summary{
 				ID:   flavour,
-				Name: ld.names[flavour],
+				Name: ld.lookupName(flavour, chain),
 			})
 			seen.Add(flavour)
 		}
@@ -121,6 +210,85 @@ func (ld *JSONLedger) Summarize(templates []templatev1.Template) []Summary {
 	return summaries
 }
 
+func (ld *JSONLedger) lookupName(id string, chain []string) string {
+	for _, lang := range chain {
+		if name := ld.names[lang][id]; name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func readNameMapFile(path string, names map[string]map[string]string) error {
+	entries := make(map[string]json.RawMessage)
+	err := decodeJSONFile(path, &entries)
+	if err != nil {
+		return err
+	}
+
+	for id, entry := range entries {
+		var name string
+		if err := json.Unmarshal(entry, &name); err == nil {
+			setName(names, DefaultLanguage, id, name)
+			continue
+		}
+
+		localized := make(map[string]string)
+		if err := json.Unmarshal(entry, &localized); err != nil {
+			return fmt.Errorf("%s: invalid name for %q: %v", path, id, err)
+		}
+		for lang, name := range localized {
+			setName(names, NormalizeLanguage(lang), id, name)
+		}
+	}
+	return nil
+}
+
+func decodeJSONFile(path string, v interface{}) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return json.NewDecoder(src).Decode(v)
+}
+
+func setName(names map[string]map[string]string, lang, id, name string) {
+	if _, ok := names[lang]; !ok {
+		names[lang] = make(map[string]string)
+	}
+	names[lang][id] = name
+}
+
+// nameMapFiles returns the name map file at path, followed by all its per-language files
+func nameMapFiles(path string) []string {
+	files := []string{path}
+	matches, err := filepath.Glob(nameMapStem(path) + ".*.json")
+	if err != nil {
+		return files
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		if localeFromPath(path, match) != "" {
+			files = append(files, match)
+		}
+	}
+	return files
+}
+
+func nameMapStem(path string) string {
+	return strings.TrimSuffix(path, ".json")
+}
+
+func localeFromPath(path, localePath string) string {
+	lang := strings.TrimSuffix(strings.TrimPrefix(localePath, nameMapStem(path)+"."), ".json")
+	if lang == "" || strings.Contains(lang, ".") {
+		return ""
+	}
+	return NormalizeLanguage(lang)
+}
+
 type byID []Summary
 
 func (a byID) Len() int           { return len(a) }
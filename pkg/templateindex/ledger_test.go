@@ -21,6 +21,10 @@ package templateindex
 import (
 	"testing"
 
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
 	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
 )
 
@@ -164,6 +168,47 @@ func TestSizeLedgerWithNames(t *testing.T) {
 	checkSummaries(t, summaries, expected)
 }
 
+func TestSizeLedgerWithLocalizedNames(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ld := NewJSONLedger("flavor")
+	err = ld.ReadNameMap("test-size-names-localized.json")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	summaries := ld.Summarize(templates, "de-DE", "ja")
+
+	expected := []Summary{
+		Summary{
+			ID:   "large",
+			Name: "ziemlich großer Instanztyp",
+		},
+		Summary{
+			ID:   "medium",
+			Name: "average instance type",
+		},
+		Summary{
+			ID:   "small",
+			Name: "kleiner Instanztyp",
+		},
+		Summary{
+			ID:   "tiny",
+			Name: "minuscule instance type",
+		},
+	}
+	checkSummaries(t, summaries, expected)
+
+	summaries = ld.Summarize(templates, "ja")
+	if summaries[2].Name != "小さいインスタンスタイプ" {
+		t.Errorf("unexpected name: %#v", summaries[2])
+	}
+}
+
 func checkSummaries(t *testing.T, summaries, expected []Summary) {
 	if len(expected) != len(summaries) {
 		t.Errorf("expected %v summaries, received %v", len(expected), len(summaries))
@@ -174,3 +219,26 @@ func checkSummaries(t *testing.T, summaries, expected []Summary) {
 		}
 	}
 }
+
+// newTestIndexer indexes the test templates with the os, workload and size ledgers.
+// If not nil, prepare configures the indexer and returns the templates to index, changed or picked among the test ones.
+func newTestIndexer(t *testing.T, prepare func(ti *TemplateIndexer, templates []templatev1.Template) []templatev1.Template) *TemplateIndexer {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", NewOSLedger(NewJSONLedger("os")))
+	ti.AddLedger("workload", NewJSONLedger("workload"))
+	ti.AddLedger("size", NewJSONLedger("flavor"))
+	if prepare != nil {
+		templates = prepare(ti, templates)
+	}
+
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Fatalf("cannot add test templates! %v", err)
+	}
+	return ti
+}
@@ -0,0 +1,190 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// LedgerTypeLabel summarizes boolean labels like "<prefix>/<id>: true"
+	LedgerTypeLabel = "label"
+	// LedgerTypeOS is like LedgerTypeLabel, but also describes the OSes using the osinfo database
+	LedgerTypeOS = "os"
+	// LedgerTypeLabelValue summarizes the values of a label, like "template.cnv.io/type: base"
+	LedgerTypeLabelValue = "label-value"
+	// LedgerTypeAnnotation summarizes the values of an annotation, like "template.cnv.io/version: v1alpha1"
+	LedgerTypeAnnotation = "annotation"
+	// LedgerTypeTags summarizes the items of comma-separated lists in an annotation, like "tags: kubevirt,linux"
+	LedgerTypeTags = "tags"
+	// LedgerTypeAPIVersion summarizes the API versions of the objects of an API group, like "kubevirt.io/v1alpha2"
+	LedgerTypeAPIVersion = "api-version"
+)
+
+// LedgerConfig describes one ledger, and how it is exposed
+type LedgerConfig struct {
+	// Name of the ledger, also used as filter parameter
+	Name string `json:"name"`
+	// Type of the ledger, defaults to LedgerTypeLabel
+	Type string `json:"type,omitempty"`
+	// Label is the prefix of the labels to summarize, like "gpu.template.cnv.io".
+	// Short labels, like "gpu", are expanded in "gpu.template.cnv.io".
+	// For the LedgerTypeLabelValue, LedgerTypeAnnotation and LedgerTypeTags ledgers,
+	// this is the full key of the label or of the annotation.
+	// For the LedgerTypeAPIVersion ledgers, this is the API group, like "kubevirt.io".
+	Label string `json:"label"`
+	// Names is the path of the name map file. Relative paths are resolved against
+	// the configuration directory. Defaults to Name.
+	Names string `json:"names,omitempty"`
+	// Route is the HTTP path of the summary endpoint. No endpoint is exposed if empty.
+	Route string `json:"route,omitempty"`
+	// Versions are the rules splitting the OS ids in family and version, for the LedgerTypeOS ledgers.
+	// Defaults to DefaultOSVersionRules.
+	Versions OSVersionRules `json:"versions,omitempty"`
+}
+
+type LedgersConfig struct {
+	Ledgers []LedgerConfig `json:"ledgers"`
+}
+
+// DefaultLedgersConfig returns the ledgers for the kubevirt common templates.
+// Besides the summarized ones, it indexes the schema version of the templates
+// and the API version of their VM objects.
+func DefaultLedgersConfig() *LedgersConfig {
+	return &LedgersConfig{
+		Ledgers: []LedgerConfig{
+			LedgerConfig{
+				Name:  "os",
+				Type:  LedgerTypeOS,
+				Label: "os",
+				Route: "/oses",
+			},
+			LedgerConfig{
+				Name:  "workload",
+				Label: "workload",
+				Route: "/workloads",
+			},
+			LedgerConfig{
+				Name:  "size",
+				Label: "flavor",
+				Route: "/sizes",
+			},
+			LedgerConfig{
+				Name:  "version",
+				Type:  LedgerTypeAnnotation,
+				Label: templateVersionAnnotation,
+			},
+			LedgerConfig{
+				Name:  "apiversion",
+				Type:  LedgerTypeAPIVersion,
+				Label: kubevirtGroup,
+			},
+		},
+	}
+}
+
+// ReadLedgersConfig loads the ledgers configuration from the YAML (or JSON) file at path
+func ReadLedgersConfig(path string) (*LedgersConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &LedgersConfig{}
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg *LedgersConfig) Validate() error {
+	names := NewStringSet()
+	routes := NewStringSet()
+	for i, lc := range cfg.Ledgers {
+		if lc.Name == "" {
+			return fmt.Errorf("ledger #%d: missing name", i)
+		}
+		if names.Contains(lc.Name) {
+			return fmt.Errorf("ledger %s: duplicate name", lc.Name)
+		}
+		names.Add(lc.Name)
+
+		if lc.Label == "" {
+			return fmt.Errorf("ledger %s: missing label", lc.Name)
+		}
+
+		switch lc.Type {
+		case "", LedgerTypeLabel, LedgerTypeOS, LedgerTypeLabelValue, LedgerTypeAnnotation, LedgerTypeTags, LedgerTypeAPIVersion:
+		default:
+			return fmt.Errorf("ledger %s: unknown type %q", lc.Name, lc.Type)
+		}
+
+		if len(lc.Versions) > 0 {
+			if lc.Type != LedgerTypeOS {
+				return fmt.Errorf("ledger %s: versions are supported only by the %s ledgers", lc.Name, LedgerTypeOS)
+			}
+			if err := lc.Versions.Compile(); err != nil {
+				return fmt.Errorf("ledger %s: %v", lc.Name, err)
+			}
+		}
+
+		if lc.Route != "" {
+			if routes.Contains(lc.Route) {
+				return fmt.Errorf("ledger %s: duplicate route %s", lc.Name, lc.Route)
+			}
+			routes.Add(lc.Route)
+		}
+	}
+	return nil
+}
+
+// CheckRoutes checks the routes of the ledgers with check, which knows the routes they must not collide with
+func (cfg *LedgersConfig) CheckRoutes(check func(route string) error) error {
+	for _, lc := range cfg.Ledgers {
+		if lc.Route == "" {
+			continue
+		}
+		if err := check(lc.Route); err != nil {
+			return fmt.Errorf("ledger %s: %v", lc.Name, err)
+		}
+	}
+	return nil
+}
+
+// NamesPath returns the path of the name map file of the ledger
+func (lc LedgerConfig) NamesPath(configDir string) string {
+	names := lc.Names
+	if names == "" {
+		names = lc.Name
+	}
+	if filepath.IsAbs(names) {
+		return names
+	}
+	return filepath.Join(configDir, names)
+}
@@ -0,0 +1,113 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReadLedgersConfig(t *testing.T) {
+	cfg, err := ReadLedgersConfig("test-ledgers.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Ledgers) != 8 {
+		t.Fatalf("unexpected ledgers: %#v", cfg.Ledgers)
+	}
+
+	gpu := cfg.Ledgers[3]
+	if gpu.Name != "gpu" || gpu.Label != "gpu.template.cnv.io" || gpu.Route != "/gpus" {
+		t.Errorf("unexpected ledger: %#v", gpu)
+	}
+	if path := gpu.NamesPath("/etc/template-index"); path != "/etc/template-index/gpu.json" {
+		t.Errorf("unexpected names path: %v", path)
+	}
+	if path := cfg.Ledgers[1].NamesPath("/etc/template-index"); path != "/etc/template-index/workload" {
+		t.Errorf("unexpected names path: %v", path)
+	}
+
+	osVersion := cfg.Ledgers[0].Versions.ParseOSVersion("win2k12r2")
+	if osVersion.Family != "winserver" || osVersion.Version != "12" {
+		t.Errorf("unexpected version: %#v", osVersion)
+	}
+
+	tags := cfg.Ledgers[7]
+	if tags.Name != "tag" || tags.Type != LedgerTypeTags || tags.Label != "tags" {
+		t.Errorf("unexpected ledger: %#v", tags)
+	}
+}
+
+func TestReadLedgersConfigMissing(t *testing.T) {
+	_, err := ReadLedgersConfig("test-does-not-exist.yaml")
+	if err == nil {
+		t.Errorf("unexpectedly succesful")
+	}
+}
+
+func TestLedgersConfigValidate(t *testing.T) {
+	invalid := []LedgersConfig{
+		LedgersConfig{Ledgers: []LedgerConfig{LedgerConfig{Label: "os"}}},
+		LedgersConfig{Ledgers: []LedgerConfig{LedgerConfig{Name: "os"}}},
+		LedgersConfig{Ledgers: []LedgerConfig{LedgerConfig{Name: "os", Label: "os", Type: "foobar"}}},
+		LedgersConfig{Ledgers: []LedgerConfig{
+			LedgerConfig{Name: "os", Label: "os"},
+			LedgerConfig{Name: "os", Label: "flavor"},
+		}},
+		LedgersConfig{Ledgers: []LedgerConfig{
+			LedgerConfig{Name: "os", Label: "os", Route: "/foo"},
+			LedgerConfig{Name: "size", Label: "flavor", Route: "/foo"},
+		}},
+		LedgersConfig{Ledgers: []LedgerConfig{LedgerConfig{Name: "os", Label: "os", Type: LedgerTypeOS,
+			Versions: OSVersionRules{OSVersionRule{Pattern: "^(?P<family>[a-z]+)$"}},
+		}}},
+		LedgersConfig{Ledgers: []LedgerConfig{LedgerConfig{Name: "size", Label: "flavor",
+			Versions: DefaultOSVersionRules(),
+		}}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("unexpectedly valid: %#v", cfg)
+		}
+	}
+
+	if err := DefaultLedgersConfig().Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLedgersConfigCheckRoutes(t *testing.T) {
+	cfg := DefaultLedgersConfig()
+	cfg.Ledgers = append(cfg.Ledgers, LedgerConfig{Name: "gpu", Label: "gpu", Route: "/search"})
+	check := func(route string) error {
+		if route == "/search" {
+			return fmt.Errorf("route %s: taken", route)
+		}
+		return nil
+	}
+
+	err := cfg.CheckRoutes(check)
+	if err == nil || !strings.Contains(err.Error(), "ledger gpu") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := DefaultLedgersConfig().CheckRoutes(check); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
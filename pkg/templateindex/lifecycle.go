@@ -0,0 +1,103 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+const (
+	// "true" if the template should not be used anymore
+	deprecatedAnnotation = "template.kubevirt.io/deprecated"
+	// the template to use instead of the deprecated one
+	replacedByAnnotation = "template.kubevirt.io/replaced-by"
+	// the date, like 2019-06-30, after which the template is no longer supported
+	endOfSupportAnnotation = "template.kubevirt.io/end-of-support"
+
+	endOfSupportLayout = "2006-01-02"
+)
+
+// IncludeDeprecatedOption is the FilterOptions key (and the query parameter) which,
+// set to "true", includes the deprecated templates, which are otherwise skipped.
+const IncludeDeprecatedOption = "includeDeprecated"
+
+// Lifecycle tells if a template is deprecated, and what to use instead
+type Lifecycle struct {
+	// set if the template is annotated as deprecated, or it is past its end of support
+	Deprecated   bool   `json:"deprecated,omitempty"`
+	ReplacedBy   string `json:"replaced-by,omitempty"`
+	EndOfSupport string `json:"end-of-support,omitempty"`
+}
+
+// templateLifecycle reads the lifecycle annotations of the template, as they are at the given time.
+// Unparseable values are ignored.
+func templateLifecycle(t *templatev1.Template, now time.Time) Lifecycle {
+	lc := Lifecycle{
+		ReplacedBy:   t.Annotations[replacedByAnnotation],
+		EndOfSupport: t.Annotations[endOfSupportAnnotation],
+	}
+	if deprecated, err := strconv.ParseBool(t.Annotations[deprecatedAnnotation]); err == nil {
+		lc.Deprecated = deprecated
+	}
+	if lc.EndOfSupport != "" {
+		if eos, err := time.Parse(endOfSupportLayout, lc.EndOfSupport); err == nil && now.After(eos) {
+			lc.Deprecated = true
+		}
+	}
+	return lc
+}
+
+func isDeprecated(t *templatev1.Template) bool {
+	return templateLifecycle(t, time.Now()).Deprecated
+}
+
+// IncludeDeprecated tells if the options ask for the deprecated templates too
+func (opts FilterOptions) IncludeDeprecated() bool {
+	include, _ := strconv.ParseBool(opts[IncludeDeprecatedOption])
+	return include
+}
+
+// Deprecations describes the deprecated templates matching opts, sorted by name
+func (ti *TemplateIndexer) Deprecations(opts FilterOptions, langs ...string) ([]Description, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	opts = opts.Without(IncludeDeprecatedOption)
+	opts[IncludeDeprecatedOption] = "true"
+	f := ti.newFilter(opts)
+
+	descriptions := []Description{}
+	for _, template := range ti.templates {
+		if isDeprecated(&template) && ti.matches(&template, f) {
+			descriptions = append(descriptions, ti.describe(&template, f, langs))
+		}
+	}
+	sort.Sort(descriptionsByID(descriptions))
+	return descriptions, nil
+}
+
+type descriptionsByID []Description
+
+func (a descriptionsByID) Len() int           { return len(a) }
+func (a descriptionsByID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a descriptionsByID) Less(i, j int) bool { return a[i].ID < a[j].ID }
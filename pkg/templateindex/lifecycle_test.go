@@ -0,0 +1,133 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// deprecateTestTemplates deprecates the centos7 templates, replacing them with the fedora ones
+func deprecateTestTemplates(ti *TemplateIndexer, templates []templatev1.Template) []templatev1.Template {
+	for i := range templates {
+		switch templates[i].Name {
+		case "centos7-generic-large", "centos7-generic-medium":
+			templates[i].Annotations[deprecatedAnnotation] = "true"
+			templates[i].Annotations[replacedByAnnotation] = "fedora-generic-large"
+		case "centos7-generic-small":
+			templates[i].Annotations[endOfSupportAnnotation] = "2018-01-01"
+		case "centos7-generic-tiny":
+			templates[i].Annotations[endOfSupportAnnotation] = "2999-12-31"
+		}
+	}
+	return templates
+}
+
+func TestTemplateLifecycle(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		annotations map[string]string
+		expected    Lifecycle
+	}{
+		{map[string]string{}, Lifecycle{}},
+		{map[string]string{deprecatedAnnotation: "true", replacedByAnnotation: "foo"}, Lifecycle{Deprecated: true, ReplacedBy: "foo"}},
+		{map[string]string{deprecatedAnnotation: "false"}, Lifecycle{}},
+		{map[string]string{deprecatedAnnotation: "maybe"}, Lifecycle{}},
+		{map[string]string{endOfSupportAnnotation: "2018-12-31"}, Lifecycle{Deprecated: true, EndOfSupport: "2018-12-31"}},
+		{map[string]string{endOfSupportAnnotation: "2019-01-02"}, Lifecycle{EndOfSupport: "2019-01-02"}},
+		{map[string]string{endOfSupportAnnotation: "soon"}, Lifecycle{EndOfSupport: "soon"}},
+	} {
+		template := templatev1.Template{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+		if lc := templateLifecycle(&template, now); lc != tc.expected {
+			t.Errorf("annotations=%v expected=%#v received=%#v", tc.annotations, tc.expected, lc)
+		}
+	}
+}
+
+func TestDescribeByHidesDeprecated(t *testing.T) {
+	ti := newTestIndexer(t, deprecateTestTemplates)
+	descs, err := ti.DescribeBy(FilterOptions{"os": "centos7.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(descs) != 1 || descs[0].ID != "centos7-generic-tiny" || descs[0].EndOfSupport != "2999-12-31" {
+		t.Errorf("unexpected descriptions: %v", descs)
+	}
+
+	u, _ := url.Parse("/templates?os=centos7.0&includeDeprecated=true")
+	descs, err = ti.DescribeBy(FilterOptionsFromURL(u))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(descs) != 4 {
+		t.Errorf("unexpected descriptions: %v", descs)
+	}
+}
+
+func TestSummarizeByHidesDeprecated(t *testing.T) {
+	ti := newTestIndexer(t, deprecateTestTemplates)
+	summaries, err := ti.CountBy("size", FilterOptions{"os": "centos7.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkSummaries(t, summaries, []Summary{
+		Summary{ID: "tiny", Count: 1},
+	})
+
+	summaries, err = ti.CountBy("size", FilterOptions{"os": "centos7.0", IncludeDeprecatedOption: "true"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(summaries) != 4 {
+		t.Errorf("unexpected summaries: %v", summaries)
+	}
+}
+
+func TestDeprecations(t *testing.T) {
+	ti := newTestIndexer(t, deprecateTestTemplates)
+	descs, err := ti.Deprecations(FilterOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"centos7-generic-large", "centos7-generic-medium", "centos7-generic-small"}
+	if len(descs) != len(expected) {
+		t.Fatalf("unexpected deprecations: %v", descs)
+	}
+	for i, id := range expected {
+		if descs[i].ID != id || !descs[i].Deprecated {
+			t.Errorf("expected=%v received=%v", id, descs[i])
+		}
+	}
+	if descs[0].ReplacedBy != "fedora-generic-large" {
+		t.Errorf("unexpected replacement: %v", descs[0].ReplacedBy)
+	}
+
+	descs, err = ti.Deprecations(FilterOptions{"size": "small"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(descs) != 1 || descs[0].ID != "centos7-generic-small" {
+		t.Errorf("unexpected deprecations: %v", descs)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultLanguage holds the names given without any language
+	DefaultLanguage = "*"
+	// FallbackLanguage is tried when nothing else matched
+	FallbackLanguage = "en"
+)
+
+// NormalizeLanguage returns the canonical form of a language tag (e.g. "pt_BR" -> "pt-br")
+func NormalizeLanguage(lang string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(lang), "_", "-", -1))
+}
+
+// LanguagesFromRequest returns the languages requested by the client, in order of preference.
+// The "lang" query parameter, if present, takes precedence over the Accept-Language header.
+func LanguagesFromRequest(r *http.Request) []string {
+	if value := r.URL.Query().Get("lang"); value != "" {
+		langs := []string{}
+		for _, lang := range strings.Split(value, ",") {
+			if lang = NormalizeLanguage(lang); lang != "" {
+				langs = append(langs, lang)
+			}
+		}
+		return langs
+	}
+	return ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+}
+
+type weightedLanguage struct {
+	lang   string
+	weight float64
+}
+
+// ParseAcceptLanguage parses the value of an Accept-Language header,
+// returning the languages sorted by decreasing preference.
+func ParseAcceptLanguage(header string) []string {
+	weighted := []weightedLanguage{}
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		lang := NormalizeLanguage(parts[0])
+		if lang == "" {
+			continue
+		}
+
+		weight := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+				weight = q
+			}
+		}
+		if weight <= 0 {
+			continue
+		}
+		weighted = append(weighted, weightedLanguage{lang: lang, weight: weight})
+	}
+
+	sort.SliceStable(weighted, func(i, j int) bool {
+		return weighted[i].weight > weighted[j].weight
+	})
+
+	langs := []string{}
+	for _, wl := range weighted {
+		langs = append(langs, wl.lang)
+	}
+	return langs
+}
+
+// FallbackChain expands the given languages in the list of languages to try, in order.
+// Each regional variant is followed by its base language ("pt-br" -> "pt-br", "pt"),
+// and the chain always ends with the DefaultLanguage and the FallbackLanguage.
+func FallbackChain(langs []string) []string {
+	seen := NewStringSet()
+	chain := []string{}
+	add := func(lang string) {
+		if lang != "" && !seen.Contains(lang) {
+			chain = append(chain, lang)
+			seen.Add(lang)
+		}
+	}
+
+	for _, lang := range langs {
+		lang = NormalizeLanguage(lang)
+		if lang == DefaultLanguage {
+			continue
+		}
+		items := strings.Split(lang, "-")
+		for i := len(items); i > 0; i-- {
+			add(strings.Join(items[:i], "-"))
+		}
+	}
+	add(DefaultLanguage)
+	add(FallbackLanguage)
+	return chain
+}
+
+// localizedAnnotation returns the value of the annotation key in the first language of the chain
+// which has it. Localized annotations have the language appended to the key, like
+// "openshift.io/display-name.ja"; the DefaultLanguage uses the key as it is.
+func localizedAnnotation(annotations map[string]string, key string, chain []string) string {
+	for _, lang := range chain {
+		if lang == DefaultLanguage {
+			if value := annotations[key]; value != "" {
+				return value
+			}
+			continue
+		}
+		for annKey, value := range annotations {
+			if value != "" && strings.EqualFold(annKey, key+"."+lang) {
+				return value
+			}
+		}
+	}
+	return ""
+}
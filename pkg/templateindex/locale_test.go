@@ -0,0 +1,105 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+func checkLanguages(t *testing.T, langs, expected []string) {
+	if len(langs) != len(expected) {
+		t.Errorf("expected %v languages, received %v", expected, langs)
+		return
+	}
+	for i, exp := range expected {
+		if langs[i] != exp {
+			t.Errorf("expected=%v received=%v", exp, langs[i])
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	langs := ParseAcceptLanguage("fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5, ja;q=0")
+	checkLanguages(t, langs, []string{"fr-ch", "fr", "en", "de", "*"})
+}
+
+func TestParseAcceptLanguageEmpty(t *testing.T) {
+	checkLanguages(t, ParseAcceptLanguage(""), []string{})
+}
+
+func TestLanguagesFromRequestPrefersQuery(t *testing.T) {
+	r, err := http.NewRequest("GET", "http://localhost:18081/sizes?lang=ja,pt_BR", nil)
+	if err != nil {
+		t.Fatalf("cannot create request: %v", err)
+	}
+	r.Header.Set("Accept-Language", "de")
+	checkLanguages(t, LanguagesFromRequest(r), []string{"ja", "pt-br"})
+}
+
+func TestLanguagesFromRequestHeader(t *testing.T) {
+	r, err := http.NewRequest("GET", "http://localhost:18081/sizes", nil)
+	if err != nil {
+		t.Fatalf("cannot create request: %v", err)
+	}
+	r.Header.Set("Accept-Language", "de;q=0.5, it")
+	checkLanguages(t, LanguagesFromRequest(r), []string{"it", "de"})
+}
+
+func TestFallbackChain(t *testing.T) {
+	chain := FallbackChain([]string{"pt-BR", "de", "pt"})
+	checkLanguages(t, chain, []string{"pt-br", "pt", "de", DefaultLanguage, FallbackLanguage})
+}
+
+func TestFallbackChainEmpty(t *testing.T) {
+	checkLanguages(t, FallbackChain(nil), []string{DefaultLanguage, FallbackLanguage})
+}
+
+func TestDescribeLocalized(t *testing.T) {
+	template := templatev1.Template{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "fedora-generic-small",
+			Annotations: map[string]string{
+				"openshift.io/display-name":    "Fedora 23+ VM",
+				"openshift.io/display-name.ja": "Fedora 23+ 仮想マシン",
+				"description":                  "generic Fedora VM",
+				"description.de":               "generische Fedora VM",
+			},
+		},
+	}
+
+	desc := Describe(&template, FilterOptions{}, "ja")
+	if desc.Name != "Fedora 23+ 仮想マシン" || desc.Description != "generic Fedora VM" {
+		t.Errorf("unexpected description: %#v", desc)
+	}
+
+	desc = Describe(&template, FilterOptions{}, "de-AT")
+	if desc.Name != "Fedora 23+ VM" || desc.Description != "generische Fedora VM" {
+		t.Errorf("unexpected description: %#v", desc)
+	}
+
+	desc = Describe(&template, FilterOptions{})
+	if desc.Name != "Fedora 23+ VM" || desc.Description != "generic Fedora VM" {
+		t.Errorf("unexpected description: %#v", desc)
+	}
+}
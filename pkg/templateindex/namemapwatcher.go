@@ -0,0 +1,178 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+type watchedNameMap struct {
+	name   string
+	path   string
+	ledger *JSONLedger
+	stamp  string
+}
+
+// NameMapWatcher periodically checks the name map files of the ledgers,
+// and reloads them when they change.
+// ConfigMaps are mounted as symlinks pointing into the `..data` directory,
+// which is atomically swapped by the kubelet on updates, so we look at
+// the resolved path as well as at the file metadata.
+type NameMapWatcher struct {
+	lock     sync.Mutex
+	log      logr.Logger
+	interval time.Duration
+	entries  []*watchedNameMap
+}
+
+func NewNameMapWatcher(log logr.Logger, interval time.Duration) *NameMapWatcher {
+	return &NameMapWatcher{
+		log:      log,
+		interval: interval,
+	}
+}
+
+// Add starts watching the name map file at path, feeding the given ledger.
+// The ledger is expected to be already loaded from path.
+func (nw *NameMapWatcher) Add(name, path string, ld *JSONLedger) {
+	nw.lock.Lock()
+	defer nw.lock.Unlock()
+
+	nw.entries = append(nw.entries, &watchedNameMap{
+		name:   name,
+		path:   path,
+		ledger: ld,
+		stamp:  fileStamp(path),
+	})
+}
+
+// Check reloads all the name maps whose files changed since the last check.
+// Returns the number of the name maps reloaded.
+func (nw *NameMapWatcher) Check() int {
+	nw.lock.Lock()
+	defer nw.lock.Unlock()
+
+	count := 0
+	for _, entry := range nw.entries {
+		stamp := fileStamp(entry.path)
+		if stamp == entry.stamp {
+			continue
+		}
+
+		old := entry.ledger.NameMap()
+		err := entry.ledger.ReadNameMap(entry.path)
+		if err != nil {
+			// keep the old stamp, so we retry at the next check
+			nw.log.Error(err, fmt.Sprintf("unable to reload name map %s for ledger %s", entry.path, entry.name))
+			continue
+		}
+		entry.stamp = stamp
+		count += 1
+
+		changes := diffLocalizedNameMaps(old, entry.ledger.NameMap())
+		nw.log.Info(fmt.Sprintf("reloaded name map %s for ledger %s: %d changes", entry.path, entry.name, len(changes)))
+		for _, change := range changes {
+			nw.log.Info(fmt.Sprintf("ledger %s: %s", entry.name, change))
+		}
+	}
+	return count
+}
+
+// Run checks the name maps every interval, until stop is closed.
+func (nw *NameMapWatcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(nw.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			nw.Check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// DiffNameMaps returns a human readable, sorted, list of the changes between two name maps.
+func DiffNameMaps(before, after map[string]string) []string {
+	changes := []string{}
+	for key, value := range after {
+		oldValue, ok := before[key]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("added %s=%q", key, value))
+		} else if oldValue != value {
+			changes = append(changes, fmt.Sprintf("changed %s=%q -> %q", key, oldValue, value))
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, fmt.Sprintf("removed %s=%q", key, value))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func diffLocalizedNameMaps(before, after map[string]map[string]string) []string {
+	langs := NewStringSet()
+	for lang := range before {
+		langs.Add(lang)
+	}
+	for lang := range after {
+		langs.Add(lang)
+	}
+
+	changes := []string{}
+	for _, lang := range langs.Keys() {
+		for _, change := range DiffNameMaps(before[lang], after[lang]) {
+			if lang != DefaultLanguage {
+				change = fmt.Sprintf("[%s] %s", lang, change)
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// fileStamp summarizes the state of the name map at path, including all its per-language files
+func fileStamp(path string) string {
+	stamps := []string{}
+	for _, name := range nameMapFiles(path) {
+		resolved, err := filepath.EvalSymlinks(name)
+		if err != nil {
+			stamps = append(stamps, "")
+			continue
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			stamps = append(stamps, "")
+			continue
+		}
+		stamps = append(stamps, fmt.Sprintf("%s:%d:%d", resolved, info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(stamps, ",")
+}
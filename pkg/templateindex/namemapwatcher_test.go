@@ -0,0 +1,135 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+)
+
+// mimics what kubelet does when it updates a mounted ConfigMap
+func writeConfigMapData(t *testing.T, dir, version, name, content string) {
+	dataDir := filepath.Join(dir, "..data_"+version)
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatalf("cannot create %s: %v", dataDir, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("cannot write %s: %v", name, err)
+	}
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(dataDir), tmpLink); err != nil {
+		t.Fatalf("cannot create symlink: %v", err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("cannot swap symlink: %v", err)
+	}
+	link := filepath.Join(dir, name)
+	if _, err := os.Lstat(link); os.IsNotExist(err) {
+		if err := os.Symlink(filepath.Join("..data", name), link); err != nil {
+			t.Fatalf("cannot create symlink: %v", err)
+		}
+	}
+}
+
+func TestNameMapWatcherReloadsOnSymlinkSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "namemapwatcher")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigMapData(t, dir, "1", "size", `{"small": "small instance type"}`)
+	path := filepath.Join(dir, "size")
+
+	ld := NewJSONLedger("flavor")
+	if err := ld.ReadNameMap(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	nw := NewNameMapWatcher(logf.NullLogger{}, time.Second)
+	nw.Add("size", path, ld)
+
+	if count := nw.Check(); count != 0 {
+		t.Errorf("unexpected reload count: %v", count)
+	}
+
+	writeConfigMapData(t, dir, "2", "size", `{"small": "tiny instance type", "large": "big instance type"}`)
+
+	if count := nw.Check(); count != 1 {
+		t.Errorf("unexpected reload count: %v", count)
+	}
+	names := ld.NameMap()[DefaultLanguage]
+	if names["small"] != "tiny instance type" || names["large"] != "big instance type" {
+		t.Errorf("name map not reloaded: %v", names)
+	}
+}
+
+func TestNameMapWatcherKeepsNamesOnBrokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "namemapwatcher")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigMapData(t, dir, "1", "size", `{"small": "small instance type"}`)
+	path := filepath.Join(dir, "size")
+
+	ld := NewJSONLedger("flavor")
+	if err := ld.ReadNameMap(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	nw := NewNameMapWatcher(logf.NullLogger{}, time.Second)
+	nw.Add("size", path, ld)
+
+	writeConfigMapData(t, dir, "2", "size", `{"small": `)
+
+	if count := nw.Check(); count != 0 {
+		t.Errorf("unexpected reload count: %v", count)
+	}
+	names := ld.NameMap()[DefaultLanguage]
+	if names["small"] != "small instance type" {
+		t.Errorf("name map unexpectedly changed: %v", names)
+	}
+}
+
+func TestDiffNameMaps(t *testing.T) {
+	changes := DiffNameMaps(
+		map[string]string{"small": "S", "large": "L", "tiny": "T"},
+		map[string]string{"small": "S", "large": "XL", "medium": "M"},
+	)
+	expected := []string{
+		`added medium="M"`,
+		`changed large="L" -> "XL"`,
+		`removed tiny="T"`,
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %v changes, received %v", expected, changes)
+	}
+	for i, exp := range expected {
+		if changes[i] != exp {
+			t.Errorf("expected=%v received=%v", exp, changes[i])
+		}
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+const (
+	// templates can name the OSes they support with annotations like
+	// name.os.template.kubevirt.io/fedora28: "Fedora 28"
+	osNameAnnotationPrefix = "name.os.template.kubevirt.io/"
+	// and tell the short-id or the id of the OS in the osinfo database, when it differs, like
+	// osinfoname.os.template.kubevirt.io/rhel7.6: "rhel7.6-beta"
+	osInfoNameAnnotationPrefix = "osinfoname.os.template.kubevirt.io/"
+)
+
+// the annotations like vendor.os.template.kubevirt.io/fedora28: "Fedora Project" describe the OSes
+// the templates support, without the osinfo database or overriding it
+var osInfoAnnotationPrefixes = map[string]func(info *OSInfo) *string{
+	"vendor.os.template.kubevirt.io/":       func(info *OSInfo) *string { return &info.Vendor },
+	"family.os.template.kubevirt.io/":       func(info *OSInfo) *string { return &info.Family },
+	"distro.os.template.kubevirt.io/":       func(info *OSInfo) *string { return &info.Distro },
+	"version.os.template.kubevirt.io/":      func(info *OSInfo) *string { return &info.Version },
+	"release-date.os.template.kubevirt.io/": func(info *OSInfo) *string { return &info.ReleaseDate },
+	"eol-date.os.template.kubevirt.io/":     func(info *OSInfo) *string { return &info.EOLDate },
+}
+
+// OSInfo holds the details about an OS we can learn from the osinfo database
+type OSInfo struct {
+	Vendor      string `json:"vendor,omitempty"`
+	Family      string `json:"family,omitempty"`
+	Distro      string `json:"distro,omitempty"`
+	Version     string `json:"version,omitempty"`
+	ReleaseDate string `json:"release-date,omitempty"`
+	EOLDate     string `json:"eol-date,omitempty"`
+}
+
+type osInfoEntry struct {
+	Name string
+	Info OSInfo
+}
+
+// the subset of the libosinfo database format we care about
+type osInfoDBFile struct {
+	XMLName xml.Name       `xml:"libosinfo"`
+	OSes    []osInfoDBItem `xml:"os"`
+}
+
+type osInfoDBItem struct {
+	ID          string   `xml:"id,attr"`
+	ShortIDs    []string `xml:"short-id"`
+	Name        string   `xml:"name"`
+	Version     string   `xml:"version"`
+	Vendor      string   `xml:"vendor"`
+	Family      string   `xml:"family"`
+	Distro      string   `xml:"distro"`
+	ReleaseDate string   `xml:"release-date"`
+	EOLDate     string   `xml:"eol-date"`
+}
+
+// OSLedger summarizes the OSes of the templates, filling the names and the details
+// using, in order of precedence, the name maps of the JSONLedger, the name.os annotations
+// of the templates, the osinfo database and the display names of the templates.
+// The details come from the annotations of the templates, then from the osinfo database.
+// The OSes are looked up in the database by the osinfoname.os annotations, by the osinfoname
+// of the VMs, or by their own id.
+type OSLedger struct {
+	*JSONLedger
+	dbLock sync.RWMutex
+	// short-id or id -> entry
+	db    map[string]osInfoEntry
+	rules OSVersionRules
+}
+
+func NewOSLedger(ld *JSONLedger) *OSLedger {
+	return &OSLedger{
+		JSONLedger: ld,
+		db:         make(map[string]osInfoEntry),
+		rules:      DefaultOSVersionRules(),
+	}
+}
+
+// SetVersionRules replaces the rules splitting the OS ids in family and version.
+// The rules must be already compiled.
+func (ld *OSLedger) SetVersionRules(rules OSVersionRules) {
+	ld.dbLock.Lock()
+	defer ld.dbLock.Unlock()
+	ld.rules = rules
+}
+
+func (ld *OSLedger) OSVersion(id string) OSVersion {
+	ld.dbLock.RLock()
+	defer ld.dbLock.RUnlock()
+	return ld.rules.ParseOSVersion(id)
+}
+
+// FamilyName returns the name of the family from the name maps, or the family itself
+func (ld *OSLedger) FamilyName(family string, langs ...string) string {
+	ld.lock.RLock()
+	defer ld.lock.RUnlock()
+	if name := ld.lookupName(family, FallbackChain(langs)); name != "" {
+		return name
+	}
+	return family
+}
+
+// ReadOSInfoDB loads the libosinfo database at path, which can be either a single XML file
+// or a directory (e.g. /usr/share/osinfo) which is scanned recursively for XML files.
+func (ld *OSLedger) ReadOSInfoDB(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	db := make(map[string]osInfoEntry)
+	err := filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(name, ".xml") {
+			return nil
+		}
+		return readOSInfoDBFile(name, db)
+	})
+	if err != nil {
+		return err
+	}
+
+	ld.dbLock.Lock()
+	defer ld.dbLock.Unlock()
+	ld.db = db
+	return nil
+}
+
+func readOSInfoDBFile(path string, db map[string]osInfoEntry) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	data := osInfoDBFile{}
+	err = xml.NewDecoder(src).Decode(&data)
+	if err != nil {
+		// the database contains also files describing devices, platforms...
+		if _, ok := err.(xml.UnmarshalError); ok {
+			return nil
+		}
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for _, item := range data.OSes {
+		entry := osInfoEntry{
+			Name: strings.TrimSpace(item.Name),
+			Info: OSInfo{
+				Vendor:      strings.TrimSpace(item.Vendor),
+				Family:      strings.TrimSpace(item.Family),
+				Distro:      strings.TrimSpace(item.Distro),
+				Version:     strings.TrimSpace(item.Version),
+				ReleaseDate: strings.TrimSpace(item.ReleaseDate),
+				EOLDate:     strings.TrimSpace(item.EOLDate),
+			},
+		}
+		for _, shortID := range item.ShortIDs {
+			db[strings.TrimSpace(shortID)] = entry
+		}
+		if id := strings.TrimSpace(item.ID); id != "" {
+			db[id] = entry
+		}
+	}
+	return nil
+}
+
+// osHints collects what the templates tell about one OS
+type osHints struct {
+	name        string
+	displayName string
+	osinfoName  string
+	// from the VMs, less reliable than the OS id itself
+	vmOSInfoName string
+	info         OSInfo
+}
+
+func (ld *OSLedger) Summarize(templates []templatev1.Template, langs ...string) []Summary {
+	summaries := ld.JSONLedger.Summarize(templates, langs...)
+
+	hints := make(map[string]*osHints)
+	for _, template := range templates {
+		collectOSHints(&template, ld.label, hints)
+	}
+
+	ld.dbLock.RLock()
+	defer ld.dbLock.RUnlock()
+
+	for i := range summaries {
+		id := summaries[i].ID
+		hint, ok := hints[id]
+		if !ok {
+			hint = &osHints{}
+		}
+
+		entry, ok := ld.db[hint.osinfoName]
+		if !ok {
+			entry, ok = ld.db[id]
+		}
+		if !ok {
+			entry, ok = ld.db[hint.vmOSInfoName]
+		}
+		if info, known := mergeOSInfo(hint.info, entry.Info); ok || known {
+			summaries[i].OSInfo = &info
+		}
+
+		for _, name := range []string{hint.name, entry.Name, hint.displayName} {
+			if summaries[i].Name == "" {
+				summaries[i].Name = name
+			}
+		}
+	}
+	return summaries
+}
+
+func collectOSHints(t *templatev1.Template, label string, hints map[string]*osHints) {
+	oses := extractFlavours(t, label)
+	for _, osID := range oses {
+		if _, ok := hints[osID]; !ok {
+			hints[osID] = &osHints{}
+		}
+		hint := hints[osID]
+		if name := t.Annotations[osNameAnnotationPrefix+osID]; name != "" && hint.name == "" {
+			hint.name = name
+		}
+		if name := t.Annotations[osInfoNameAnnotationPrefix+osID]; name != "" && hint.osinfoName == "" {
+			hint.osinfoName = name
+		}
+		for prefix, field := range osInfoAnnotationPrefixes {
+			if value := strings.TrimSpace(t.Annotations[prefix+osID]); value != "" && *field(&hint.info) == "" {
+				*field(&hint.info) = value
+			}
+		}
+	}
+
+	// the following hints are ambiguous if the template supports more OSes
+	if len(oses) != 1 {
+		return
+	}
+	hint := hints[oses[0]]
+	for _, vm := range virtualMachines(t) {
+		if vm.Metadata.OSInfoName != "" && hint.vmOSInfoName == "" {
+			hint.vmOSInfoName = vm.Metadata.OSInfoName
+		}
+	}
+	if name := t.Annotations["openshift.io/display-name"]; name != "" && hint.displayName == "" {
+		hint.displayName = strings.TrimSuffix(name, " VM")
+	}
+}
+
+// mergeOSInfo fills the fields missing in info with the ones of fallback,
+// telling if info had any field
+func mergeOSInfo(info, fallback OSInfo) (OSInfo, bool) {
+	known := false
+	for _, field := range osInfoAnnotationPrefixes {
+		if *field(&info) != "" {
+			known = true
+		} else {
+			*field(&info) = *field(&fallback)
+		}
+	}
+	return info, known
+}
@@ -0,0 +1,228 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	templatev1 "github.com/openshift/api/template/v1"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+)
+
+func findSummary(summaries []Summary, id string) (Summary, bool) {
+	for _, summary := range summaries {
+		if summary.ID == id {
+			return summary, true
+		}
+	}
+	return Summary{}, false
+}
+
+func TestOSLedgerWithOSInfoDB(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ld := NewOSLedger(NewJSONLedger("os"))
+	err = ld.ReadOSInfoDB("test-osinfo-db.xml")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	summaries := ld.Summarize(templates)
+	if len(summaries) != 16 {
+		t.Errorf("unexpected summaries: %#v", summaries)
+	}
+
+	fedora, ok := findSummary(summaries, "fedora28")
+	if !ok || fedora.Name != "Fedora 28" || fedora.OSInfo == nil {
+		t.Fatalf("unexpected summary: %#v", fedora)
+	}
+	if fedora.Vendor != "Fedora Project" || fedora.Family != "linux" || fedora.ReleaseDate != "2018-05-01" {
+		t.Errorf("unexpected OS info: %#v", fedora.OSInfo)
+	}
+
+	// not in the database: the name comes from the template
+	ubuntu, ok := findSummary(summaries, "ubuntu18.04")
+	if !ok || ubuntu.Name != "Ubuntu 18.04 (Xenial Xerus)" || ubuntu.OSInfo != nil {
+		t.Errorf("unexpected summary: %#v", ubuntu)
+	}
+
+	// in the database, but shared among many templates
+	win10, ok := findSummary(summaries, "win10")
+	if !ok || win10.Name != "Microsoft Windows 10" || win10.Vendor != "Microsoft Corporation" {
+		t.Errorf("unexpected summary: %#v", win10)
+	}
+
+	// nothing known
+	win2k8, ok := findSummary(summaries, "win2k8")
+	if !ok || win2k8.Name != "" || win2k8.OSInfo != nil {
+		t.Errorf("unexpected summary: %#v", win2k8)
+	}
+}
+
+func TestOSLedgerJSONOverrides(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ld := NewOSLedger(NewJSONLedger("os"))
+	err = ld.ReadNameMap("test-os-names.json")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = ld.ReadOSInfoDB("test-osinfo-db.xml")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	summaries := ld.Summarize(templates)
+
+	centos, ok := findSummary(summaries, "centos7.0")
+	if !ok || centos.Name != "CentOS Linux 7" || centos.OSInfo == nil || centos.EOLDate != "2024-06-30" {
+		t.Errorf("unexpected summary: %#v", centos)
+	}
+}
+
+func TestOSLedgerNameAnnotations(t *testing.T) {
+	templates := []templatev1.Template{
+		templatev1.Template{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "fedora-generic-small",
+				Annotations: map[string]string{
+					"name.os.template.kubevirt.io/fedora28": "Fedora Twenty-Eight",
+				},
+				Labels: map[string]string{
+					"os.template.cnv.io/fedora27": "true",
+					"os.template.cnv.io/fedora28": "true",
+				},
+			},
+		},
+	}
+
+	ld := NewOSLedger(NewJSONLedger("os"))
+	err := ld.ReadOSInfoDB("test-osinfo-db.xml")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	summaries := ld.Summarize(templates)
+	expected := []Summary{
+		Summary{ID: "fedora27"},
+		Summary{ID: "fedora28", Name: "Fedora Twenty-Eight"},
+	}
+	if len(summaries) != len(expected) {
+		t.Fatalf("unexpected summaries: %#v", summaries)
+	}
+	for i, exp := range expected {
+		if exp.ID != summaries[i].ID || exp.Name != summaries[i].Name {
+			t.Errorf("expected=%#v received=%#v", exp, summaries[i])
+		}
+	}
+}
+
+func TestOSLedgerInfoAnnotations(t *testing.T) {
+	templates := []templatev1.Template{
+		templatev1.Template{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "rhel-generic-small",
+				Annotations: map[string]string{
+					"name.os.template.kubevirt.io/rhel7.6":         "Red Hat Enterprise Linux 7.6",
+					"vendor.os.template.kubevirt.io/rhel7.6":       "Red Hat, Inc.",
+					"family.os.template.kubevirt.io/rhel7.6":       "linux",
+					"release-date.os.template.kubevirt.io/rhel7.6": "2018-10-30",
+					"eol-date.os.template.kubevirt.io/rhel7.6":     "2024-06-30",
+				},
+				Labels: map[string]string{
+					"os.template.cnv.io/rhel7.6": "true",
+					"os.template.cnv.io/rhel7.7": "true",
+				},
+			},
+		},
+	}
+
+	// no osinfo database at all
+	ld := NewOSLedger(NewJSONLedger("os"))
+	summaries := ld.Summarize(templates)
+
+	rhel, ok := findSummary(summaries, "rhel7.6")
+	if !ok || rhel.Name != "Red Hat Enterprise Linux 7.6" || rhel.OSInfo == nil {
+		t.Fatalf("unexpected summary: %#v", rhel)
+	}
+	expected := OSInfo{Vendor: "Red Hat, Inc.", Family: "linux", ReleaseDate: "2018-10-30", EOLDate: "2024-06-30"}
+	if *rhel.OSInfo != expected {
+		t.Errorf("expected=%#v received=%#v", expected, *rhel.OSInfo)
+	}
+	if other, ok := findSummary(summaries, "rhel7.7"); !ok || other.OSInfo != nil {
+		t.Errorf("unexpected summary: %#v", other)
+	}
+}
+
+func TestOSLedgerOSInfoNameAnnotations(t *testing.T) {
+	templates := []templatev1.Template{
+		templatev1.Template{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "fedora-generic-small",
+				Annotations: map[string]string{
+					"osinfoname.os.template.kubevirt.io/fedora-latest": "http://fedoraproject.org/fedora/28",
+					"osinfoname.os.template.kubevirt.io/centos":        "centos7.0",
+					// the annotations win over the database
+					"vendor.os.template.kubevirt.io/centos": "The CentOS Project",
+				},
+				Labels: map[string]string{
+					"os.template.cnv.io/fedora-latest": "true",
+					"os.template.cnv.io/centos":        "true",
+				},
+			},
+		},
+	}
+
+	ld := NewOSLedger(NewJSONLedger("os"))
+	if err := ld.ReadOSInfoDB("test-osinfo-db.xml"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	summaries := ld.Summarize(templates)
+
+	fedora, ok := findSummary(summaries, "fedora-latest")
+	if !ok || fedora.Name != "Fedora 28" || fedora.OSInfo == nil || fedora.Vendor != "Fedora Project" {
+		t.Errorf("unexpected summary: %#v", fedora)
+	}
+	centos, ok := findSummary(summaries, "centos")
+	if !ok || centos.Name != "CentOS 7.0" || centos.OSInfo == nil {
+		t.Fatalf("unexpected summary: %#v", centos)
+	}
+	if centos.Vendor != "The CentOS Project" || centos.EOLDate != "2024-06-30" {
+		t.Errorf("unexpected OS info: %#v", centos.OSInfo)
+	}
+}
+
+func TestOSLedgerMissingOSInfoDB(t *testing.T) {
+	ld := NewOSLedger(NewJSONLedger("os"))
+	err := ld.ReadOSInfoDB("test-does-not-exist")
+	if err == nil {
+		t.Errorf("unexpectedly succesful")
+	}
+}
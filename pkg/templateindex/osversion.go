@@ -0,0 +1,271 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+const latestSelector = "latest"
+
+// OSVersionRule tells how to split OS ids like "rhel7.5" in a family ("rhel") and a version ("7.5")
+type OSVersionRule struct {
+	// Pattern is a regular expression matching the whole id, with the named groups "family" and "version"
+	Pattern string `json:"pattern"`
+	// Family, if given, is used instead of the "family" group
+	Family string `json:"family,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// OSVersionRules are tried in order, the first matching wins.
+// The ids not matching any rule are a family on their own, without a version.
+type OSVersionRules []OSVersionRule
+
+// DefaultOSVersionRules split the ids in the leading letters and the trailing dotted numbers
+func DefaultOSVersionRules() OSVersionRules {
+	rules := OSVersionRules{
+		OSVersionRule{
+			Pattern: `^(?P<family>[a-z]+)(?P<version>[0-9]+(\.[0-9]+)*)$`,
+		},
+	}
+	rules.Compile()
+	return rules
+}
+
+// Compile checks and prepares the rules. Must be called before to use them.
+func (rules OSVersionRules) Compile() error {
+	for i := range rules {
+		re, err := regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("version rule %q: %v", rules[i].Pattern, err)
+		}
+		groups := NewStringSet()
+		for _, name := range re.SubexpNames() {
+			groups.Add(name)
+		}
+		if !groups.Contains("version") || (!groups.Contains("family") && rules[i].Family == "") {
+			return fmt.Errorf("version rule %q: missing the \"family\" or the \"version\" group", rules[i].Pattern)
+		}
+		rules[i].re = re
+	}
+	return nil
+}
+
+// OSVersion is an OS id split in family and version
+type OSVersion struct {
+	ID      string `json:"id"`
+	Family  string `json:"family"`
+	Version string `json:"version,omitempty"`
+
+	parts []int
+}
+
+// ParseOSVersion splits the OS id using the first matching rule
+func (rules OSVersionRules) ParseOSVersion(id string) OSVersion {
+	for _, rule := range rules {
+		if rule.re == nil {
+			continue
+		}
+		match := rule.re.FindStringSubmatch(id)
+		if match == nil {
+			continue
+		}
+		ver := OSVersion{ID: id, Family: rule.Family}
+		for i, name := range rule.re.SubexpNames() {
+			switch name {
+			case "family":
+				if ver.Family == "" {
+					ver.Family = match[i]
+				}
+			case "version":
+				ver.Version = match[i]
+			}
+		}
+		if ver.Version != "" {
+			ver.parts = parseVersion(ver.Version)
+		}
+		return ver
+	}
+	return OSVersion{ID: id, Family: id}
+}
+
+// VersionedLedger is implemented by the ledgers whose values have a family and a version,
+// which can be filtered with the version selectors and grouped by family
+type VersionedLedger interface {
+	Ledger
+	OSVersion(id string) OSVersion
+	FamilyName(family string, langs ...string) string
+}
+
+// SummaryGroup summarizes the values of a family, with the newest first
+type SummaryGroup struct {
+	Summary
+	Latest  string    `json:"latest,omitempty"`
+	Members []Summary `json:"members"`
+}
+
+// versionSelector selects the values of a family by version.
+// They are written like "rhel7@latest", "fedora>=27", "fedora<28".
+type versionSelector struct {
+	prefix  string
+	latest  bool
+	op      string
+	version []int
+}
+
+var versionSelectorOps = []string{">=", "<=", ">", "<"}
+
+var versionNumberRE = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+func parseVersionSelector(value string) (versionSelector, bool) {
+	if idx := strings.LastIndex(value, "@"); idx > 0 {
+		if value[idx+1:] != latestSelector {
+			return versionSelector{}, false
+		}
+		return versionSelector{prefix: value[:idx], latest: true}, true
+	}
+	for _, op := range versionSelectorOps {
+		idx := strings.Index(value, op)
+		if idx <= 0 {
+			continue
+		}
+		version := value[idx+len(op):]
+		if !versionNumberRE.MatchString(version) {
+			return versionSelector{}, false
+		}
+		return versionSelector{prefix: value[:idx], op: op, version: parseVersion(version)}, true
+	}
+	return versionSelector{}, false
+}
+
+// covers tells if the version belongs to the prefix of the selector: either its family
+// (like "rhel") or a family with the beginning of a version (like "rhel7")
+func (sel versionSelector) covers(ld VersionedLedger, ver OSVersion) bool {
+	if ver.Family == sel.prefix {
+		return true
+	}
+	prefix := ld.OSVersion(sel.prefix)
+	if prefix.Family != ver.Family || len(prefix.parts) == 0 || len(prefix.parts) > len(ver.parts) {
+		return false
+	}
+	return commonPrefix(prefix.parts, ver.parts) == len(prefix.parts)
+}
+
+func (sel versionSelector) accepts(ver OSVersion) bool {
+	if len(ver.parts) == 0 {
+		return false
+	}
+	cmp := compareVersions(ver.parts, sel.version)
+	switch sel.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	}
+	return false
+}
+
+// resolve returns the values, among the given ones, selected by the selector
+func (sel versionSelector) resolve(ld VersionedLedger, values []string) *StringSet {
+	selected := NewStringSet()
+	var latest *OSVersion
+	for _, value := range values {
+		ver := ld.OSVersion(value)
+		if !sel.covers(ld, ver) {
+			continue
+		}
+		if sel.latest {
+			if latest == nil || newerVersion(ver, *latest) {
+				latest = &ver
+			}
+			continue
+		}
+		if sel.accepts(ver) {
+			selected.Add(value)
+		}
+	}
+	if latest != nil {
+		selected.Add(latest.ID)
+	}
+	return selected
+}
+
+// newerVersion tells if a is newer than b. Ties are broken by id, to be deterministic.
+func newerVersion(a, b OSVersion) bool {
+	if cmp := compareVersions(a.parts, b.parts); cmp != 0 {
+		return cmp > 0
+	}
+	return a.ID > b.ID
+}
+
+// groupSummaries groups by family the summaries of the values of the given templates.
+// The count of a group is the number of templates having any value of the family.
+func groupSummaries(ld VersionedLedger, templates []templatev1.Template, langs []string) []SummaryGroup {
+	groups := []SummaryGroup{}
+	byFamily := make(map[string]int)
+	versions := make(map[string]OSVersion)
+	for _, summary := range countSummaries(ld, templates, langs) {
+		ver := ld.OSVersion(summary.ID)
+		versions[summary.ID] = ver
+		idx, ok := byFamily[ver.Family]
+		if !ok {
+			idx = len(groups)
+			byFamily[ver.Family] = idx
+			groups = append(groups, SummaryGroup{
+				Summary: Summary{
+					ID:   ver.Family,
+					Name: ld.FamilyName(ver.Family, langs...),
+				},
+			})
+		}
+		groups[idx].Members = append(groups[idx].Members, summary)
+	}
+
+	for _, template := range templates {
+		families := NewStringSet()
+		for _, value := range ld.Values(&template) {
+			families.Add(ld.OSVersion(value).Family)
+		}
+		for _, family := range families.Keys() {
+			groups[byFamily[family]].Count += 1
+		}
+	}
+
+	for i := range groups {
+		members := groups[i].Members
+		sort.Slice(members, func(a, b int) bool {
+			return newerVersion(versions[members[a].ID], versions[members[b].ID])
+		})
+		groups[i].Latest = members[0].ID
+	}
+	sort.Slice(groups, func(a, b int) bool {
+		return groups[a].ID < groups[b].ID
+	})
+	return groups
+}
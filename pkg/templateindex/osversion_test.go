@@ -0,0 +1,153 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"testing"
+)
+
+func TestParseOSVersion(t *testing.T) {
+	rules := DefaultOSVersionRules()
+	for id, expected := range map[string]OSVersion{
+		"rhel7.5":      OSVersion{ID: "rhel7.5", Family: "rhel", Version: "7.5"},
+		"fedora28":     OSVersion{ID: "fedora28", Family: "fedora", Version: "28"},
+		"opensuse15.0": OSVersion{ID: "opensuse15.0", Family: "opensuse", Version: "15.0"},
+		"win2k12r2":    OSVersion{ID: "win2k12r2", Family: "win2k12r2"},
+	} {
+		ver := rules.ParseOSVersion(id)
+		if ver.ID != expected.ID || ver.Family != expected.Family || ver.Version != expected.Version {
+			t.Errorf("expected=%#v received=%#v", expected, ver)
+		}
+	}
+}
+
+func TestOSVersionRulesCompile(t *testing.T) {
+	rules := OSVersionRules{OSVersionRule{Pattern: "^win(?P<version>[0-9]+)$", Family: "windows"}}
+	if err := rules.Compile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ver := rules.ParseOSVersion("win10"); ver.Family != "windows" || ver.Version != "10" {
+		t.Errorf("unexpected version: %#v", ver)
+	}
+
+	for _, pattern := range []string{"^(?P<family>[a-z]+$", "^(?P<family>[a-z]+)$", "^(?P<version>[0-9]+)$"} {
+		rules := OSVersionRules{OSVersionRule{Pattern: pattern}}
+		if err := rules.Compile(); err == nil {
+			t.Errorf("unexpectedly valid: %v", pattern)
+		}
+	}
+}
+
+func TestParseVersionSelector(t *testing.T) {
+	for _, value := range []string{"rhel7@latest", "fedora>=27", "fedora<28", "rhel7>7.2"} {
+		if _, ok := parseVersionSelector(value); !ok {
+			t.Errorf("not a selector: %v", value)
+		}
+	}
+	for _, value := range []string{"rhel7.5", "rhel7@oldest", "fedora>=", ">=27", "fedora>=x"} {
+		if _, ok := parseVersionSelector(value); ok {
+			t.Errorf("unexpected selector: %v", value)
+		}
+	}
+}
+
+func checkDescriptionOSes(t *testing.T, descs []Description, expected map[string]string) {
+	if len(descs) != len(expected) {
+		t.Fatalf("expected %v templates, received %v", len(expected), len(descs))
+	}
+	for _, desc := range descs {
+		if os, ok := expected[desc.ID]; !ok || desc.OS != os {
+			t.Errorf("unexpected template: %v (os %v)", desc.ID, desc.OS)
+		}
+	}
+}
+
+func TestDescribeByLatest(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+	descs, err := ti.DescribeBy(FilterOptions{"os": "rhel7@latest", "size": "large"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkDescriptionOSes(t, descs, map[string]string{
+		"rhel7-generic-large":         "rhel7.5",
+		"rhel7-highperformance-large": "rhel7.5",
+	})
+
+	descs, err = ti.DescribeBy(FilterOptions{"os": "fedora@latest", "workload": "generic"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkDescriptionOSes(t, descs, map[string]string{
+		"fedora-generic-large":  "fedora28",
+		"fedora-generic-medium": "fedora28",
+		"fedora-generic-small":  "fedora28",
+		"fedora-generic-tiny":   "fedora28",
+	})
+}
+
+func TestDescribeByVersionRange(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+	descs, err := ti.DescribeBy(FilterOptions{"os": "rhel>=7.4", "size": "tiny"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkDescriptionOSes(t, descs, map[string]string{
+		"rhel7-generic-tiny":         "rhel7.5",
+		"rhel7-highperformance-tiny": "rhel7.5",
+	})
+
+	descs, err = ti.DescribeBy(FilterOptions{"os": "fedora<26"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkDescriptionOSes(t, descs, map[string]string{})
+}
+
+func TestGroupBy(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+	groups, err := ti.GroupBy("os", FilterOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []SummaryGroup{
+		SummaryGroup{Summary: Summary{ID: "centos", Count: 4}, Latest: "centos7.0"},
+		SummaryGroup{Summary: Summary{ID: "fedora", Count: 8}, Latest: "fedora28"},
+		SummaryGroup{Summary: Summary{ID: "opensuse", Count: 4}, Latest: "opensuse15.0"},
+		SummaryGroup{Summary: Summary{ID: "rhel", Count: 8}, Latest: "rhel7.5"},
+	}
+	for _, exp := range expected {
+		found := false
+		for _, group := range groups {
+			if group.ID != exp.ID {
+				continue
+			}
+			found = true
+			if group.Count != exp.Count || group.Latest != exp.Latest || group.Members[0].ID != exp.Latest {
+				t.Errorf("expected=%v received=%v", exp, group)
+			}
+		}
+		if !found {
+			t.Errorf("missing group: %v", exp.ID)
+		}
+	}
+
+	if _, err := ti.GroupBy("size", FilterOptions{}); err == nil {
+		t.Errorf("unexpectedly grouped a ledger without versions")
+	}
+}
@@ -0,0 +1,333 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// Requirements are the resources the VM needs. Zero means "don't care".
+type Requirements struct {
+	Cores int64
+	// bytes
+	Memory int64
+}
+
+// RequirementsFromURL extracts the requirements from the "cores" and "memory" query parameters.
+// memory is a Kubernetes quantity, like "5Gi" or "2048M".
+func RequirementsFromURL(u *url.URL) (Requirements, error) {
+	query := u.Query()
+	req := Requirements{}
+	if value := query.Get("cores"); value != "" {
+		cores, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || cores < 0 {
+			return req, fmt.Errorf("invalid cores: %q", value)
+		}
+		req.Cores = cores
+	}
+	if value := query.Get("memory"); value != "" {
+		mem, err := resource.ParseQuantity(value)
+		if err != nil {
+			return req, fmt.Errorf("invalid memory: %q: %v", value, err)
+		}
+		req.Memory = mem.Value()
+	}
+	return req, nil
+}
+
+// Recommendation is a template suggested for some Requirements
+type Recommendation struct {
+	Description
+	Score float64 `json:"score"`
+	// human readable explanations of the choice
+	Reasons []string `json:"reasons"`
+	// false if the template does not provide all the requested resources
+	Satisfied bool `json:"satisfied"`
+}
+
+type candidate struct {
+	template  *templatev1.Template
+	resources vmResources
+	score     float64
+	reasons   []string
+	satisfied bool
+}
+
+// Recommend scores the templates matching opts by how closely they provide the requirements,
+// returning at most limit of them (all if limit is not positive), the best first.
+// The templates providing all the requirements with the least waste come first.
+// If no template matches the requested OS, the nearest version of the same OS is used.
+func (ti *TemplateIndexer) Recommend(opts FilterOptions, req Requirements, limit int, langs ...string) ([]Recommendation, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	reasons := []string{}
+	f := ti.newFilter(opts)
+	templates := ti.selectFiltered(f)
+	if wanted, ok := opts["os"]; ok && len(templates) == 0 {
+		available := NewStringSet()
+		for _, template := range ti.selectTemplates(opts.Without("os")) {
+			for _, os := range ti.osValues(&template) {
+				available.Add(os)
+			}
+		}
+		if nearest, ok := nearestOSVersion(wanted, available.Keys(), ti.osVersions()); ok {
+			opts = opts.Without("os")
+			opts["os"] = nearest
+			f = ti.newFilter(opts)
+			templates = ti.selectFiltered(f)
+			reasons = append(reasons, fmt.Sprintf("no template for %s, using the nearest version %s", wanted, nearest))
+		}
+	}
+
+	candidates := []*candidate{}
+	for i := range templates {
+		vms := virtualMachines(&templates[i])
+		if len(vms) == 0 {
+			continue
+		}
+		candidates = append(candidates, scoreCandidate(&templates[i], vms[0].resources(), req))
+	}
+	explainSmallest(candidates, req)
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].satisfied != candidates[j].satisfied {
+			return candidates[i].satisfied
+		}
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].template.Name < candidates[j].template.Name
+	})
+
+	recommendations := []Recommendation{}
+	for _, cand := range candidates {
+		if limit > 0 && len(recommendations) >= limit {
+			break
+		}
+		recommendations = append(recommendations, Recommendation{
+			Description: ti.describe(cand.template, f, langs),
+			Score:       cand.score,
+			Reasons:     append(append([]string{}, reasons...), cand.reasons...),
+			Satisfied:   cand.satisfied,
+		})
+	}
+	return recommendations, nil
+}
+
+func (ti *TemplateIndexer) osValues(t *templatev1.Template) []string {
+	if ld, ok := ti.ledgers["os"]; ok {
+		return ld.Values(t)
+	}
+	return extractFlavours(t, "os")
+}
+
+// scoreCandidate gives 100 points to a template providing exactly the requirements.
+// Missing resources cost much more than wasted ones.
+func scoreCandidate(t *templatev1.Template, res vmResources, req Requirements) *candidate {
+	cand := &candidate{
+		template:  t,
+		resources: res,
+		score:     100.0,
+		satisfied: true,
+	}
+	check := func(what string, have, want int64, format func(int64) string) {
+		if want <= 0 {
+			return
+		}
+		ratio := float64(have-want) / float64(want)
+		if have < want {
+			cand.satisfied = false
+			cand.score += ratio * 100
+			cand.reasons = append(cand.reasons, fmt.Sprintf("provides only %s of %s, %s requested", format(have), what, format(want)))
+		} else {
+			cand.score -= ratio * 10
+		}
+	}
+	check("cores", res.Cores, req.Cores, formatCount)
+	check("memory", res.Memory, req.Memory, formatBytes)
+	return cand
+}
+
+// explainSmallest tells which candidates are the smallest ones providing each requirement
+func explainSmallest(candidates []*candidate, req Requirements) {
+	explain := func(what string, want int64, have func(*candidate) int64) {
+		if want <= 0 {
+			return
+		}
+		var smallest int64 = -1
+		for _, cand := range candidates {
+			if value := have(cand); value >= want && (smallest < 0 || value < smallest) {
+				smallest = value
+			}
+		}
+		for _, cand := range candidates {
+			if have(cand) == smallest {
+				cand.reasons = append(cand.reasons, fmt.Sprintf("smallest flavor satisfying %s", what))
+			}
+		}
+	}
+	explain("cores", req.Cores, func(c *candidate) int64 { return c.resources.Cores })
+	explain("memory", req.Memory, func(c *candidate) int64 { return c.resources.Memory })
+}
+
+func formatCount(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
+
+func formatBytes(value int64) string {
+	units := []string{"", "Ki", "Mi", "Gi", "Ti"}
+	unit := 0
+	for value >= 1024 && value%1024 == 0 && unit < len(units)-1 {
+		value /= 1024
+		unit += 1
+	}
+	return fmt.Sprintf("%d%s", value, units[unit])
+}
+
+// osVersions returns how the "os" ledger splits the OS ids in family and version.
+// The ledgers which are not a VersionedLedger use the default rules.
+func (ti *TemplateIndexer) osVersions() func(id string) OSVersion {
+	if ld, ok := ti.ledgers["os"].(VersionedLedger); ok {
+		return ld.OSVersion
+	}
+	return DefaultOSVersionRules().ParseOSVersion
+}
+
+// nearestOSVersion finds, among the available OS ids, the closest version of the same family of wanted,
+// splitting them with split: the one just before or just after it, preferring the one sharing more
+// of the version (e.g. the same major), then the smallest difference, then the newer.
+func nearestOSVersion(wanted string, available []string, split func(id string) OSVersion) (string, bool) {
+	target := split(wanted)
+	if target.Version == "" {
+		return "", false
+	}
+	version := target.parts
+
+	type candidateVersion struct {
+		id      string
+		version []int
+	}
+	var before, after *candidateVersion
+	for _, os := range available {
+		ver := split(os)
+		if ver.Version == "" || ver.Family != target.Family {
+			continue
+		}
+		cur := &candidateVersion{id: os, version: ver.parts}
+		cmp := compareVersions(cur.version, version)
+		if cmp == 0 {
+			return os, true
+		}
+		if cmp < 0 && (before == nil || compareVersions(cur.version, before.version) > 0) {
+			before = cur
+		}
+		if cmp > 0 && (after == nil || compareVersions(cur.version, after.version) < 0) {
+			after = cur
+		}
+	}
+
+	if before == nil && after == nil {
+		return "", false
+	}
+	if before == nil {
+		return after.id, true
+	}
+	if after == nil {
+		return before.id, true
+	}
+	if pb, pa := commonPrefix(before.version, version), commonPrefix(after.version, version); pb != pa {
+		if pb > pa {
+			return before.id, true
+		}
+		return after.id, true
+	}
+	if versionDistance(before.version, version) < versionDistance(after.version, version) {
+		return before.id, true
+	}
+	return after.id, true
+}
+
+// commonPrefix returns how many leading components a and b have in common
+func commonPrefix(a, b []int) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func parseVersion(s string) []int {
+	version := []int{}
+	for _, item := range strings.Split(s, ".") {
+		n, _ := strconv.Atoi(item)
+		version = append(version, n)
+	}
+	return version
+}
+
+// compareVersions returns -1, 0, 1 if a is older, equal to, newer than b
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionDistance weights the difference of each component less than the one before
+func versionDistance(a, b []int) float64 {
+	var distance float64
+	weight := 1.0
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		diff := float64(x - y)
+		if diff < 0 {
+			diff = -diff
+		}
+		distance += diff * weight
+		weight /= 100
+	}
+	return distance
+}
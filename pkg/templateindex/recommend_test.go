@@ -0,0 +1,169 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"net/url"
+	"testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+)
+
+func TestRecommendSmallestSatisfyingMemory(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+	opts := FilterOptions{"os": "rhel7.5", "workload": "generic"}
+	recs, err := ti.Recommend(opts, Requirements{Memory: 5 * 1024 * 1024 * 1024}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recs) != 4 {
+		t.Fatalf("unexpected recommendations: %v", recs)
+	}
+	if recs[0].ID != "rhel7-generic-large" || !recs[0].Satisfied {
+		t.Errorf("unexpected best recommendation: %v", recs[0])
+	}
+	if !containsString(recs[0].Reasons, "smallest flavor satisfying memory") {
+		t.Errorf("missing reason: %v", recs[0].Reasons)
+	}
+	for _, rec := range recs[1:] {
+		if rec.Satisfied || rec.Score >= recs[0].Score {
+			t.Errorf("unexpected recommendation: %v", rec)
+		}
+	}
+}
+
+func TestRecommendPrefersLessWaste(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+	opts := FilterOptions{"os": "centos7.0", "workload": "generic"}
+	recs, err := ti.Recommend(opts, Requirements{Cores: 1, Memory: 1500 * 1024 * 1024}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("unexpected recommendations: %v", recs)
+	}
+	if recs[0].ID != "centos7-generic-small" || recs[1].ID != "centos7-generic-medium" {
+		t.Errorf("unexpected recommendations: %v %v", recs[0].ID, recs[1].ID)
+	}
+}
+
+func TestRecommendUnsatisfiable(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+	opts := FilterOptions{"os": "opensuse15.0"}
+	recs, err := ti.Recommend(opts, Requirements{Cores: 3}, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recs) != 1 || recs[0].Satisfied || recs[0].ID != "opensuse-generic-large" {
+		t.Fatalf("unexpected recommendations: %v", recs)
+	}
+	if !containsString(recs[0].Reasons, "provides only 2 of cores, 3 requested") {
+		t.Errorf("missing reason: %v", recs[0].Reasons)
+	}
+}
+
+func TestRecommendNearestOSVersion(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+	opts := FilterOptions{"os": "fedora29", "workload": "generic"}
+	recs, err := ti.Recommend(opts, Requirements{}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recs) != 4 {
+		t.Fatalf("unexpected recommendations: %v", recs)
+	}
+	expected := "no template for fedora29, using the nearest version fedora28"
+	for _, rec := range recs {
+		if !containsString(rec.Reasons, expected) {
+			t.Errorf("missing reason: %v", rec.Reasons)
+		}
+	}
+}
+
+func TestNearestOSVersion(t *testing.T) {
+	available := []string{"rhel6.9", "rhel7.0", "rhel7.4", "rhel7.6", "fedora28"}
+	for wanted, expected := range map[string]string{
+		"rhel7.5": "rhel7.6",
+		"rhel7.1": "rhel7.0",
+		"rhel8.0": "rhel7.6",
+		"rhel6":   "rhel6.9",
+		"rhel7":   "rhel7.0",
+	} {
+		nearest, ok := nearestOSVersion(wanted, available, DefaultOSVersionRules().ParseOSVersion)
+		if !ok || nearest != expected {
+			t.Errorf("wanted=%v expected=%v received=%v", wanted, expected, nearest)
+		}
+	}
+	if _, ok := nearestOSVersion("win10", available, DefaultOSVersionRules().ParseOSVersion); ok {
+		t.Errorf("unexpected match for a different OS")
+	}
+}
+
+func TestRecommendNearestOSVersionCustomRules(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	for i := range templates {
+		templates[i].Labels["os.template.cnv.io/win2k12r2"] = "true"
+	}
+
+	// "win2k12r2" is split in the family "win2k" and the version "12", which the default rules do not match
+	rules := OSVersionRules{
+		OSVersionRule{Pattern: `^(?P<family>win2k)(?P<version>[0-9]+)r(?P<release>[0-9]+)$`},
+	}
+	if err := rules.Compile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ld := NewOSLedger(NewJSONLedger("os"))
+	ld.SetVersionRules(rules)
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", ld)
+	if _, err := ti.AddTemplates(templates); err != nil {
+		t.Fatalf("cannot add test templates! %v", err)
+	}
+
+	recs, err := ti.Recommend(FilterOptions{"os": "win2k16r1"}, Requirements{}, 1)
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("unexpected recommendations: %v %v", recs, err)
+	}
+	if !containsString(recs[0].Reasons, "no template for win2k16r1, using the nearest version win2k12r2") {
+		t.Errorf("missing reason: %v", recs[0].Reasons)
+	}
+}
+
+func TestRequirementsFromURL(t *testing.T) {
+	u, _ := url.Parse("/recommend?os=rhel7.5&cores=3&memory=5Gi")
+	req, err := RequirementsFromURL(u)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Cores != 3 || req.Memory != 5*1024*1024*1024 {
+		t.Errorf("unexpected requirements: %v", req)
+	}
+
+	for _, query := range []string{"cores=three", "cores=-1", "memory=lots"} {
+		u, _ := url.Parse("/recommend?" + query)
+		if _, err := RequirementsFromURL(u); err == nil {
+			t.Errorf("unexpectedly accepted %v", query)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// how much a match on a term which is not exactly the one searched for is worth
+const (
+	prefixMatchWeight = 0.8
+	fuzzyMatchWeight  = 0.6
+)
+
+// snippets are cut to about this many characters around the first match
+const snippetLength = 160
+
+const (
+	SearchFieldName        = "name"
+	SearchFieldDisplayName = "display-name"
+	SearchFieldDescription = "description"
+	SearchFieldTags        = "tags"
+	SearchFieldOS          = "os"
+)
+
+// matches in some fields are more meaningful than others
+var searchFieldBoosts = map[string]float64{
+	SearchFieldName:        3.0,
+	SearchFieldDisplayName: 3.0,
+	SearchFieldDescription: 1.0,
+	SearchFieldTags:        2.0,
+	SearchFieldOS:          2.0,
+}
+
+type searchField struct {
+	Name string
+	Text string
+}
+
+type searchDoc struct {
+	length float64
+	// term -> boosted frequency
+	terms  map[string]float64
+	fields []searchField
+}
+
+type searchHit struct {
+	Key        string
+	Score      float64
+	Highlights map[string]string
+}
+
+// searchIndex is an inverted index over the text of the templates, updated incrementally.
+// It is not safe for concurrent use; the TemplateIndexer lock protects it.
+type searchIndex struct {
+	// term -> document key -> boosted frequency
+	postings    map[string]map[string]float64
+	docs        map[string]*searchDoc
+	totalLength float64
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string]float64),
+		docs:     make(map[string]*searchDoc),
+	}
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.'
+	})
+}
+
+func normalizeTokens(tokens []string) []string {
+	terms := []string{}
+	for _, token := range tokens {
+		token = strings.Trim(token, ".")
+		if token != "" {
+			terms = append(terms, token)
+		}
+	}
+	return terms
+}
+
+// templateSearchFields extracts the searchable text of the template
+func templateSearchFields(t *templatev1.Template) []searchField {
+	oses := extractFlavours(t, "os")
+	for key, value := range t.Annotations {
+		if strings.HasPrefix(key, osNameAnnotationPrefix) {
+			oses = append(oses, value)
+		}
+	}
+	sort.Strings(oses)
+
+	return []searchField{
+		searchField{Name: SearchFieldName, Text: t.Name},
+		searchField{Name: SearchFieldDisplayName, Text: t.Annotations["openshift.io/display-name"]},
+		searchField{Name: SearchFieldDescription, Text: t.Annotations["description"]},
+		searchField{Name: SearchFieldTags, Text: t.Annotations["tags"]},
+		searchField{Name: SearchFieldOS, Text: strings.Join(oses, " ")},
+	}
+}
+
+func (si *searchIndex) add(key string, fields []searchField) {
+	si.remove(key)
+
+	doc := &searchDoc{
+		terms:  make(map[string]float64),
+		fields: fields,
+	}
+	for _, field := range fields {
+		boost := searchFieldBoosts[field.Name]
+		for _, term := range normalizeTokens(tokenize(field.Text)) {
+			doc.terms[term] += boost
+			doc.length += 1
+		}
+	}
+
+	for term, freq := range doc.terms {
+		if _, ok := si.postings[term]; !ok {
+			si.postings[term] = make(map[string]float64)
+		}
+		si.postings[term][key] = freq
+	}
+	si.docs[key] = doc
+	si.totalLength += doc.length
+}
+
+func (si *searchIndex) remove(key string) {
+	doc, ok := si.docs[key]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(si.postings[term], key)
+		if len(si.postings[term]) == 0 {
+			delete(si.postings, term)
+		}
+	}
+	si.totalLength -= doc.length
+	delete(si.docs, key)
+}
+
+// expand returns the indexed terms matching the query term, with the weight of the match
+func (si *searchIndex) expand(qterm string) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := si.postings[qterm]; ok {
+		matches[qterm] = 1.0
+	}
+
+	maxDistance := 0
+	if len(qterm) >= 8 {
+		maxDistance = 2
+	} else if len(qterm) >= 4 {
+		maxDistance = 1
+	}
+
+	for term := range si.postings {
+		if term == qterm {
+			continue
+		}
+		if len(qterm) >= 3 && strings.HasPrefix(term, qterm) {
+			matches[term] = prefixMatchWeight
+		} else if maxDistance > 0 && editDistance(qterm, term, maxDistance) <= maxDistance {
+			matches[term] = fuzzyMatchWeight
+		}
+	}
+	return matches
+}
+
+// search returns the documents matching any of the terms of the query, ranked using BM25
+func (si *searchIndex) search(query string) []searchHit {
+	if len(si.docs) == 0 {
+		return []searchHit{}
+	}
+
+	count := float64(len(si.docs))
+	avgLength := si.totalLength / count
+	scores := make(map[string]float64)
+	matched := make(map[string]*StringSet)
+
+	for _, qterm := range normalizeTokens(tokenize(query)) {
+		// for each document, only the best match of each query term counts
+		best := make(map[string]float64)
+		for term, weight := range si.expand(qterm) {
+			postings := si.postings[term]
+			df := float64(len(postings))
+			idf := math.Log(1 + (count-df+0.5)/(df+0.5))
+			for key, freq := range postings {
+				norm := 1 - bm25B + bm25B*si.docs[key].length/avgLength
+				score := weight * idf * freq * (bm25K1 + 1) / (freq + bm25K1*norm)
+				if score > best[key] {
+					best[key] = score
+				}
+				if _, ok := matched[key]; !ok {
+					matched[key] = NewStringSet()
+				}
+				matched[key].Add(term)
+			}
+		}
+		for key, score := range best {
+			scores[key] += score
+		}
+	}
+
+	hits := make([]searchHit, 0, len(scores))
+	for key, score := range scores {
+		hits = append(hits, searchHit{
+			Key:        key,
+			Score:      score,
+			Highlights: highlight(si.docs[key].fields, matched[key]),
+		})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Key < hits[j].Key
+	})
+	return hits
+}
+
+// highlight returns, for the fields containing any of the terms, a snippet with the terms emphasized
+func highlight(fields []searchField, terms *StringSet) map[string]string {
+	highlights := make(map[string]string)
+	for _, field := range fields {
+		if snippet, ok := makeSnippet(field.Text, terms); ok {
+			highlights[field.Name] = snippet
+		}
+	}
+	return highlights
+}
+
+func makeSnippet(text string, terms *StringSet) (string, bool) {
+	runes := []rune(text)
+	var sb strings.Builder
+	found := false
+	first := -1
+
+	// we need the positions in the original text, so we scan it instead of using tokenize()
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := string(runes[start:end])
+		trimmed := strings.Trim(word, ".")
+		if terms.Contains(strings.ToLower(trimmed)) {
+			if first < 0 {
+				first = sb.Len()
+			}
+			found = true
+			escaped := html.EscapeString(trimmed)
+			sb.WriteString(strings.Replace(html.EscapeString(word), escaped, "<em>"+escaped+"</em>", 1))
+		} else {
+			sb.WriteString(html.EscapeString(word))
+		}
+		start = -1
+	}
+	for i, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+		// the snippets are HTML: the text must not add markup to the highlights
+		sb.WriteString(html.EscapeString(string(r)))
+	}
+	flush(len(runes))
+
+	if !found {
+		return "", false
+	}
+	return cutSnippet(sb.String(), first), true
+}
+
+// cutSnippet trims the text to about snippetLength bytes around pos, on word boundaries if any,
+// never splitting a character nor an HTML entity
+func cutSnippet(text string, pos int) string {
+	if len(text) <= snippetLength {
+		return text
+	}
+	begin := pos - snippetLength/4
+	prefix := "..."
+	if begin <= 0 {
+		begin = 0
+		prefix = ""
+	} else if idx := strings.IndexByte(text[begin:pos], ' '); idx >= 0 {
+		begin += idx + 1
+	} else {
+		begin = snippetBoundary(text, begin, false)
+	}
+	end := begin + snippetLength
+	suffix := "..."
+	if end >= len(text) {
+		end = len(text)
+		suffix = ""
+	} else if idx := strings.LastIndexByte(text[begin:end], ' '); idx > 0 {
+		end = begin + idx
+	} else {
+		end = snippetBoundary(text, end, true)
+	}
+	// never cut an highlight in half
+	if open := strings.LastIndex(text[begin:end], "<em>"); open >= 0 && !strings.Contains(text[begin+open:end], "</em>") {
+		if closing := strings.Index(text[end:], "</em>"); closing >= 0 {
+			end += closing + len("</em>")
+		}
+	}
+	return prefix + text[begin:end] + suffix
+}
+
+// snippetBoundary moves the offset to the start of a character outside of the HTML entities:
+// backwards, to leave them out of the end of the snippet, or forwards past them, for its beginning
+func snippetBoundary(text string, offset int, backwards bool) int {
+	for offset > 0 && offset < len(text) && !utf8.RuneStart(text[offset]) {
+		offset--
+	}
+	amp := strings.LastIndexByte(text[:offset], '&')
+	if amp < 0 || strings.IndexByte(text[amp:offset], ';') >= 0 {
+		return offset
+	}
+	if backwards {
+		return amp
+	}
+	if semicolon := strings.IndexByte(text[offset:], ';'); semicolon >= 0 {
+		return offset + semicolon + 1
+	}
+	return offset
+}
+
+// editDistance computes the distance between a and b, counting insertions, deletions, substitutions
+// and transpositions of adjacent characters (optimal string alignment distance).
+// Gives up, returning max+1, as soon as the distance is known to be greater than max.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = minInt(cur[j], prev2[j-2]+1)
+			}
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
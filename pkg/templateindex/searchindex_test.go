@@ -0,0 +1,191 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSearchSimple(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+
+	results, err := ti.Search("centos", FilterOptions{}, 0)
+	if err != nil || len(results) != 4 {
+		t.Fatalf("unexpected results: %v err=%v", len(results), err)
+	}
+	for _, res := range results {
+		if !strings.HasPrefix(res.ID, "centos7-") {
+			t.Errorf("unexpected result: %v", res.ID)
+		}
+		if res.Score <= 0 {
+			t.Errorf("unexpected score: %v", res.Score)
+		}
+		if !strings.Contains(res.Highlights[SearchFieldDisplayName], "<em>CentOS</em>") {
+			t.Errorf("unexpected highlights: %v", res.Highlights)
+		}
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+
+	results, err := ti.Search("high performance windows", FilterOptions{}, 0)
+	if err != nil || len(results) < 1 {
+		t.Fatalf("unexpected results: %v err=%v", len(results), err)
+	}
+	// nothing is both windows and highperformance: windows or highperformance must come first
+	first := results[0].ID
+	if !strings.HasPrefix(first, "win") && !strings.Contains(first, "highperformance") {
+		t.Errorf("unexpected best result: %v", first)
+	}
+}
+
+func TestSearchTypoTolerance(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+
+	results, err := ti.Search("fedroa", FilterOptions{}, 0)
+	if err != nil || len(results) < 1 {
+		t.Fatalf("unexpected results: %v err=%v", len(results), err)
+	}
+	for _, res := range results {
+		if !strings.HasPrefix(res.ID, "fedora-") {
+			t.Errorf("unexpected result: %v", res.ID)
+		}
+	}
+}
+
+func TestSearchWithFilterAndLimit(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+
+	results, err := ti.Search("fedora", FilterOptions{"size": "tiny"}, 0)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("unexpected results: %v err=%v", len(results), err)
+	}
+	for _, res := range results {
+		if res.Size != "tiny" {
+			t.Errorf("unexpected result: %v", res.ID)
+		}
+	}
+
+	results, err = ti.Search("fedora", FilterOptions{}, 3)
+	if err != nil || len(results) != 3 {
+		t.Fatalf("unexpected results: %v err=%v", len(results), err)
+	}
+}
+
+func TestSearchAfterRemove(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+
+	results, err := ti.Search("opensuse", FilterOptions{}, 0)
+	if err != nil || len(results) != 4 {
+		t.Fatalf("unexpected results: %v err=%v", len(results), err)
+	}
+
+	for _, res := range results {
+		template := ti.templates[templateKey("", res.ID)]
+		ti.Update(&template) // triggers removal
+	}
+
+	results, err = ti.Search("opensuse", FilterOptions{}, 0)
+	if err != nil || len(results) != 0 {
+		t.Errorf("unexpected results: %v err=%v", len(results), err)
+	}
+	if _, ok := ti.search.postings["opensuse"]; ok {
+		t.Errorf("stale postings in the index")
+	}
+}
+
+func TestSearchNoMatch(t *testing.T) {
+	ti := newTestIndexer(t, nil)
+
+	results, err := ti.Search("xyzzy", FilterOptions{}, 0)
+	if err != nil || len(results) != 0 {
+		t.Errorf("unexpected results: %v err=%v", len(results), err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		max      int
+		expected int
+	}{
+		{"fedora", "fedora", 2, 0},
+		{"fedroa", "fedora", 2, 1},
+		{"fedora", "fdeora", 1, 1},
+		{"centos", "centoss", 1, 1},
+		{"ubuntu", "fedora", 2, 3},
+		{"a", "abcd", 1, 2},
+	}
+	for _, c := range cases {
+		if d := editDistance(c.a, c.b, c.max); d != c.expected {
+			t.Errorf("editDistance(%v, %v, %v)=%v expected %v", c.a, c.b, c.max, d, c.expected)
+		}
+	}
+}
+
+func TestMakeSnippetNoSpaces(t *testing.T) {
+	terms := NewStringSet()
+	terms.Add("fedora")
+
+	// localized text, with no spaces to cut at
+	long := strings.Repeat("für", 60) + "、Fedora、" + strings.Repeat("日本語", 60)
+	snippet, ok := makeSnippet(long, terms)
+	if !ok || !strings.Contains(snippet, "<em>Fedora</em>") || !utf8.ValidString(snippet) {
+		t.Errorf("unexpected snippet: %q", snippet)
+	}
+
+	long = strings.Repeat("<>", 60) + "Fedora" + strings.Repeat("&", 100)
+	snippet, ok = makeSnippet(long, terms)
+	if !ok || !strings.Contains(snippet, "<em>Fedora</em>") {
+		t.Errorf("unexpected snippet: %q", snippet)
+	}
+	text := strings.NewReplacer("<em>", "", "</em>", "", "&lt;", "", "&gt;", "", "&amp;", "").Replace(strings.Trim(snippet, "."))
+	if text != "Fedora" {
+		t.Errorf("entities cut in the snippet: %q", snippet)
+	}
+}
+
+func TestMakeSnippet(t *testing.T) {
+	terms := NewStringSet()
+	terms.Add("fedora")
+
+	snippet, ok := makeSnippet("A VM suitable for Fedora 23 and newer.", terms)
+	if !ok || snippet != "A VM suitable for <em>Fedora</em> 23 and newer." {
+		t.Errorf("unexpected snippet: %q", snippet)
+	}
+
+	long := strings.Repeat("lorem ipsum ", 30) + "Fedora" + strings.Repeat(" dolor sit amet", 30)
+	snippet, ok = makeSnippet(long, terms)
+	if !ok || !strings.Contains(snippet, "<em>Fedora</em>") || len(snippet) > snippetLength+20 {
+		t.Errorf("unexpected snippet: %q", snippet)
+	}
+
+	snippet, ok = makeSnippet(`<b>Fedora</b> & "friends"`, terms)
+	if !ok || snippet != "&lt;b&gt;<em>Fedora</em>&lt;/b&gt; &amp; &#34;friends&#34;" {
+		t.Errorf("unexpected snippet: %q", snippet)
+	}
+
+	_, ok = makeSnippet("nothing to see here", terms)
+	if ok {
+		t.Errorf("unexpected snippet")
+	}
+}
@@ -18,6 +18,10 @@
 
 package templateindex
 
+import (
+	"sort"
+)
+
 type StringSet struct {
 	data map[string]bool
 }
@@ -39,3 +43,13 @@ func (sts *StringSet) Remove(key string) {
 func (sts *StringSet) Contains(key string) bool {
 	return sts.data[key]
 }
+
+// Keys returns the sorted content of the set
+func (sts *StringSet) Keys() []string {
+	keys := make([]string, 0, len(sts.data))
+	for key := range sts.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -21,7 +21,9 @@ package templateindex
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 
@@ -31,18 +33,63 @@ import (
 type TemplateIndexer struct {
 	rwlock sync.RWMutex
 	log    logr.Logger
-	// holds the real data
-	// TODO: figure out if we are supposed to use UID,
-	// or if Name is good enough.
-	templates map[string]templatev1.Template
-	ledgers   map[string]Ledger
+	// holds the real data, by templateKey: the same name may be used in many namespaces
+	templates     map[string]templatev1.Template
+	ledgers       map[string]Ledger
+	search        *searchIndex
+	history       map[string]*templateHistory
+	historyLength int
+	now           func() time.Time
+	subscribers   map[*Subscription]struct{}
+	icons         *IconStore
+	iconsBaseURL  string
+	// the icons embedded in the templates, by templateKey
+	dataIcons map[string]Icon
+	// the source of the templates, by templateKey
+	sources map[string]string
+}
+
+// DefaultSource is the source of the templates added by Set: the OpenShift templates
+const DefaultSource = "templates"
+
+// ConflictError is returned adding a template with the same namespace and name of one of another source:
+// e.g. a stopped VirtualMachine and a Template. The first one indexed is kept.
+type ConflictError struct {
+	Key    string
+	Source string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("template %s already indexed from %s", e.Key, e.Source)
+}
+
+// IsConflict tells if the error is a ConflictError
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// templateKey identifies a template in the index
+func templateKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func keyOf(t *templatev1.Template) string {
+	return templateKey(t.Namespace, t.Name)
 }
 
 func NewTemplateIndexer(log logr.Logger) *TemplateIndexer {
 	return &TemplateIndexer{
-		log:       log,
-		templates: make(map[string]templatev1.Template),
-		ledgers:   make(map[string]Ledger),
+		log:           log,
+		templates:     make(map[string]templatev1.Template),
+		ledgers:       make(map[string]Ledger),
+		search:        newSearchIndex(),
+		history:       make(map[string]*templateHistory),
+		historyLength: DefaultHistoryLength,
+		now:           time.Now,
+		subscribers:   make(map[*Subscription]struct{}),
+		dataIcons:     make(map[string]Icon),
+		sources:       make(map[string]string),
 	}
 }
 
@@ -62,7 +109,36 @@ func (ti *TemplateIndexer) AddLedger(name string, ld Ledger) {
 	ti.ledgers[name] = ld
 }
 
-func (ti *TemplateIndexer) SummarizeBy(name string) ([]Summary, error) {
+// NameMaps returns the name maps currently loaded, for all the ledgers which have one
+func (ti *TemplateIndexer) NameMaps() map[string]map[string]map[string]string {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	nameMaps := make(map[string]map[string]map[string]string)
+	for name, ld := range ti.ledgers {
+		if nm, ok := ld.(NameMapper); ok {
+			nameMaps[name] = nm.NameMap()
+		}
+	}
+	return nameMaps
+}
+
+// SummarizeBy summarizes the templates matching opts using the ledger registered as name.
+// The names of the summaries are given in the first available of langs.
+func (ti *TemplateIndexer) SummarizeBy(name string, opts FilterOptions, langs ...string) ([]Summary, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	ld, ok := ti.ledgers[name]
+	if !ok {
+		return []Summary{}, errors.New(fmt.Sprintf("invalid label: %v", name))
+	}
+
+	return ld.Summarize(ti.selectTemplates(opts), langs...), nil
+}
+
+// CountBy is like SummarizeBy, but the summaries also report how many templates have each value.
+func (ti *TemplateIndexer) CountBy(name string, opts FilterOptions, langs ...string) ([]Summary, error) {
 	ti.rwlock.RLock()
 	defer ti.rwlock.RUnlock()
 
@@ -71,36 +147,286 @@ func (ti *TemplateIndexer) SummarizeBy(name string) ([]Summary, error) {
 		return []Summary{}, errors.New(fmt.Sprintf("invalid label: %v", name))
 	}
 
+	return countSummaries(ld, ti.selectTemplates(opts), langs), nil
+}
+
+// Facets summarizes, with counts, the templates matching opts using all the ledgers.
+// The filter on a ledger is not applied to the summary of that ledger itself, so that
+// each summary reports all the values which can be selected given the other filters:
+// with os=win10, the "os" summary lists all the OSes, while the "workload" summary lists
+// only the workloads available for win10.
+func (ti *TemplateIndexer) Facets(opts FilterOptions, langs ...string) (map[string][]Summary, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	facets := make(map[string][]Summary)
+	for name, ld := range ti.ledgers {
+		facets[name] = countSummaries(ld, ti.selectTemplates(opts.Without(name)), langs)
+	}
+	return facets, nil
+}
+
+// GroupBy is like CountBy, but groups the summaries by family. The ledger must be a VersionedLedger.
+func (ti *TemplateIndexer) GroupBy(name string, opts FilterOptions, langs ...string) ([]SummaryGroup, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	ld, ok := ti.ledgers[name]
+	if !ok {
+		return []SummaryGroup{}, errors.New(fmt.Sprintf("invalid label: %v", name))
+	}
+	vld, ok := ld.(VersionedLedger)
+	if !ok {
+		return []SummaryGroup{}, errors.New(fmt.Sprintf("label %v has no versions", name))
+	}
+
+	return groupSummaries(vld, ti.selectTemplates(opts), langs), nil
+}
+
+// selectTemplates returns the templates matching opts. Must be called with the lock held.
+func (ti *TemplateIndexer) selectTemplates(opts FilterOptions) []templatev1.Template {
+	return ti.selectFiltered(ti.newFilter(opts))
+}
+
+func (ti *TemplateIndexer) selectFiltered(f *templateFilter) []templatev1.Template {
 	templates := make([]templatev1.Template, 0, len(ti.templates))
 	for _, template := range ti.templates {
-		templates = append(templates, template)
+		if ti.matches(&template, f) {
+			templates = append(templates, template)
+		}
 	}
-	return ld.Summarize(templates), nil
+	return templates
 }
 
-func (ti *TemplateIndexer) DescribeBy(opts FilterOptions) ([]Description, error) {
+func countSummaries(ld Ledger, templates []templatev1.Template, langs []string) []Summary {
+	counts := make(map[string]int)
+	for _, template := range templates {
+		for _, value := range ld.Values(&template) {
+			counts[value] += 1
+		}
+	}
+
+	summaries := ld.Summarize(templates, langs...)
+	for i := range summaries {
+		summaries[i].Count = counts[summaries[i].ID]
+	}
+	return summaries
+}
+
+// DescribeBy describes the templates matching opts, in the first available of langs.
+func (ti *TemplateIndexer) DescribeBy(opts FilterOptions, langs ...string) ([]Description, error) {
 	ti.rwlock.RLock()
 	defer ti.rwlock.RUnlock()
 
+	f := ti.newFilter(opts)
 	descriptions := []Description{}
 	for _, template := range ti.templates {
-		matched := 0
-		for key, value := range opts {
-			label := makeLabel(fixLabelKey(key), value)
-			if _, ok := template.Labels[label]; ok {
-				matched += 1
-			} else {
-				// TODO: log
-			}
-		}
-		if matched == len(opts) {
-			descriptions = append(descriptions, Describe(&template, opts))
+		if ti.matches(&template, f) {
+			descriptions = append(descriptions, ti.describe(&template, f, langs))
 		}
 	}
 	ti.log.Info(fmt.Sprintf("returning %v descriptions out of %v templates", len(descriptions), len(ti.templates)))
 	return descriptions, nil
 }
 
+// Template returns the template with the given namespace and name
+func (ti *TemplateIndexer) Template(namespace, name string) (templatev1.Template, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	template, ok := ti.templates[templateKey(namespace, name)]
+	if !ok {
+		return templatev1.Template{}, fmt.Errorf("unknown template: %s/%s", namespace, name)
+	}
+	return *template.DeepCopy(), nil
+}
+
+// Namespaces returns the sorted namespaces of the templates in the index
+func (ti *TemplateIndexer) Namespaces() []string {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	namespaces := NewStringSet()
+	for _, t := range ti.templates {
+		namespaces.Add(t.Namespace)
+	}
+	return namespaces.Keys()
+}
+
+// LedgerNames returns the sorted names of the ledgers, which are also the keys usable in the FilterOptions
+func (ti *TemplateIndexer) LedgerNames() []string {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	names := NewStringSet()
+	for name := range ti.ledgers {
+		names.Add(name)
+	}
+	return names.Keys()
+}
+
+// templateFilter holds the FilterOptions ready to be matched against the templates
+type templateFilter struct {
+	opts              FilterOptions
+	includeDeprecated bool
+	// the namespaces of the templates, nil if any
+	namespaces *StringSet
+	// the values accepted by the version selectors, by key
+	accepted map[string]*StringSet
+}
+
+// newFilter resolves the version selectors in opts. A selector is resolved among
+// the values of the templates matching the other options, so "rhel7@latest" is the
+// latest RHEL 7 for which there is a template with the other requested values.
+func (ti *TemplateIndexer) newFilter(opts FilterOptions) *templateFilter {
+	f := &templateFilter{
+		opts:              opts.Without(IncludeDeprecatedOption).Without(NamespacesOption),
+		includeDeprecated: opts.IncludeDeprecated(),
+		namespaces:        opts.namespaces(),
+		accepted:          make(map[string]*StringSet),
+	}
+	for key, value := range f.opts {
+		ld, ok := ti.ledgers[key].(VersionedLedger)
+		if !ok {
+			continue
+		}
+		sel, ok := parseVersionSelector(value)
+		if !ok {
+			continue
+		}
+		values := NewStringSet()
+		for _, template := range ti.selectTemplates(opts.Without(key)) {
+			for _, v := range ld.Values(&template) {
+				values.Add(v)
+			}
+		}
+		f.accepted[key] = sel.resolve(ld, values.Keys())
+	}
+	return f
+}
+
+// matches tells if the template has all the values requested by the filter.
+// Keys which are not the name of a ledger are matched directly against the template labels.
+// The deprecated templates never match, unless the filter includes them.
+func (ti *TemplateIndexer) matches(t *templatev1.Template, f *templateFilter) bool {
+	if !f.includeDeprecated && isDeprecated(t) {
+		return false
+	}
+	if f.namespaces != nil && !f.namespaces.Contains(t.Namespace) {
+		return false
+	}
+	for key, value := range f.opts {
+		if ld, ok := ti.ledgers[key]; ok {
+			if !containsAny(ld.Values(t), f.acceptedValues(key, value)) {
+				return false
+			}
+			continue
+		}
+		label := makeLabel(fixLabelKey(key), value)
+		if _, ok := t.Labels[label]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *templateFilter) acceptedValues(key, value string) *StringSet {
+	if accepted, ok := f.accepted[key]; ok {
+		return accepted
+	}
+	values := NewStringSet()
+	values.Add(value)
+	return values
+}
+
+// describe the template, reporting the actual values selected by the filter
+func (ti *TemplateIndexer) describe(t *templatev1.Template, f *templateFilter, langs []string) Description {
+	opts := f.opts
+	if len(f.accepted) > 0 {
+		opts = FilterOptions{}
+		for key, value := range f.opts {
+			accepted, ok := f.accepted[key]
+			if !ok {
+				opts[key] = value
+				continue
+			}
+			// the newest, if the template has more
+			ld := ti.ledgers[key].(VersionedLedger)
+			var newest *OSVersion
+			for _, v := range ld.Values(t) {
+				ver := ld.OSVersion(v)
+				if accepted.Contains(v) && (newest == nil || newerVersion(ver, *newest)) {
+					newest = &ver
+				}
+			}
+			if newest != nil {
+				opts[key] = newest.ID
+			}
+		}
+	}
+	desc := Describe(t, opts, langs...)
+	desc.Facets = ti.facets(t)
+	desc.IconURL = ti.iconURL(t)
+	return desc
+}
+
+func (ti *TemplateIndexer) facets(t *templatev1.Template) map[string][]string {
+	facets := make(map[string][]string)
+	for name, ld := range ti.ledgers {
+		values := ld.Values(t)
+		if len(values) == 0 {
+			continue
+		}
+		sort.Strings(values)
+		facets[name] = values
+	}
+	return facets
+}
+
+func containsAny(items []string, set *StringSet) bool {
+	for _, it := range items {
+		if set.Contains(it) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(items []string, item string) bool {
+	for _, it := range items {
+		if it == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the templates matching opts whose text matches the query, best matches first.
+// At most limit results are returned, or all of them if limit is not positive.
+func (ti *TemplateIndexer) Search(query string, opts FilterOptions, limit int, langs ...string) ([]SearchResult, error) {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	f := ti.newFilter(opts)
+	results := []SearchResult{}
+	for _, hit := range ti.search.search(query) {
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+		template, ok := ti.templates[hit.Key]
+		if !ok || !ti.matches(&template, f) {
+			continue
+		}
+		results = append(results, SearchResult{
+			Description: ti.describe(&template, f, langs),
+			Score:       hit.Score,
+			Highlights:  hit.Highlights,
+		})
+	}
+	ti.log.Info(fmt.Sprintf("search %q: returning %v results out of %v templates", query, len(results), len(ti.templates)))
+	return results, nil
+}
+
 // Set the initial state of the index. You must call this before to watch for updates.
 func (ti *TemplateIndexer) AddTemplates(ts []templatev1.Template) (int, error) {
 	var err error
@@ -111,7 +437,7 @@ func (ti *TemplateIndexer) AddTemplates(ts []templatev1.Template) (int, error) {
 	defer ti.rwlock.Unlock()
 
 	for _, t := range ts {
-		err = ti.add(&t)
+		err = ti.add(DefaultSource, &t)
 
 		if err != nil {
 			return count, err
@@ -121,29 +447,113 @@ func (ti *TemplateIndexer) AddTemplates(ts []templatev1.Template) (int, error) {
 	return count, nil
 }
 
+// Set adds the template to the index, from the DefaultSource
+func (ti *TemplateIndexer) Set(t *templatev1.Template) error {
+	return ti.SetFrom(DefaultSource, t)
+}
+
+// SetFrom adds the template of the source to the index, replacing the one with the same namespace and name, if any.
+// If that one comes from another source, the template is not added, and a ConflictError is returned.
+func (ti *TemplateIndexer) SetFrom(source string, t *templatev1.Template) error {
+	ti.rwlock.Lock()
+	defer ti.rwlock.Unlock()
+
+	if err := ti.checkSource(source, keyOf(t)); err != nil {
+		return err
+	}
+	return ti.add(source, t)
+}
+
+// Delete removes the template of the DefaultSource from the index, if it is there
+func (ti *TemplateIndexer) Delete(namespace, name string) error {
+	return ti.DeleteFrom(DefaultSource, namespace, name)
+}
+
+// DeleteFrom removes the template of the source from the index, if it is there.
+// A template with the same namespace and name from another source is left alone.
+func (ti *TemplateIndexer) DeleteFrom(source, namespace, name string) error {
+	ti.rwlock.Lock()
+	defer ti.rwlock.Unlock()
+
+	key := templateKey(namespace, name)
+	t, ok := ti.templates[key]
+	if !ok || ti.sources[key] != source {
+		return nil
+	}
+	return ti.remove(&t)
+}
+
+// checkSource fails if the template with the given key comes from another source
+func (ti *TemplateIndexer) checkSource(source, key string) error {
+	if owner, ok := ti.sources[key]; ok && owner != source {
+		return &ConflictError{Key: key, Source: owner}
+	}
+	return nil
+}
+
+// DeleteNamespace removes from the index all the templates of the namespace, returning how many they were
+func (ti *TemplateIndexer) DeleteNamespace(namespace string) (int, error) {
+	ti.rwlock.Lock()
+	defer ti.rwlock.Unlock()
+
+	count := 0
+	for _, t := range ti.templates {
+		if t.Namespace != namespace {
+			continue
+		}
+		if err := ti.remove(&t); err != nil {
+			return count, err
+		}
+		count += 1
+	}
+	return count, nil
+}
+
 func (ti *TemplateIndexer) Update(t *templatev1.Template) error {
 	ti.rwlock.Lock()
 	defer ti.rwlock.Unlock()
 
 	ti.log.Info(fmt.Sprintf("handling template: %v", t.Name))
 
-	_, ok := ti.templates[t.Name]
+	if err := ti.checkSource(DefaultSource, keyOf(t)); err != nil {
+		return err
+	}
+	old, ok := ti.templates[keyOf(t)]
 	if !ok {
-		ti.add(t)
+		ti.add(DefaultSource, t)
+	} else if old.ResourceVersion != t.ResourceVersion {
+		// modified: replace it, keeping the previous revisions
+		ti.add(DefaultSource, t)
 	} else {
 		ti.remove(t)
 	}
 	return nil
 }
 
-func (ti *TemplateIndexer) add(t *templatev1.Template) error {
-	ti.templates[t.Name] = *t
-	ti.log.Info(fmt.Sprintf("added template: %v", t.Name))
+func (ti *TemplateIndexer) add(source string, t *templatev1.Template) error {
+	key := keyOf(t)
+	eventType := EventAdded
+	if _, ok := ti.templates[key]; ok {
+		eventType = EventModified
+	}
+	ti.templates[key] = *t
+	ti.sources[key] = source
+	ti.search.add(key, templateSearchFields(t))
+	ti.indexDataIcon(t)
+	ti.recordRevision(t)
+	ti.notify(eventType, t)
+	ti.log.Info(fmt.Sprintf("added template: %v", key))
 	return nil
 }
 
 func (ti *TemplateIndexer) remove(t *templatev1.Template) error {
-	delete(ti.templates, t.Name)
-	ti.log.Info(fmt.Sprintf("removed template: %v", t.Name))
+	key := keyOf(t)
+	delete(ti.templates, key)
+	delete(ti.sources, key)
+	ti.forgetRevisions(key)
+	delete(ti.dataIcons, key)
+	ti.search.remove(key)
+	ti.notify(EventDeleted, t)
+	ti.log.Info(fmt.Sprintf("removed template: %v", key))
 	return nil
 }
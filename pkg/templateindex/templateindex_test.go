@@ -22,8 +22,11 @@ import (
 	"net/url"
 	"testing"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 
+	templatev1 "github.com/openshift/api/template/v1"
+
 	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
 )
 
@@ -37,7 +40,7 @@ func TestTemplateIndexerCreatedEmpty(t *testing.T) {
 
 func TestTemplateIndexerUnknownLedger(t *testing.T) {
 	ti := NewTemplateIndexer(logf.NullLogger{})
-	summaries, err := ti.SummarizeBy("unknown")
+	summaries, err := ti.SummarizeBy("unknown", FilterOptions{})
 	if err == nil {
 		t.Errorf("unexpectedly succesful")
 	}
@@ -51,7 +54,7 @@ func TestTemplateIndexerEmptyLedger(t *testing.T) {
 	ti := NewTemplateIndexer(logf.NullLogger{})
 	ti.AddLedger("foobar", NewJSONLedger("foobar"))
 
-	summaries, err := ti.SummarizeBy("foobar")
+	summaries, err := ti.SummarizeBy("foobar", FilterOptions{})
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -76,7 +79,7 @@ func TestTemplateIndexerWorkloadLedger(t *testing.T) {
 		return
 	}
 
-	summaries, err := ti.SummarizeBy("workload")
+	summaries, err := ti.SummarizeBy("workload", FilterOptions{})
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -231,7 +234,7 @@ func TestTemplateIndexerAddUsingUpdate(t *testing.T) {
 		return
 	}
 
-	summaries, err := ti.SummarizeBy("workload")
+	summaries, err := ti.SummarizeBy("workload", FilterOptions{})
 	if err != nil || len(summaries) < 1 {
 		t.Errorf("missing output: %v", err)
 		return
@@ -269,7 +272,7 @@ func TestTemplateIndexerRemoveUsingUpdate(t *testing.T) {
 		return
 	}
 
-	summaries, err := ti.SummarizeBy("workload")
+	summaries, err := ti.SummarizeBy("workload", FilterOptions{})
 	if err != nil || len(summaries) != 0 {
 		t.Errorf("unexpected output: %v", err)
 		return
@@ -316,7 +319,7 @@ func TestTemplateIndexerRemoveOnceUsingUpdate(t *testing.T) {
 		}
 	}
 
-	summaries, err := ti.SummarizeBy("workload")
+	summaries, err := ti.SummarizeBy("workload", FilterOptions{})
 	if err != nil || len(summaries) < 1 {
 		t.Errorf("unexpected output: %v", err)
 		return
@@ -329,3 +332,344 @@ func TestTemplateIndexerRemoveOnceUsingUpdate(t *testing.T) {
 		}
 	}
 }
+
+func TestTemplateIndexerDeleteNamespace(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 3 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	templates[0].Namespace = "team-a"
+	templates[1].Namespace = "team-a"
+	templates[2].Namespace = "team-b"
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Fatalf("failed to add test templates! %v", err)
+	}
+
+	count, err = ti.DeleteNamespace("team-a")
+	if err != nil || count != 2 {
+		t.Errorf("unexpected result: %v %v", count, err)
+	}
+	if ti.Count() != len(templates)-2 {
+		t.Errorf("unexpected count: %v", ti.Count())
+	}
+	if _, err := ti.Template("team-a", templates[0].Name); err == nil {
+		t.Errorf("template %v still indexed", templates[0].Name)
+	}
+	if _, err := ti.Template("team-b", templates[2].Name); err != nil {
+		t.Errorf("template %v removed: %v", templates[2].Name, err)
+	}
+
+	count, err = ti.DeleteNamespace("team-a")
+	if err != nil || count != 0 {
+		t.Errorf("unexpected result: %v %v", count, err)
+	}
+}
+
+func TestTemplateIndexerSourceConflict(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	template := &templates[0]
+	vm := template.DeepCopy()
+	vm.ResourceVersion = "1000"
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	if err := ti.Set(template); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ti.SetFrom("virtualmachines", vm); !IsConflict(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ti.DeleteFrom("virtualmachines", vm.Namespace, vm.Name); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	found, err := ti.Template(template.Namespace, template.Name)
+	if err != nil || found.ResourceVersion != template.ResourceVersion {
+		t.Errorf("template of another source replaced: %v %v", found.ResourceVersion, err)
+	}
+
+	// once the template is gone, the VM can take its place
+	ti.Delete(template.Namespace, template.Name)
+	if err := ti.SetFrom("virtualmachines", vm); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ti.Update(template); !IsConflict(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	found, err = ti.Template(vm.Namespace, vm.Name)
+	if err != nil || found.ResourceVersion != vm.ResourceVersion {
+		t.Errorf("unexpected template: %v %v", found.ResourceVersion, err)
+	}
+}
+
+func TestTemplateIndexerSameNameInNamespaces(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	shared := templates[0].DeepCopy()
+	shared.Namespace = "openshift"
+	own := templates[0].DeepCopy()
+	own.Namespace = "team-a"
+	own.Annotations["description"] = "the template of team a"
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.Set(shared)
+	ti.Set(own)
+	if ti.Count() != 2 {
+		t.Fatalf("unexpected count: %v", ti.Count())
+	}
+
+	for _, ns := range []string{"openshift", "team-a"} {
+		tmpl, err := ti.Template(ns, shared.Name)
+		if err != nil || tmpl.Namespace != ns {
+			t.Errorf("unexpected template in %v: %v %v", ns, tmpl.Namespace, err)
+		}
+		if _, err := ti.Revisions(ns, shared.Name); err != nil {
+			t.Errorf("missing revisions in %v: %v", ns, err)
+		}
+	}
+	found := false
+	ti.View(func(v *View) error {
+		dt, ok := v.Template("team-a", own.Name)
+		found = ok && dt.Template.Annotations["description"] == own.Annotations["description"]
+		return nil
+	})
+	if !found {
+		t.Errorf("the template of team-a not found in the view")
+	}
+	results, err := ti.Search(shared.Name, FilterOptions{}, 0)
+	if err != nil || len(results) != 2 {
+		t.Errorf("unexpected search results: %v %v", results, err)
+	}
+
+	ti.Delete("team-a", own.Name)
+	if _, err := ti.Template("openshift", shared.Name); err != nil {
+		t.Errorf("template of another namespace deleted: %v", err)
+	}
+	count, err := ti.DeleteNamespace("team-a")
+	if err != nil || count != 0 {
+		t.Errorf("unexpected result: %v %v", count, err)
+	}
+	if _, err := ti.Revisions("openshift", shared.Name); err != nil {
+		t.Errorf("revisions of another namespace deleted: %v", err)
+	}
+}
+
+func TestTemplateIndexerWithNamespaces(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 3 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+	templates[0].Namespace = "team-a"
+	templates[1].Namespace = "team-b"
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("workload", NewJSONLedger("workload"))
+	if _, err := ti.AddTemplates(templates); err != nil {
+		t.Fatalf("failed to add test templates! %v", err)
+	}
+
+	namespaces := ti.Namespaces()
+	if len(namespaces) < 3 || namespaces[len(namespaces)-2] != "team-a" || namespaces[len(namespaces)-1] != "team-b" {
+		t.Errorf("unexpected namespaces: %v", namespaces)
+	}
+
+	descs, err := ti.DescribeBy(FilterOptions{}.WithNamespaces([]string{"team-a", "team-b"}))
+	if err != nil || len(descs) != 2 {
+		t.Errorf("unexpected descriptions: %v %v", descs, err)
+	}
+
+	descs, err = ti.DescribeBy(FilterOptions{}.WithNamespaces([]string{}))
+	if err != nil || len(descs) != 0 {
+		t.Errorf("unexpected descriptions: %v %v", descs, err)
+	}
+
+	summaries, err := ti.CountBy("workload", FilterOptions{}.WithNamespaces([]string{"team-a"}))
+	if err != nil || len(summaries) != 1 || summaries[0].Count != 1 {
+		t.Errorf("unexpected summaries: %v %v", summaries, err)
+	}
+}
+
+func TestTemplateIndexerCustomLedger(t *testing.T) {
+	templates := []templatev1.Template{
+		templatev1.Template{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "fedora-gpu-large",
+				Labels: map[string]string{
+					"os.template.cnv.io/fedora28":     "true",
+					"flavor.template.cnv.io/large":    "true",
+					"gpu.example.com/nvidia-t4":       "true",
+					"gpu.example.com/nvidia-v100":     "true",
+					"gpu.example.com/disabled-vendor": "false",
+				},
+			},
+		},
+		templatev1.Template{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "fedora-generic-large",
+				Labels: map[string]string{
+					"os.template.cnv.io/fedora28":  "true",
+					"flavor.template.cnv.io/large": "true",
+				},
+			},
+		},
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("gpu", NewJSONLedger("gpu.example.com"))
+	ti.AddLedger("size", NewJSONLedger("flavor"))
+
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Errorf("cannot add test templates! %v", err)
+		return
+	}
+
+	summaries, err := ti.SummarizeBy("gpu", FilterOptions{})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := []Summary{
+		Summary{ID: "nvidia-t4"},
+		Summary{ID: "nvidia-v100"},
+	}
+	checkSummaries(t, summaries, expected)
+
+	u, err := url.Parse("http://localhost:18081/templates?gpu=nvidia-t4&size=large")
+	if err != nil {
+		t.Errorf("cannot parse url %v", err)
+		return
+	}
+	descs, err := ti.DescribeBy(FilterOptionsFromURL(u, ti.LedgerNames()...))
+	if err != nil || len(descs) != 1 {
+		t.Errorf("unexpected output: %v err=%v", descs, err)
+		return
+	}
+	if descs[0].ID != "fedora-gpu-large" {
+		t.Errorf("unexpected template: %v", descs[0].ID)
+	}
+	gpus := descs[0].Facets["gpu"]
+	if len(gpus) != 2 || gpus[0] != "nvidia-t4" || gpus[1] != "nvidia-v100" {
+		t.Errorf("unexpected facets: %v", descs[0].Facets)
+	}
+}
+
+func TestTemplateIndexerCountBy(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("workload", NewJSONLedger("workload"))
+
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Errorf("failed to add test templates! %v", err)
+		return
+	}
+
+	summaries, err := ti.CountBy("workload", FilterOptions{})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expected := []Summary{
+		Summary{ID: "generic", Count: 22},
+		Summary{ID: "highperformance", Count: 8},
+	}
+	checkSummaries(t, summaries, expected)
+}
+
+func TestTemplateIndexerSummarizeByWithFilter(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", NewJSONLedger("os"))
+	ti.AddLedger("workload", NewJSONLedger("workload"))
+	ti.AddLedger("size", NewJSONLedger("flavor"))
+
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Errorf("failed to add test templates! %v", err)
+		return
+	}
+
+	u, err := url.Parse("http://localhost:18081/sizes?os=win2k12r2&workload=generic")
+	if err != nil {
+		t.Errorf("cannot parse url %v", err)
+		return
+	}
+
+	summaries, err := ti.SummarizeBy("size", FilterOptionsFromURL(u, ti.LedgerNames()...))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	checkSummaries(t, summaries, []Summary{
+		Summary{ID: "large"},
+		Summary{ID: "medium"},
+	})
+
+	summaries, err = ti.CountBy("os", FilterOptions{"workload": "highperformance"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	checkSummaries(t, summaries, []Summary{
+		Summary{ID: "fedora26", Count: 4},
+		Summary{ID: "fedora27", Count: 4},
+		Summary{ID: "fedora28", Count: 4},
+		Summary{ID: "rhel7.0", Count: 4},
+		Summary{ID: "rhel7.1", Count: 4},
+		Summary{ID: "rhel7.2", Count: 4},
+		Summary{ID: "rhel7.3", Count: 4},
+		Summary{ID: "rhel7.4", Count: 4},
+		Summary{ID: "rhel7.5", Count: 4},
+	})
+}
+
+func TestTemplateIndexerFacets(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", NewJSONLedger("os"))
+	ti.AddLedger("workload", NewJSONLedger("workload"))
+	ti.AddLedger("size", NewJSONLedger("flavor"))
+
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Errorf("failed to add test templates! %v", err)
+		return
+	}
+
+	facets, err := ti.Facets(FilterOptions{"os": "win10"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// windows templates are only generic
+	checkSummaries(t, facets["workload"], []Summary{
+		Summary{ID: "generic", Count: 2},
+	})
+	checkSummaries(t, facets["size"], []Summary{
+		Summary{ID: "large", Count: 1},
+		Summary{ID: "medium", Count: 1},
+	})
+	// the selected facet still reports all the alternatives
+	if len(facets["os"]) != 16 {
+		t.Errorf("unexpected os facet: %#v", facets["os"])
+	}
+}
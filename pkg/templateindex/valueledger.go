@@ -0,0 +1,85 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"strings"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// ValueLedger summarizes the values of a label, like "template.cnv.io/type: base",
+// or of an annotation, like "template.cnv.io/version: v1alpha1", or the items
+// of a comma-separated list held in an annotation, like "tags: kubevirt,linux", or the
+// API versions of the objects of an API group, like "kubevirt.io/v1alpha2".
+// The names come from the JSONLedger, whose label is the key of the label or of the annotation,
+// or the API group.
+type ValueLedger struct {
+	*JSONLedger
+	valueType string
+}
+
+// NewValueLedger creates a ValueLedger. valueType must be one of
+// LedgerTypeLabelValue, LedgerTypeAnnotation, LedgerTypeTags and LedgerTypeAPIVersion.
+func NewValueLedger(ld *JSONLedger, valueType string) *ValueLedger {
+	return &ValueLedger{
+		JSONLedger: ld,
+		valueType:  valueType,
+	}
+}
+
+func (ld *ValueLedger) Values(t *templatev1.Template) []string {
+	switch ld.valueType {
+	case LedgerTypeLabelValue:
+		return nonEmpty(t.Labels[ld.label])
+	case LedgerTypeAnnotation:
+		return nonEmpty(t.Annotations[ld.label])
+	case LedgerTypeTags:
+		return splitTags(t.Annotations[ld.label])
+	case LedgerTypeAPIVersion:
+		return objectAPIVersions(t, ld.label)
+	}
+	return []string{}
+}
+
+func (ld *ValueLedger) Summarize(templates []templatev1.Template, langs ...string) []Summary {
+	return ld.summarize(templates, ld.Values, langs)
+}
+
+func nonEmpty(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return []string{}
+	}
+	return []string{value}
+}
+
+func splitTags(value string) []string {
+	seen := NewStringSet()
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen.Contains(tag) {
+			continue
+		}
+		tags = append(tags, tag)
+		seen.Add(tag)
+	}
+	return tags
+}
@@ -0,0 +1,125 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+)
+
+func TestLabelValueLedger(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ld := NewValueLedger(NewJSONLedger("template.cnv.io/type"), LedgerTypeLabelValue)
+	summaries := ld.Summarize(templates)
+
+	expected := []Summary{
+		Summary{ID: "base"},
+	}
+	checkSummaries(t, summaries, expected)
+}
+
+func TestAnnotationLedger(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ld := NewValueLedger(NewJSONLedger("template.cnv.io/version"), LedgerTypeAnnotation)
+	summaries := ld.Summarize(templates)
+
+	expected := []Summary{
+		Summary{ID: "v1alpha1"},
+	}
+	checkSummaries(t, summaries, expected)
+}
+
+func TestTagsLedger(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ld := NewValueLedger(NewJSONLedger("tags"), LedgerTypeTags)
+	summaries := ld.Summarize(templates)
+
+	expected := []Summary{
+		Summary{ID: "centos"},
+		Summary{ID: "fedora"},
+		Summary{ID: "kubevirt"},
+		Summary{ID: "linux"},
+		Summary{ID: "opensuse"},
+		Summary{ID: "rhel"},
+		Summary{ID: "ubuntu"},
+		Summary{ID: "virtualmachine"},
+		Summary{ID: "windows"},
+	}
+	checkSummaries(t, summaries, expected)
+}
+
+func TestTemplateIndexerDescribeByTag(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) < 1 {
+		t.Errorf("cannot load test templates! %v", err)
+		return
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("tag", NewValueLedger(NewJSONLedger("tags"), LedgerTypeTags))
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Errorf("cannot add test templates! %v", err)
+		return
+	}
+
+	descs, err := ti.DescribeBy(FilterOptions{
+		"tag": "windows",
+	})
+	if err != nil || len(descs) < 1 {
+		t.Errorf("unexpected output: %v err=%v", len(descs), err)
+		return
+	}
+	for _, desc := range descs {
+		if desc.OS[:3] != "win" {
+			t.Errorf("unexpected template: %v", desc.ID)
+		}
+	}
+}
+
+func TestSplitTags(t *testing.T) {
+	tags := splitTags(" kubevirt, linux,,kubevirt ,centos")
+	expected := []string{"kubevirt", "linux", "centos"}
+	if len(tags) != len(expected) {
+		t.Fatalf("expected %v, received %v", expected, tags)
+	}
+	for i, exp := range expected {
+		if tags[i] != exp {
+			t.Errorf("expected=%v received=%v", exp, tags[i])
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"fmt"
+	"sort"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+// View reads the index holding its read lock once, to answer the queries made of many parts,
+// like the GraphQL ones, consistently and without locking for each part.
+// It is valid only within the function given to TemplateIndexer.View.
+type View struct {
+	ti *TemplateIndexer
+}
+
+// DescribedTemplate is a template with its description
+type DescribedTemplate struct {
+	Description
+	// shared with the index: must not be modified, nor used after the View ends
+	Template *templatev1.Template
+}
+
+// View calls fn with a view of the index, holding the read lock meanwhile.
+// fn must not call the other methods of the TemplateIndexer, which would deadlock with a writer waiting.
+func (ti *TemplateIndexer) View(fn func(v *View) error) error {
+	ti.rwlock.RLock()
+	defer ti.rwlock.RUnlock()
+
+	return fn(&View{ti: ti})
+}
+
+// Templates describes the templates matching opts, sorted by namespace and name
+func (v *View) Templates(opts FilterOptions, langs ...string) []DescribedTemplate {
+	f := v.ti.newFilter(opts)
+	res := []DescribedTemplate{}
+	for key := range v.ti.templates {
+		t := v.ti.templates[key]
+		if v.ti.matches(&t, f) {
+			res = append(res, DescribedTemplate{
+				Description: v.ti.describe(&t, f, langs),
+				Template:    &t,
+			})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Template.Namespace != res[j].Template.Namespace {
+			return res[i].Template.Namespace < res[j].Template.Namespace
+		}
+		return res[i].Template.Name < res[j].Template.Name
+	})
+	return res
+}
+
+// Template describes the template with the given namespace and name
+func (v *View) Template(namespace, name string, langs ...string) (DescribedTemplate, bool) {
+	t, ok := v.ti.templates[templateKey(namespace, name)]
+	if !ok {
+		return DescribedTemplate{}, false
+	}
+	return DescribedTemplate{
+		Description: v.ti.describe(&t, v.ti.newFilter(FilterOptions{}), langs),
+		Template:    &t,
+	}, true
+}
+
+// Summarize is like SummarizeBy, or like CountBy if counts
+func (v *View) Summarize(name string, opts FilterOptions, counts bool, langs ...string) ([]Summary, error) {
+	ld, ok := v.ti.ledgers[name]
+	if !ok {
+		return []Summary{}, fmt.Errorf("invalid label: %v", name)
+	}
+	if counts {
+		return countSummaries(ld, v.ti.selectTemplates(opts), langs), nil
+	}
+	return ld.Summarize(v.ti.selectTemplates(opts), langs...), nil
+}
+
+// Summary returns the summary of the value the template has in the ledger, if any
+func (v *View) Summary(name, value string, t *templatev1.Template, langs ...string) (Summary, bool) {
+	ld, ok := v.ti.ledgers[name]
+	if !ok || value == "" {
+		return Summary{}, false
+	}
+	for _, summary := range ld.Summarize([]templatev1.Template{*t}, langs...) {
+		if summary.ID == value {
+			return summary, true
+		}
+	}
+	return Summary{}, false
+}
+
+// LedgerNames is like TemplateIndexer.LedgerNames
+func (v *View) LedgerNames() []string {
+	names := NewStringSet()
+	for name := range v.ti.ledgers {
+		names.Add(name)
+	}
+	return names.Keys()
+}
@@ -0,0 +1,101 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"reflect"
+	"testing"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/fromanirh/kubevirt-template-indexer/internal/pkg/testutils"
+)
+
+func TestTemplateIndexerView(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+
+	ti := NewTemplateIndexer(logf.NullLogger{})
+	ti.AddLedger("os", NewJSONLedger("os"))
+	ti.AddLedger("size", NewJSONLedger("flavor"))
+	count, err := ti.AddTemplates(templates)
+	if err != nil || count != len(templates) {
+		t.Fatalf("failed to add test templates! %v", err)
+	}
+	counts, err := ti.CountBy("size", FilterOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = ti.View(func(v *View) error {
+		described := v.Templates(FilterOptions{})
+		if len(described) != len(templates) {
+			t.Errorf("unexpected templates: %v expected %v", len(described), len(templates))
+		}
+		for i := 1; i < len(described); i++ {
+			if described[i-1].Template.Name > described[i].Template.Name {
+				t.Errorf("templates not sorted: %v %v", described[i-1].Template.Name, described[i].Template.Name)
+			}
+		}
+
+		dt, ok := v.Template(templates[0].Namespace, templates[0].Name)
+		if !ok || dt.ID != templates[0].Name {
+			t.Errorf("unexpected template: %v %v", dt.ID, ok)
+		}
+		if _, ok := v.Template(templates[0].Namespace, "does-not-exist"); ok {
+			t.Errorf("unexpected template found")
+		}
+
+		summary, ok := v.Summary("os", dt.OS, dt.Template)
+		if !ok || summary.ID != dt.OS {
+			t.Errorf("unexpected summary: %v %v", summary, ok)
+		}
+
+		summaries, err := v.Summarize("size", FilterOptions{}, true)
+		if err != nil || !reflect.DeepEqual(summaries, counts) {
+			t.Errorf("unexpected summaries: %v %v expected %v", summaries, err, counts)
+		}
+		if _, err := v.Summarize("bogus", FilterOptions{}, false); err == nil {
+			t.Errorf("unexpected success summarizing by bogus")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVMResources(t *testing.T) {
+	templates, err := testutils.LoadTemplates("test-data-alltemplates.yaml")
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("cannot load test templates! %v", err)
+	}
+
+	for _, tmpl := range templates {
+		res, ok := VMResources(&tmpl)
+		if ok != HasVirtualMachine(&tmpl) {
+			t.Errorf("template %v: unexpected resources %v", tmpl.Name, ok)
+		}
+		if ok && (res.Cores < 1 || res.Memory <= 0) {
+			t.Errorf("template %v: unexpected resources %v", tmpl.Name, res)
+		}
+	}
+}
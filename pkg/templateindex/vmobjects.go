@@ -0,0 +1,142 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	templatev1 "github.com/openshift/api/template/v1"
+)
+
+const (
+	kubevirtGroup = "kubevirt.io"
+	vmKind        = "VirtualMachine"
+)
+
+// vmObject holds the bits of the VirtualMachine objects embedded in the templates we care about.
+// We don't want to depend on the kubevirt types, so we decode only what we need.
+type vmObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name        string            `json:"name"`
+		OSInfoName  string            `json:"osinfoname"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		Template struct {
+			Spec struct {
+				Domain struct {
+					// decoded by resources: a parameterized or unexpected value must not hide the whole VM
+					CPU       json.RawMessage `json:"cpu"`
+					Resources json.RawMessage `json:"resources"`
+				} `json:"domain"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+// vmResources are the resources requested by a VirtualMachine
+type vmResources struct {
+	Cores int64
+	// bytes
+	Memory int64
+}
+
+// resources returns the resources requested by the VM. Unparseable values, like the parameters
+// of the templates, are reported as zero.
+func (vm *vmObject) resources() vmResources {
+	domain := vm.Spec.Template.Spec.Domain
+	cpu := struct {
+		Cores json.RawMessage `json:"cores"`
+	}{}
+	json.Unmarshal(domain.CPU, &cpu)
+	resources := struct {
+		Requests map[string]json.RawMessage `json:"requests"`
+	}{}
+	json.Unmarshal(domain.Resources, &resources)
+
+	res := vmResources{}
+	if cores, err := strconv.ParseInt(scalarValue(cpu.Cores), 10, 64); err == nil {
+		res.Cores = cores
+	}
+	// kubevirt defaults
+	if res.Cores == 0 {
+		res.Cores = 1
+	}
+	if mem, ok := resources.Requests["memory"]; ok {
+		if q, err := resource.ParseQuantity(scalarValue(mem)); err == nil {
+			res.Memory = q.Value()
+		}
+	}
+	return res
+}
+
+// scalarValue returns the JSON string unquoted, or any other JSON value as it is, like the numbers
+func scalarValue(raw json.RawMessage) string {
+	value := ""
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// isVirtualMachine recognizes also the OfflineVirtualMachines of the older APIs
+func isVirtualMachine(apiVersion, kind string) bool {
+	return (kind == vmKind || kind == offlineVMKind) && strings.HasPrefix(apiVersion, kubevirtGroup+"/")
+}
+
+// virtualMachines returns the VirtualMachine objects found in the template
+func virtualMachines(t *templatev1.Template) []vmObject {
+	vms := []vmObject{}
+	for _, obj := range t.Objects {
+		if obj.Raw == nil {
+			continue
+		}
+		vm := vmObject{}
+		if err := json.Unmarshal(obj.Raw, &vm); err != nil {
+			continue
+		}
+		if isVirtualMachine(vm.APIVersion, vm.Kind) {
+			vms = append(vms, vm)
+		}
+	}
+	return vms
+}
+
+// HasVirtualMachine tells if the template creates a kubevirt.io VirtualMachine
+func HasVirtualMachine(t *templatev1.Template) bool {
+	return len(virtualMachines(t)) > 0
+}
+
+// VMResources returns the resources requested by the first VirtualMachine of the template,
+// and false if the template creates none
+func VMResources(t *templatev1.Template) (Requirements, bool) {
+	vms := virtualMachines(t)
+	if len(vms) == 0 {
+		return Requirements{}, false
+	}
+	res := vms[0].resources()
+	return Requirements{Cores: res.Cores, Memory: res.Memory}, true
+}
@@ -0,0 +1,112 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ */
+
+package templateindex
+
+import (
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	templatev1 "github.com/openshift/api/template/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func templateWithVM(t *testing.T, vm string) *templatev1.Template {
+	raw, err := yaml.YAMLToJSON([]byte(vm))
+	if err != nil {
+		t.Fatalf("cannot convert the VM: %v", err)
+	}
+	template := &templatev1.Template{}
+	template.Name = "test"
+	template.Objects = []runtime.RawExtension{{Raw: raw}}
+	return template
+}
+
+func TestVMResourcesTolerant(t *testing.T) {
+	testCases := []struct {
+		name     string
+		domain   string
+		expected Requirements
+	}{
+		{
+			name: "quantities",
+			domain: `
+        cpu:
+          cores: 2
+        resources:
+          requests:
+            memory: 2Gi`,
+			expected: Requirements{Cores: 2, Memory: 2 * 1024 * 1024 * 1024},
+		},
+		{
+			name: "numeric memory and parameterized cores",
+			domain: `
+        cpu:
+          cores: ${CPU_CORES}
+        resources:
+          requests:
+            memory: 1024`,
+			expected: Requirements{Cores: 1, Memory: 1024},
+		},
+		{
+			name: "quoted cores and parameterized memory",
+			domain: `
+        cpu:
+          cores: "4"
+        resources:
+          requests:
+            memory: ${MEMORY}`,
+			expected: Requirements{Cores: 4},
+		},
+		{
+			name: "unexpected types",
+			domain: `
+        cpu: 2
+        resources:
+          requests:
+          - memory`,
+			expected: Requirements{Cores: 1},
+		},
+		{
+			name:     "defaults",
+			domain:   ` {}`,
+			expected: Requirements{Cores: 1},
+		},
+	}
+
+	for _, testCase := range testCases {
+		template := templateWithVM(t, `
+apiVersion: kubevirt.io/v1alpha3
+kind: VirtualMachine
+metadata:
+  name: test
+spec:
+  template:
+    spec:
+      domain:`+testCase.domain)
+		if !HasVirtualMachine(template) {
+			t.Errorf("%s: VM not found", testCase.name)
+			continue
+		}
+		req, ok := VMResources(template)
+		if !ok || req != testCase.expected {
+			t.Errorf("%s: unexpected resources: %v %v expected %v", testCase.name, ok, req, testCase.expected)
+		}
+	}
+}